@@ -2,8 +2,10 @@ package main
 
 import (
 	"Go-Microservice/internal/auth"
+	"Go-Microservice/internal/breaker"
 	"Go-Microservice/internal/env"
 	"Go-Microservice/internal/mailer"
+	"Go-Microservice/internal/ranking"
 	"Go-Microservice/internal/ratelimiter"
 	"Go-Microservice/internal/repo"
 	"Go-Microservice/internal/repo/cache"
@@ -12,6 +14,8 @@ import (
 	"github.com/go-chi/cors"
 	"log/slog"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/go-chi/chi/v5"
@@ -35,12 +39,43 @@ type config struct {
 	db                dbConfig
 	apiUrl            string
 	invitationExpTime time.Duration
-	mailConfig        mailConfig
-	frontendURL       string
-	env               string
-	auth              authConfig
-	redisConfig       redisConfig
-	rateLimiterConfig ratelimiter.Config
+	invitationSweep   invitationSweepConfig
+	retention         retentionConfig
+	// passwordResetExpTime is how long a password reset link stays valid
+	passwordResetExpTime time.Duration
+	mailConfig           mailConfig
+	frontendURL          string
+	env                  string
+	auth                 authConfig
+	redisConfig          redisConfig
+	timeline             timelineConfig
+	cache                cacheConfig
+	ranking              rankingConfig
+	rateLimiterConfig    ratelimiter.Config
+	loginLockout         ratelimiter.LockoutConfig
+	// requireIfMatch rejects post and comment updates and deletes without an
+	// If-Match header
+	requireIfMatch bool
+	// oidcProviders are the external identity providers users can sign in with
+	oidcProviders []auth.OIDCConfig
+}
+
+type invitationSweepConfig struct {
+	enabled bool
+	// interval is how often expired invitations are swept
+	interval time.Duration
+	// unactivatedMaxAge is how long a registered user may stay unactivated
+	// before the account is deleted, once its invitation has expired
+	unactivatedMaxAge time.Duration
+}
+
+// retentionConfig configures the purge of soft deleted posts, comments and users.
+type retentionConfig struct {
+	enabled bool
+	// period is how long deleted rows can be restored before they are purged
+	period time.Duration
+	// interval is how often deleted rows are purged
+	interval time.Duration
 }
 
 type redisConfig struct {
@@ -48,6 +83,39 @@ type redisConfig struct {
 	pw      string
 	db      int
 	enabled bool
+	// breaker stops calling Redis after repeated failures, so that requests
+	// fall back to the database and in-memory rate limits
+	breaker breaker.Config
+}
+
+// rankingConfig configures the ranked "for you" feed.
+type rankingConfig struct {
+	weights ranking.Weights
+	// candidates is how many of the newest posts of the feed are ranked
+	candidates int
+	// activityWindow is how far back the activity of the reader is considered
+	activityWindow time.Duration
+}
+
+// timelineConfig configures the feed timelines cached in Redis, which are
+// only used when Redis is enabled.
+type timelineConfig struct {
+	enabled bool
+	// maxLen is the number of posts kept per timeline, older pages of the
+	// feed are read from the database
+	maxLen int
+	// ttl is how long the timeline of a user who stopped reading the feed is kept
+	ttl time.Duration
+}
+
+// cacheConfig configures the read-through caches of posts and feed pages,
+// which are only used when Redis is enabled.
+type cacheConfig struct {
+	enabled bool
+	postTTL time.Duration
+	// feedTTL bounds how long the feed pages of followers show outdated
+	// comment counts
+	feedTTL time.Duration
 }
 
 type authConfig struct {
@@ -57,9 +125,23 @@ type authConfig struct {
 
 type tokenConfig struct {
 	secret string
-	exp    time.Duration
+	// exp is the lifetime of access tokens
+	exp time.Duration
+	// refreshExp is the lifetime of refresh tokens
+	refreshExp time.Duration
+	// mfaExp is the lifetime of the token exchanged for a TOTP code at login
+	mfaExp time.Duration
 	aud    string
 	iss    string
+	// keysDir holds PEM encoded RSA/Ed25519 private keys; when set, tokens are
+	// signed asymmetrically instead of with secret
+	keysDir string
+	// activeKID is the id (file name) of the key used for signing
+	activeKID string
+	// retiredKeys lists keys kept for verification only, as kid=RFC3339 pairs
+	retiredKeys string
+	// keyGracePeriod is how long retired keys are still accepted
+	keyGracePeriod time.Duration
 }
 
 type basicConfig struct {
@@ -85,7 +167,38 @@ type application struct {
 	mailer        mailer.Client
 	authenticator auth.Authenticator
 	cacheStorage  cache.Storage
-	rateLimiter   ratelimiter.Limiter
+	rateLimiter   *ratelimiter.Engine
+	loginTracker  ratelimiter.LoginTracker
+	oidcProviders map[string]*auth.OIDCProvider
+	// redisBreaker guards the Redis client, nil when Redis is disabled
+	redisBreaker *breaker.Breaker
+	// revocationsStaleUntil is the unix time in nanoseconds up to which Redis
+	// may miss revocations, see cachedRevocations
+	revocationsStaleUntil atomic.Int64
+	// tasks are the background tasks the server waits for on shutdown
+	tasks sync.WaitGroup
+}
+
+// Rate limit policies declared in mount, which RATE_LIMIT_POLICIES can
+// override by name.
+const (
+	policyDefault       = "default"
+	policyPublic        = "public"
+	policyAuth          = "auth"
+	policyPostsWrite    = "posts-write"
+	policyCommentsWrite = "comments-write"
+	policyFeed          = "feed"
+	policySearch        = "search"
+)
+
+var rateLimitPolicies = []string{
+	policyDefault,
+	policyPublic,
+	policyAuth,
+	policyPostsWrite,
+	policyCommentsWrite,
+	policyFeed,
+	policySearch,
 }
 
 // mount configures and returns the HTTP router with all middleware and routes.
@@ -95,64 +208,166 @@ func (app *application) mount() http.Handler {
 	r := chi.NewRouter()
 
 	// Production-ready middleware stack
-	r.Use(middleware.RequestID)    // Adds unique request ID for tracing
-	r.Use(middleware.RealIP)       // Sets RemoteAddr to real client IP
-	r.Use(middleware.Logger)       // Logs request details
-	r.Use(middleware.Recoverer)    // Recovers from panics and returns 500
-	r.Use(app.rateLimitMiddleware) // Rate limiter
+	r.Use(middleware.RequestID) // Adds unique request ID for tracing
+	r.Use(middleware.RealIP)    // Sets RemoteAddr to real client IP
+	r.Use(middleware.Logger)    // Logs request details
+	r.Use(middleware.Recoverer) // Recovers from panics and returns 500
 	r.Use(cors.Handler(cors.Options{
 		AllowedOrigins:   []string{env.GetString("CORS_ALLOWED_ORIGIN", "*")},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token"},
-		ExposedHeaders:   []string{"Link"},
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Accept", "Authorization", "Content-Type", "X-CSRF-Token", "If-Match", "If-None-Match"},
+		ExposedHeaders:   []string{"Link", "ETag", "RateLimit-Limit", "RateLimit-Remaining", "RateLimit-Reset", "Retry-After"},
 		AllowCredentials: false,
 		MaxAge:           300, // Maximum value not ignored by any of major browsers
 	}))
 
 	r.Use(middleware.Timeout(60 * time.Second))
 
+	// Rate limit policies, which RATE_LIMIT_POLICIES can override by name.
+	// Every authenticated request counts against the default policy.
+	limits := app.config.rateLimiterConfig
+	defaultLimit := app.rateLimit(ratelimiter.Policy{
+		Name: policyDefault, Key: ratelimiter.KeyAPIKey, Limit: limits.RequestsPerTimeFrame, Window: limits.TimeFrame,
+	})
+	// Anonymous routes without a policy of their own share the default limit per IP.
+	publicLimit := app.rateLimit(ratelimiter.Policy{
+		Name: policyPublic, Key: ratelimiter.KeyIP, Limit: limits.RequestsPerTimeFrame, Window: limits.TimeFrame,
+	})
+	authLimit := app.rateLimit(ratelimiter.Policy{
+		Name: policyAuth, Key: ratelimiter.KeyIP, Limit: 10, Window: time.Minute,
+	})
+	postsWriteLimit := app.rateLimit(ratelimiter.Policy{
+		Name: policyPostsWrite, Key: ratelimiter.KeyUser, Limit: 30, Window: time.Hour,
+		Tiers: []ratelimiter.Tier{{Level: 2, Limit: 300}},
+	})
+	commentsWriteLimit := app.rateLimit(ratelimiter.Policy{
+		Name: policyCommentsWrite, Key: ratelimiter.KeyUser, Limit: 60, Window: time.Hour,
+		Tiers: []ratelimiter.Tier{{Level: 2, Limit: 600}},
+	})
+	feedLimit := app.rateLimit(ratelimiter.Policy{
+		Name: policyFeed, Key: ratelimiter.KeyAPIKey, Limit: 60, Window: time.Minute,
+		Tiers: []ratelimiter.Tier{{Level: 3, Limit: 600}},
+	})
+	searchLimit := app.rateLimit(ratelimiter.Policy{
+		Name: policySearch, Key: ratelimiter.KeyAPIKey, Limit: 30, Window: time.Minute,
+	})
+
+	authenticated := func(next http.Handler) http.Handler {
+		return app.AuthTokenMiddleware(defaultLimit(next))
+	}
+
+	// Public keys for services verifying our tokens
+	r.With(publicLimit).Get("/.well-known/jwks.json", app.jwksHandler)
+
 	// API versioning with grouped routes
 	r.Route("/v1", func(r chi.Router) {
 		// Health check endpoints
-		r.With(app.BasicAuthMiddleware()).Get("/health", app.healthcheckHandler)
-		r.With(app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
+		r.With(publicLimit, app.BasicAuthMiddleware()).Get("/health", app.healthcheckHandler)
+		r.With(publicLimit, app.BasicAuthMiddleware()).Get("/debug/vars", expvar.Handler().ServeHTTP)
 
 		// Swagger documentation endpoint
 		docsURL := fmt.Sprintf("%s/swagger/doc.json", app.config.addr)
-		r.Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
+		r.With(publicLimit).Get("/swagger/*", httpSwagger.Handler(httpSwagger.URL(docsURL)))
 
 		r.Route("/posts", func(r chi.Router) {
-			r.Use(app.AuthTokenMiddleware)
-			r.Post("/", app.createPostHandler)
+			r.Use(authenticated)
+			r.With(app.requireScope(scopePostsWrite), postsWriteLimit).Post("/", app.createPostHandler)
 
 			r.Route("/{postID}", func(r chi.Router) {
 				r.Use(app.postsContextMiddleware)
-				r.Get("/", app.getPostHandler)
-				r.Patch("/", app.checkPostOwnership("moderator", app.updatePostHandler))
-				r.Delete("/", app.checkPostOwnership("admin", app.deletePostHandler))
-				r.Post("/comments", app.createCommentHandler)
+				r.With(app.requireScope(scopePostsRead)).Get("/", app.getPostHandler)
+				r.With(app.requireScope(scopePostsWrite)).Patch("/", app.checkPostOwnership(permPostUpdateAny, app.updatePostHandler))
+				r.With(app.requireScope(scopePostsWrite)).Delete("/", app.checkPostOwnership(permPostDeleteAny, app.deletePostHandler))
+				r.With(app.requireScope(scopePostsRead)).Get("/comments", app.getCommentsHandler)
+				r.With(app.requireScope(scopePostsRead)).Get("/revisions", app.checkPostOwnership(permPostUpdateAny, app.listRevisionsHandler))
+				r.With(app.requireScope(scopePostsRead)).Get("/revisions/{version}", app.checkPostOwnership(permPostUpdateAny, app.getRevisionHandler))
+				r.With(app.requireScope(scopeCommentsWrite), commentsWriteLimit).Post("/comments", app.createCommentHandler)
+				r.With(app.requireScope(scopeReactionsWrite)).Put("/reactions/{kind}", app.putReactionHandler)
+				r.With(app.requireScope(scopeReactionsWrite)).Delete("/reactions/{kind}", app.deleteReactionHandler)
+
+				r.Route("/comments/{commentID}", func(r chi.Router) {
+					r.Use(app.commentsContextMiddleware)
+					r.With(app.requireScope(scopeCommentsWrite)).Patch("/", app.checkCommentOwnership(permCommentUpdateAny, app.updateCommentHandler))
+					r.With(app.requireScope(scopeCommentsWrite)).Delete("/", app.checkCommentOwnership(permCommentDeleteAny, app.deleteCommentHandler))
+					r.With(app.requireScope(scopeReactionsWrite)).Put("/reactions/{kind}", app.putCommentReactionHandler)
+					r.With(app.requireScope(scopeReactionsWrite)).Delete("/reactions/{kind}", app.deleteCommentReactionHandler)
+				})
 			})
 		})
 
 		r.Route("/users", func(r chi.Router) {
-			r.Put("/activate/{token}", app.activateUserHandler)
+			r.With(authLimit).Put("/activate/{token}", app.activateUserHandler)
+			r.With(authLimit).Post("/invitations/resend", app.resendInvitationHandler)
+
+			r.Route("/mfa", func(r chi.Router) {
+				r.Use(authenticated, app.requireSession)
+				r.Post("/enroll", app.enrollMFAHandler)
+				r.Post("/verify", app.verifyMFAHandler)
+				r.Delete("/", app.disableMFAHandler)
+			})
 
 			r.Route("/{userID}", func(r chi.Router) {
-				r.Use(app.AuthTokenMiddleware)
+				r.Use(authenticated)
 				//r.Use(app.usersContextMiddleware)
-				r.Get("/", app.getUserHandler)
-				r.Put("/follow", app.followUserHandler)
-				r.Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireScope(scopeUsersRead)).Get("/", app.getUserHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/follow", app.followUserHandler)
+				r.With(app.requireScope(scopeUsersWrite)).Put("/unfollow", app.unfollowUserHandler)
+				r.With(app.requireSession, app.requirePermission(permUserDelete)).Delete("/", app.deleteUserHandler)
+				r.With(app.requireSession, app.requirePermission(permUserUnlock)).Delete("/lockout", app.unlockUserHandler)
+				r.With(app.requireSession, app.requirePermission(permUserMFAReset)).Delete("/mfa", app.resetMFAHandler)
+
+				r.Route("/api-keys", func(r chi.Router) {
+					r.Use(app.requireSession, app.apiKeysOwnerMiddleware)
+					r.Post("/", app.createAPIKeyHandler)
+					r.Get("/", app.listAPIKeysHandler)
+					r.Delete("/{keyID}", app.revokeAPIKeyHandler)
+				})
 			})
 			r.Group(func(r chi.Router) {
-				r.Get("/feed", app.getUserFeedHandler)
+				r.Use(authenticated)
+				r.With(app.requireScope(scopeFeedRead), feedLimit).Get("/feed", app.getUserFeedHandler)
 			})
 		})
 
+		r.With(authenticated, app.requireSearchScope, searchLimit).Get("/search", app.searchHandler)
+
+		r.Route("/roles", func(r chi.Router) {
+			r.Use(authenticated, app.requireSession, app.requirePermission(permRoleManage))
+			r.Get("/", app.listRolesHandler)
+			r.Put("/{roleID}/permissions/{permission}", app.grantPermissionHandler)
+			r.Delete("/{roleID}/permissions/{permission}", app.revokePermissionHandler)
+			r.Put("/{roleID}/mfa", app.setRoleMFAHandler)
+		})
+
+		r.With(authenticated, app.requireSession, app.requirePermission(permRoleManage)).
+			Get("/permissions", app.listPermissionsHandler)
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(authenticated, app.requireSession)
+			r.With(app.requirePermission(permPostRestore)).Put("/posts/{postID}/restore", app.restorePostHandler)
+			r.With(app.requirePermission(permCommentRestore)).Put("/comments/{commentID}/restore", app.restoreCommentHandler)
+			r.With(app.requirePermission(permUserRestore)).Put("/users/{userID}/restore", app.restoreUserHandler)
+		})
+
 		// Public routes
 		r.Route("/authentication", func(r chi.Router) {
-			r.Post("/user", app.registerUserHandler)
-			r.Post("/token", app.createTokenHandler)
+			r.Group(func(r chi.Router) {
+				r.Use(authLimit)
+				r.Post("/user", app.registerUserHandler)
+				r.Post("/token", app.createTokenHandler)
+				r.Post("/mfa", app.mfaLoginHandler)
+				r.Post("/refresh", app.refreshTokenHandler)
+				r.Post("/password/forgot", app.forgotPasswordHandler)
+				r.Post("/password/reset", app.resetPasswordHandler)
+				r.Get("/oidc/{provider}/start", app.oidcStartHandler)
+				r.Get("/oidc/{provider}/callback", app.oidcCallbackHandler)
+			})
+
+			r.Group(func(r chi.Router) {
+				r.Use(authenticated, app.requireSession)
+				r.Post("/logout", app.logoutHandler)
+				r.Post("/logout/all", app.logoutAllHandler)
+			})
 		})
 	})
 
@@ -0,0 +1,242 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+)
+
+const (
+	apiKeyCtx       contextKey = "apiKey"
+	apiKeysOwnerCtx contextKey = "apiKeysOwner"
+)
+
+// apiKeyPrefix starts every API key so that leaked keys are easy to recognise
+const apiKeyPrefix = "gms_"
+
+// Scopes an API key can be granted. Requests authenticated with a JWT are not
+// restricted by scopes.
+const (
+	scopePostsRead      = "posts:read"
+	scopePostsWrite     = "posts:write"
+	scopeCommentsWrite  = "comments:write"
+	scopeUsersRead      = "users:read"
+	scopeUsersWrite     = "users:write"
+	scopeFeedRead       = "feed:read"
+	scopeReactionsWrite = "reactions:write"
+)
+
+var apiKeyScopes = []string{
+	scopePostsRead,
+	scopePostsWrite,
+	scopeCommentsWrite,
+	scopeUsersRead,
+	scopeUsersWrite,
+	scopeFeedRead,
+	scopeReactionsWrite,
+}
+
+type CreateAPIKeyPayload struct {
+	Name   string   `json:"name" validate:"required,max=100"`
+	Scopes []string `json:"scopes" validate:"required,min=1,dive,required"`
+	// Lifetime of the key in days, the key never expires if omitted
+	ExpiresInDays int `json:"expires_in_days" validate:"omitempty,min=1,max=365"`
+}
+
+// APIKeyWithSecret is returned once when a key is created
+//
+//	@Description	Created API key together with the key itself, which cannot be retrieved again
+type APIKeyWithSecret struct {
+	*repo.APIKey
+
+	// Send as "Authorization: ApiKey <key>"
+	Secret string `json:"key" example:"gms_3kT9x..."`
+}
+
+// createAPIKeyHandler godoc
+//
+//	@Summary		Creates an API key
+//	@Description	Creates an API key for the authenticated user restricted to the given scopes
+//	@Description	(posts:read, posts:write, comments:write, users:read, users:write, feed:read, reactions:write).
+//	@Description	The key is only returned in this response.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			userID	path		int64				true	"User ID"
+//	@Param			payload	body		CreateAPIKeyPayload	true	"Key name and scopes"
+//	@Success		201		{object}	APIKeyWithSecret
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/users/{userID}/api-keys [post]
+func (app *application) createAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	// keys can only be created for oneself, others may at most list and revoke them
+	if getAPIKeysOwnerID(r) != user.ID {
+		app.forbiddenResponse(w, r)
+		return
+	}
+
+	var payload CreateAPIKeyPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	for _, scope := range payload.Scopes {
+		if !slices.Contains(apiKeyScopes, scope) {
+			app.badRequestResponse(w, r, errors.New("unknown scope "+scope))
+			return
+		}
+	}
+
+	secret, err := generateAPIKey()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	key := &repo.APIKey{
+		Key:    hashToken(secret),
+		Prefix: secret[:len(apiKeyPrefix)+4],
+		Name:   payload.Name,
+		Scopes: slices.Compact(slices.Sorted(slices.Values(payload.Scopes))),
+		UserID: user.ID,
+	}
+
+	if payload.ExpiresInDays > 0 {
+		expiry := time.Now().AddDate(0, 0, payload.ExpiresInDays)
+		key.Expiry = &expiry
+	}
+
+	if err := app.repo.APIKeys.Create(r.Context(), key); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Info("api key created", "user_id", user.ID, "key_id", key.ID, "scopes", key.Scopes)
+
+	if err := app.jsonResponse(w, http.StatusCreated, APIKeyWithSecret{APIKey: key, Secret: secret}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listAPIKeysHandler godoc
+//
+//	@Summary		Lists API keys
+//	@Description	Lists the active API keys of a user. Requires apikey.manage.any for other users.
+//	@Tags			users
+//	@Produce		json
+//	@Param			userID	path		int64	true	"User ID"
+//	@Success		200		{array}		repo.APIKey
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/users/{userID}/api-keys [get]
+func (app *application) listAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	keys, err := app.repo.APIKeys.GetByUserID(r.Context(), getAPIKeysOwnerID(r))
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, keys); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// revokeAPIKeyHandler godoc
+//
+//	@Summary		Revokes an API key
+//	@Description	Revokes an API key of a user. Requires apikey.manage.any for other users.
+//	@Tags			users
+//	@Param			userID	path	int64	true	"User ID"
+//	@Param			keyID	path	int64	true	"API key ID"
+//	@Success		204		"API key revoked"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/users/{userID}/api-keys/{keyID} [delete]
+func (app *application) revokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	keyID, err := strconv.ParseInt(chi.URLParam(r, "keyID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ownerID := getAPIKeysOwnerID(r)
+
+	if err := app.repo.APIKeys.Revoke(r.Context(), ownerID, keyID); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("api key revoked", "user_id", ownerID, "key_id", keyID, "by", getUserFromContext(r).ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// apiKeysOwnerMiddleware lets users manage their own API keys, and users with
+// the apikey.manage.any permission those of everybody.
+func (app *application) apiKeysOwnerMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ownerID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		user := getUserFromContext(r)
+		if ownerID != user.ID && !app.checkPermission(user, permAPIKeyManageAny) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), apiKeysOwnerCtx, ownerID)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// generateAPIKey returns a new random API key.
+func generateAPIKey() (string, error) {
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+func getAPIKeysOwnerID(r *http.Request) int64 {
+	ownerID, _ := r.Context().Value(apiKeysOwnerCtx).(int64)
+	return ownerID
+}
+
+// getAPIKeyFromCtx returns the API key the request was authenticated with, or
+// nil for requests authenticated with a JWT.
+func getAPIKeyFromCtx(r *http.Request) *repo.APIKey {
+	key, _ := r.Context().Value(apiKeyCtx).(*repo.APIKey)
+	return key
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"net/http"
+	"testing"
+)
+
+func TestAPIKeyAuth(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	keys := app.repo.APIKeys.(*repo.MockAPIKeyStore)
+
+	newRequest := func(t *testing.T, method, path string) *http.Request {
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "ApiKey gms_test")
+		return req
+	}
+
+	t.Run("should allow a key with the required scope", func(t *testing.T) {
+		keys.Scopes = []string{scopeUsersRead}
+
+		rr := executeRequest(newRequest(t, http.MethodGet, "/v1/users/1"), mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+	})
+
+	t.Run("should forbid a key without the required scope", func(t *testing.T) {
+		keys.Scopes = []string{scopeFeedRead}
+
+		rr := executeRequest(newRequest(t, http.MethodGet, "/v1/users/1"), mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+
+	t.Run("should not let keys manage api keys", func(t *testing.T) {
+		keys.Scopes = apiKeyScopes
+
+		rr := executeRequest(newRequest(t, http.MethodGet, "/v1/users/1/api-keys"), mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
@@ -1,13 +1,19 @@
 package main
 
 import (
+	"Go-Microservice/internal/auth"
 	"Go-Microservice/internal/mailer"
 	"Go-Microservice/internal/repo"
+	"context"
 	"crypto/sha256"
 	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
@@ -31,6 +37,31 @@ type CreateUserTokenPayload struct {
 	Password string `json:"password" validate:"required,min=3,max=72"`
 }
 
+const tokenClaimsCtx contextKey = "claims"
+
+type RefreshTokenPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"required,max=255"`
+}
+
+// TokenPair is returned by the authentication endpoints
+//
+//	@Description	Short-lived access token together with a single-use refresh token
+type TokenPair struct {
+	// Bearer token to send in the Authorization header
+	AccessToken string `json:"access_token"`
+
+	// Opaque token to exchange for a new pair at /authentication/refresh
+	RefreshToken string `json:"refresh_token"`
+
+	// Always "Bearer"
+	//	@example	Bearer
+	TokenType string `json:"token_type" example:"Bearer"`
+
+	// Lifetime of the access token in seconds
+	//	@example	900
+	ExpiresIn int64 `json:"expires_in" example:"900"`
+}
+
 // registerUserHandler godoc
 //
 //	@Summary		Registers a user
@@ -72,10 +103,7 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	plainToken := uuid.New().String()
 
 	// hash the token for storage but keep the plain token for email
-	hash := sha256.Sum256([]byte(plainToken))
-	hashToken := hex.EncodeToString(hash[:])
-
-	err := app.repo.Users.CreateAndInvite(ctx, user, hashToken, app.config.invitationExpTime)
+	err := app.repo.Users.CreateAndInvite(ctx, user, hashToken(plainToken), app.config.invitationExpTime)
 	if err != nil {
 		switch {
 		case errors.Is(err, repo.ErrDuplicateEmail):
@@ -93,25 +121,13 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 		Token: plainToken,
 	}
 
-	activationURL := fmt.Sprintf("http://localhost:8000/v1/users/activate/%s", plainToken)
-
-	isProdEnv := app.config.env == "development"
-
-	vars := struct {
-		Username      string
-		ActivationURL string
-	}{
-		Username:      user.Username,
-		ActivationURL: activationURL,
-	}
-
 	// send mail
-	status, err := app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, !isProdEnv)
+	status, err := app.sendInvitation(user, plainToken)
 	if err != nil {
 		app.logger.Error("error sending welcome email", "error", err)
 
 		// rollback user creation if email fails (SAGA pattern)
-		if err := app.repo.Users.Delete(ctx, user.ID); err != nil {
+		if err := app.repo.Users.Purge(ctx, user.ID); err != nil {
 			app.logger.Error("error deleting user", "error", err)
 		}
 
@@ -126,17 +142,35 @@ func (app *application) registerUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+// sendInvitation emails the activation link of the invitation token to user.
+func (app *application) sendInvitation(user *repo.User, plainToken string) (int, error) {
+	isSandbox := app.config.env != "development"
+
+	vars := struct {
+		Username      string
+		ActivationURL string
+	}{
+		Username:      user.Username,
+		ActivationURL: fmt.Sprintf("%s/confirm/%s", app.config.frontendURL, plainToken),
+	}
+
+	return app.mailer.Send(mailer.UserWelcomeTemplate, user.Username, user.Email, vars, isSandbox)
+}
+
 // createTokenHandler godoc
 //
 //	@Summary		Creates a token
-//	@Description	Creates a token for a user
+//	@Description	Creates a short-lived access token and a refresh token for a user. Users with MFA
+//	@Description	enabled receive an MFA token instead, to be exchanged at /authentication/mfa.
 //	@Tags			authentication
 //	@Accept			json
 //	@Produce		json
 //	@Param			payload	body		CreateUserTokenPayload	true	"User credentials"
-//	@Success		200		{string}	string					"Token"
+//	@Success		201		{object}	TokenPair				"Token pair"
+//	@Success		202		{object}	MFAChallenge			"Second factor required"
 //	@Failure		400		{object}	error
 //	@Failure		401		{object}	error
+//	@Failure		429		{object}	error	"Too many failed attempts for this account"
 //	@Failure		500		{object}	error
 //	@Router			/authentication/token [post]
 func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Request) {
@@ -151,10 +185,28 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	user, err := app.repo.Users.GetByEmail(r.Context(), payload.Email)
+	ctx := r.Context()
+	attemptsKey := strings.ToLower(payload.Email)
+
+	if app.config.loginLockout.Enabled {
+		status, err := app.loginTracker.Check(ctx, attemptsKey)
+		if err != nil {
+			// Fail open - the IP based rate limiter still applies
+			app.logger.Warn("failed to check login attempts", "error", err)
+		} else if status.Blocked() {
+			app.logger.Warn("login attempt blocked", "locked", status.Locked, "failures", status.Failures)
+			app.rateLimitExceededResponse(w, r, retryAfterSeconds(status.RetryAfter))
+			return
+		}
+	}
+
+	user, err := app.repo.Users.GetByEmail(ctx, payload.Email)
 	if err != nil {
 		switch {
 		case errors.Is(err, repo.ErrNotFound):
+			// unknown emails are throttled too, so that a lockout doesn't
+			// reveal whether the account exists
+			app.recordFailedLogin(ctx, attemptsKey, nil)
 			app.unauthorizedErrorResponse(w, r, err)
 		default:
 			app.internalServerError(w, r, err)
@@ -163,26 +215,465 @@ func (app *application) createTokenHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	if err := user.Password.Compare(payload.Password); err != nil {
+		app.recordFailedLogin(ctx, attemptsKey, user)
 		app.unauthorizedErrorResponse(w, r, err)
 		return
 	}
 
-	claims := jwt.MapClaims{
-		"sub": user.ID,
-		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
-		"iat": time.Now().Unix(),
-		"nbf": time.Now().Unix(),
-		"iss": app.config.auth.token.iss,
-		"aud": app.config.auth.token.aud,
+	// failed attempts are only forgiven once the second factor is passed too
+	if user.MFAEnabled {
+		challenge, err := app.newMFAChallenge(user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.resetFailedLogins(ctx, attemptsKey)
+
+	tokens, err := app.newTokenPair(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// recordFailedLogin counts a failed login for the account and notifies the
+// user by email when the failure locks the account.
+func (app *application) recordFailedLogin(ctx context.Context, attemptsKey string, user *repo.User) {
+	if !app.config.loginLockout.Enabled {
+		return
+	}
+
+	status, err := app.loginTracker.RecordFailure(ctx, attemptsKey)
+	if err != nil {
+		app.logger.Warn("failed to record login attempt", "error", err)
+		return
+	}
+
+	// only notify on the failure that locks the account
+	if user == nil || !status.Locked || status.Failures != app.config.loginLockout.MaxAttempts {
+		return
+	}
+
+	app.logger.Warn("account locked after failed logins", "user_id", user.ID, "failures", status.Failures)
+
+	isSandbox := app.config.env != "development"
+
+	vars := struct {
+		Username  string
+		Failures  int
+		LockedFor string
+		ResetURL  string
+	}{
+		Username:  user.Username,
+		Failures:  status.Failures,
+		LockedFor: app.config.loginLockout.LockoutDuration.String(),
+		ResetURL:  fmt.Sprintf("%s/password/forgot", app.config.frontendURL),
+	}
+
+	if _, err := app.mailer.Send(mailer.AccountLockedTemplate, user.Username, user.Email, vars, isSandbox); err != nil {
+		app.logger.Error("error sending account locked email", "error", err)
+	}
+}
+
+func (app *application) resetFailedLogins(ctx context.Context, attemptsKey string) {
+	if !app.config.loginLockout.Enabled {
+		return
+	}
+
+	if err := app.loginTracker.Reset(ctx, attemptsKey); err != nil {
+		app.logger.Warn("failed to reset login attempts", "error", err)
+	}
+}
+
+// retryAfterSeconds formats d as the whole seconds of a Retry-After or
+// RateLimit-Reset header, rounded up.
+func retryAfterSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
+
+// refreshTokenHandler godoc
+//
+//	@Summary		Refreshes a token
+//	@Description	Exchanges a refresh token for a new access/refresh token pair. Every refresh token
+//	@Description	can be used once; presenting an already rotated token revokes all tokens derived from the same login.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		RefreshTokenPayload	true	"Refresh token"
+//	@Success		200		{object}	TokenPair			"New token pair"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/refresh [post]
+func (app *application) refreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	var payload RefreshTokenPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	plainToken := uuid.New().String()
+	next := &repo.RefreshToken{
+		Token:  hashToken(plainToken),
+		Expiry: time.Now().Add(app.config.auth.token.refreshExp),
+	}
+
+	err := app.repo.RefreshTokens.Rotate(ctx, hashToken(payload.RefreshToken), next)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrRefreshTokenReused):
+			app.logger.Warn("refresh token reuse detected, token family revoked",
+				"remote_addr", r.RemoteAddr)
+			app.unauthorizedErrorResponse(w, r, err)
+		case errors.Is(err, repo.ErrNotFound):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if _, err := app.repo.Users.GetByID(ctx, next.UserID); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.unauthorizedErrorResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	accessToken, err := app.generateAccessToken(next.UserID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	tokens := TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: plainToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+type LogoutPayload struct {
+	RefreshToken string `json:"refresh_token" validate:"omitempty,max=255"`
+}
+
+// logoutHandler godoc
+//
+//	@Summary		Logs out the current session
+//	@Description	Revokes the access token used for the request. When a refresh token is sent,
+//	@Description	it is revoked together with every token rotated from the same login.
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body	LogoutPayload	false	"Refresh token of the session"
+//	@Success		204		"Logged out"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout [post]
+func (app *application) logoutHandler(w http.ResponseWriter, r *http.Request) {
+	var payload LogoutPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+	claims := getTokenClaimsFromCtx(r)
+
+	if jti, _ := claims["jti"].(string); jti != "" {
+		exp, err := claims.GetExpirationTime()
+		if err != nil || exp == nil {
+			app.badRequestResponse(w, r, fmt.Errorf("token has no expiration"))
+			return
+		}
+
+		if err := app.revocations().Revoke(ctx, jti, exp.Time); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	if payload.RefreshToken != "" {
+		if err := app.repo.RefreshTokens.RevokeFamily(ctx, hashToken(payload.RefreshToken)); err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// logoutAllHandler godoc
+//
+//	@Summary		Logs out all sessions
+//	@Description	Revokes every access and refresh token issued to the authenticated user
+//	@Tags			authentication
+//	@Success		204	"Logged out everywhere"
+//	@Failure		401	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/authentication/logout/all [post]
+func (app *application) logoutAllHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	if err := app.revokeUserSessions(r.Context(), user.ID); err != nil {
+		app.internalServerError(w, r, err)
+		return
 	}
 
-	token, err := app.authenticator.GenerateToken(claims)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// revokeUserSessions invalidates every token issued to the user so far: refresh
+// tokens are revoked in the database and access tokens through the revocation list.
+func (app *application) revokeUserSessions(ctx context.Context, userID int64) error {
+	if err := app.repo.RefreshTokens.RevokeAllForUser(ctx, userID); err != nil {
+		return err
+	}
+
+	return app.revocations().RevokeAllForUser(ctx, userID, time.Now().Add(app.config.auth.token.exp))
+}
+
+type ForgotPasswordPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+type ResetPasswordPayload struct {
+	Token    string `json:"token" validate:"required,max=255"`
+	Password string `json:"password" validate:"required,min=3,max=72"`
+}
+
+// forgotPasswordHandler godoc
+//
+//	@Summary		Requests a password reset
+//	@Description	Emails a single-use password reset link to the user. The response is the same
+//	@Description	whether or not an account exists for the email address.
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body	ForgotPasswordPayload	true	"Account email"
+//	@Success		202		"Reset email sent if the account exists"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/authentication/password/forgot [post]
+func (app *application) forgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ForgotPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the account is looked up after responding, so that the response time
+	// doesn't reveal whether it exists
+	ctx := context.WithoutCancel(r.Context())
+	app.background(func() {
+		app.sendPasswordReset(ctx, payload.Email)
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// sendPasswordReset emails a password reset link to the user with the email,
+// if any. Failures are logged, the request was answered already.
+func (app *application) sendPasswordReset(ctx context.Context, email string) {
+	user, err := app.repo.Users.GetByEmail(ctx, email)
 	if err != nil {
+		if !errors.Is(err, repo.ErrNotFound) {
+			app.logger.Error("failed to get user for password reset", "error", err)
+		}
+		return
+	}
+
+	plainToken := uuid.New().String()
+
+	err = app.repo.Users.CreatePasswordReset(ctx, user.ID, hashToken(plainToken), app.config.passwordResetExpTime)
+	if err != nil {
+		app.logger.Error("failed to create password reset", "user_id", user.ID, "error", err)
+		return
+	}
+
+	isSandbox := app.config.env != "development"
+
+	vars := struct {
+		Username  string
+		ResetURL  string
+		ExpiresIn string
+	}{
+		Username:  user.Username,
+		ResetURL:  fmt.Sprintf("%s/password/reset/%s", app.config.frontendURL, plainToken),
+		ExpiresIn: app.config.passwordResetExpTime.String(),
+	}
+
+	status, err := app.mailer.Send(mailer.PasswordResetTemplate, user.Username, user.Email, vars, isSandbox)
+	if err != nil {
+		app.logger.Error("error sending password reset email", "error", err)
+	} else {
+		app.logger.Info("Email sent", "status code", status)
+	}
+}
+
+// resetPasswordHandler godoc
+//
+//	@Summary		Resets a password
+//	@Description	Sets a new password using a token from the reset email. The token can be used once,
+//	@Description	and every session of the user is revoked afterwards.
+//	@Tags			authentication
+//	@Accept			json
+//	@Param			payload	body	ResetPasswordPayload	true	"Reset token and new password"
+//	@Success		204		"Password changed"
+//	@Failure		400		{object}	error
+//	@Failure		404		{object}	error	"Unknown or expired token"
+//	@Failure		500		{object}	error
+//	@Router			/authentication/password/reset [post]
+func (app *application) resetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResetPasswordPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	userID, err := app.repo.Users.ResetPassword(ctx, hashToken(payload.Token), payload.Password)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.revokeUserSessions(ctx, userID); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
+	if app.config.redisConfig.enabled {
+		// the cached user holds the old password hash
+		app.cacheStorage.Users.Delete(ctx, userID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// jwksHandler godoc
+//
+//	@Summary		Lists token verification keys
+//	@Description	Publishes the public keys used to sign access tokens as a JWK set (RFC 7517).
+//	@Description	The set is empty when tokens are signed with a shared secret.
+//	@Tags			authentication
+//	@Produce		json
+//	@Success		200	{object}	auth.JWKSet
+//	@Router			/.well-known/jwks.json [get]
+func (app *application) jwksHandler(w http.ResponseWriter, r *http.Request) {
+	set := auth.JWKSet{Keys: []auth.JWK{}}
+	if publisher, ok := app.authenticator.(auth.KeyPublisher); ok {
+		set = publisher.JWKS()
+	}
 
-	if err := app.jsonResponse(w, http.StatusCreated, token); err != nil {
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := writeJSON(w, http.StatusOK, set); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+// newTokenPair issues an access token and a refresh token that starts a new
+// token family, e.g. after a successful password login.
+func (app *application) newTokenPair(ctx context.Context, userID int64) (*TokenPair, error) {
+	accessToken, err := app.generateAccessToken(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	plainToken := uuid.New().String()
+	refreshToken := &repo.RefreshToken{
+		Token:    hashToken(plainToken),
+		UserID:   userID,
+		FamilyID: uuid.New().String(),
+		Expiry:   time.Now().Add(app.config.auth.token.refreshExp),
+	}
+
+	if err := app.repo.RefreshTokens.Create(ctx, refreshToken); err != nil {
+		return nil, err
+	}
+
+	return &TokenPair{
+		AccessToken:  accessToken,
+		RefreshToken: plainToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(app.config.auth.token.exp.Seconds()),
+	}, nil
+}
+
+func (app *application) generateAccessToken(userID int64) (string, error) {
+	claims := jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"sub": userID,
+		"exp": time.Now().Add(app.config.auth.token.exp).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.aud,
+	}
+
+	return app.authenticator.GenerateToken(claims)
+}
+
+// hashToken returns the hex encoded SHA-256 of a token, the form in which
+// invitation and refresh tokens are stored.
+func hashToken(token string) string {
+	hash := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(hash[:])
+}
+
+// subjectFromClaims returns the user ID of the sub claim.
+func subjectFromClaims(claims jwt.MapClaims) (int64, error) {
+	return strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+}
+
+func getTokenClaimsFromCtx(r *http.Request) jwt.MapClaims {
+	claims, _ := r.Context().Value(tokenClaimsCtx).(jwt.MapClaims)
+	return claims
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"Go-Microservice/internal/breaker"
+	"Go-Microservice/internal/mailer"
+	"Go-Microservice/internal/repo"
+	"Go-Microservice/internal/repo/cache"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+	"github.com/stretchr/testify/mock"
+)
+
+func TestRefreshToken(t *testing.T) {
+	cfg := config{
+		auth: authConfig{
+			token: tokenConfig{
+				exp:        time.Minute * 15,
+				refreshExp: time.Hour,
+			},
+		},
+	}
+
+	app := newTestApplication(t, cfg)
+	mux := app.mount()
+
+	t.Run("should reject a request without a refresh token", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/refresh", strings.NewReader(`{}`))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+
+	t.Run("should rotate a valid refresh token", func(t *testing.T) {
+		body := `{"refresh_token": "0b7f4c52-1f0e-4b8e-9d43-5f4c8e2a1d6b"}`
+		req, err := http.NewRequest(http.MethodPost, "/v1/authentication/refresh", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var resp struct {
+			Data TokenPair `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&resp); err != nil {
+			t.Fatal(err)
+		}
+
+		if resp.Data.AccessToken == "" || resp.Data.RefreshToken == "" {
+			t.Errorf("Expected a new token pair. Got %+v", resp.Data)
+		}
+
+		if resp.Data.ExpiresIn != 900 {
+			t.Errorf("Expected expires_in 900. Got %d", resp.Data.ExpiresIn)
+		}
+	})
+}
+
+func TestRevokedToken(t *testing.T) {
+	withRedis := config{
+		redisConfig: redisConfig{
+			enabled: true,
+		},
+	}
+
+	app := newTestApplication(t, withRedis)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should reject a revoked token", func(t *testing.T) {
+		revocations := &cache.MockRevocationStore{}
+		revocations.On("IsRevoked", mock.Anything, int64(1), mock.Anything).Return(true, nil)
+		app.cacheStorage.Revocations = revocations
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusUnauthorized, rr.Code)
+
+		revocations.AssertNumberOfCalls(t, "IsRevoked", 1)
+	})
+	t.Run("should reject tokens logged out while Redis was unavailable", func(t *testing.T) {
+		app := newTestApplication(t, config{
+			redisConfig: redisConfig{enabled: true},
+			auth:        authConfig{token: tokenConfig{exp: time.Minute * 15}},
+		})
+		mux := app.mount()
+
+		users := app.cacheStorage.Users.(*cache.MockUserStore)
+		users.On("Get", mock.Anything).Return(nil, nil)
+		users.On("Set", mock.Anything).Return(nil)
+
+		// Redis drops the revocation, and then recovers without it
+		revocations := &cache.MockRevocationStore{}
+		revocations.On("Revoke", mock.Anything, mock.Anything).Return(breaker.ErrOpen)
+		revocations.On("IsRevoked", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+		revocations.On("Import", mock.Anything).Return(nil)
+		app.cacheStorage.Revocations = revocations
+
+		app.redisBreaker = breaker.New(breaker.Config{Failures: 1}, app.redisBreakerChanged)
+		app.redisBreaker.Allow()
+		app.redisBreaker.Done(true)
+
+		token, err := app.generateAccessToken(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		request := func(method, path string) int {
+			req, err := http.NewRequest(method, path, strings.NewReader(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return executeRequest(req, mux).Code
+		}
+
+		checkResponseCode(t, http.StatusNoContent, request(http.MethodPost, "/v1/authentication/logout"))
+		// only closing the breaker may catch the missed revocation
+		app.revocationsStaleUntil.Store(0)
+
+		// the probe succeeds after the cooldown
+		app.redisBreaker.Allow()
+		app.redisBreaker.Done(false)
+		if state := app.redisBreaker.State(); state != breaker.Closed {
+			t.Fatalf("breaker %s, want closed", state)
+		}
+
+		checkResponseCode(t, http.StatusUnauthorized, request(http.MethodGet, "/v1/users/1"))
+	})
+	t.Run("should accept a token issued right after logging out all sessions", func(t *testing.T) {
+		app := newTestApplication(t, config{
+			auth: authConfig{token: tokenConfig{exp: time.Minute * 15}},
+		})
+		mux := app.mount()
+
+		request := func(token, method, path string) int {
+			req, err := http.NewRequest(method, path, strings.NewReader(""))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+token)
+			return executeRequest(req, mux).Code
+		}
+
+		before, err := app.authenticator.GenerateToken(jwt.MapClaims{
+			"jti": uuid.New().String(),
+			"sub": int64(1),
+			"exp": time.Now().Add(time.Minute).Unix(),
+			"iat": time.Now().Add(-time.Second).Unix(),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		checkResponseCode(t, http.StatusNoContent, request(before, http.MethodPost, "/v1/authentication/logout/all"))
+
+		// issued within the same second as the logout
+		after, err := app.generateAccessToken(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		checkResponseCode(t, http.StatusUnauthorized, request(before, http.MethodGet, "/v1/users/1"))
+		checkResponseCode(t, http.StatusOK, request(after, http.MethodGet, "/v1/users/1"))
+	})
+}
+
+// passwordResetUsers knows a single user, and keeps the password resets
+// created for it until they are used.
+type passwordResetUsers struct {
+	repo.MockUserStore
+	mu     sync.Mutex
+	resets map[string]time.Time
+}
+
+func (s *passwordResetUsers) GetByEmail(ctx context.Context, email string) (*repo.User, error) {
+	if email != "gopher@example.com" {
+		return nil, fmt.Errorf("%w: user", repo.ErrNotFound)
+	}
+	return &repo.User{ID: 1, Username: "gopher", Email: email}, nil
+}
+
+func (s *passwordResetUsers) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.resets[token] = time.Now().Add(exp)
+	return nil
+}
+
+func (s *passwordResetUsers) ResetPassword(ctx context.Context, token string, newPassword string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	expiry, ok := s.resets[token]
+	if !ok || time.Now().After(expiry) {
+		return 0, fmt.Errorf("%w: password reset", repo.ErrNotFound)
+	}
+	delete(s.resets, token)
+	return 1, nil
+}
+
+func TestPasswordReset(t *testing.T) {
+	newApp := func(t *testing.T, resetExp time.Duration) (*application, http.Handler, *mailer.MockMailer) {
+		app := newTestApplication(t, config{
+			passwordResetExpTime: resetExp,
+			auth:                 authConfig{token: tokenConfig{exp: time.Minute * 15}},
+		})
+		app.repo.Users = &passwordResetUsers{resets: map[string]time.Time{}}
+		return app, app.mount(), app.mailer.(*mailer.MockMailer)
+	}
+
+	post := func(t *testing.T, mux http.Handler, path, body string) int {
+		req, err := http.NewRequest(http.MethodPost, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return executeRequest(req, mux).Code
+	}
+
+	// forgot requests a reset for email and returns the token that was mailed
+	forgot := func(t *testing.T, app *application, mux http.Handler, mails *mailer.MockMailer, email string) string {
+		t.Helper()
+
+		sent := len(mails.Sent())
+		checkResponseCode(t, http.StatusAccepted, post(t, mux, "/v1/authentication/password/forgot", fmt.Sprintf(`{"email": %q}`, email)))
+		app.tasks.Wait()
+
+		messages := mails.Sent()[sent:]
+		if len(messages) == 0 {
+			return ""
+		}
+
+		var vars struct{ ResetURL string }
+		data, _ := json.Marshal(messages[0].Data)
+		if err := json.Unmarshal(data, &vars); err != nil {
+			t.Fatal(err)
+		}
+		return vars.ResetURL[strings.LastIndex(vars.ResetURL, "/")+1:]
+	}
+
+	reset := func(t *testing.T, mux http.Handler, token string) int {
+		return post(t, mux, "/v1/authentication/password/reset", fmt.Sprintf(`{"token": %q, "password": "new-password"}`, token))
+	}
+
+	t.Run("should email a reset link to an existing account", func(t *testing.T) {
+		app, mux, mails := newApp(t, time.Hour)
+
+		if token := forgot(t, app, mux, mails, "gopher@example.com"); token == "" {
+			t.Fatal("no reset email sent")
+		}
+		if sent := mails.Sent(); sent[0].Template != mailer.PasswordResetTemplate || sent[0].Email != "gopher@example.com" {
+			t.Errorf("sent %+v", sent[0])
+		}
+	})
+
+	t.Run("should accept an unknown email without sending anything", func(t *testing.T) {
+		app, mux, mails := newApp(t, time.Hour)
+
+		if token := forgot(t, app, mux, mails, "nobody@example.com"); token != "" {
+			t.Error("sent a reset email for an unknown account")
+		}
+	})
+
+	t.Run("should reset the password once", func(t *testing.T) {
+		app, mux, mails := newApp(t, time.Hour)
+		token := forgot(t, app, mux, mails, "gopher@example.com")
+
+		checkResponseCode(t, http.StatusNoContent, reset(t, mux, token))
+		checkResponseCode(t, http.StatusNotFound, reset(t, mux, token))
+	})
+
+	t.Run("should reject an unknown token", func(t *testing.T) {
+		_, mux, _ := newApp(t, time.Hour)
+
+		checkResponseCode(t, http.StatusNotFound, reset(t, mux, "0b7f4c52-1f0e-4b8e-9d43-5f4c8e2a1d6b"))
+	})
+
+	t.Run("should reject an expired token", func(t *testing.T) {
+		app, mux, mails := newApp(t, -time.Minute)
+		token := forgot(t, app, mux, mails, "gopher@example.com")
+
+		checkResponseCode(t, http.StatusNotFound, reset(t, mux, token))
+	})
+
+	t.Run("should drop the cached user after a reset", func(t *testing.T) {
+		app, mux, mails := newApp(t, time.Hour)
+		app.config.redisConfig.enabled = true
+		token := forgot(t, app, mux, mails, "gopher@example.com")
+
+		revocations := app.cacheStorage.Revocations.(*cache.MockRevocationStore)
+		revocations.On("RevokeAllForUser", int64(1), mock.Anything).Return(nil)
+		users := app.cacheStorage.Users.(*cache.MockUserStore)
+		users.On("Delete", int64(1)).Return()
+
+		checkResponseCode(t, http.StatusNoContent, reset(t, mux, token))
+		users.AssertCalled(t, "Delete", int64(1))
+	})
+}
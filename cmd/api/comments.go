@@ -2,9 +2,26 @@ package main
 
 import (
 	"Go-Microservice/internal/repo"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 )
 
+const commentCtx contextKey = "comment"
+
+// embeddedComments caps the top-level comments embedded in a post, the rest
+// are paged with getCommentsHandler.
+const embeddedComments = 20
+
+// CommentsResponse is a page of comments
+//
+//	@Description	Page of comments with their replies and the cursor of the next page, which is omitted on the last page
+type CommentsResponse struct {
+	Data       []repo.Comment `json:"data"`
+	NextCursor string         `json:"next_cursor,omitempty"`
+}
+
 // CreateCommentPayload represents the request payload for creating a comment
 //
 //	@Description	Request payload for creating a new comment
@@ -13,32 +30,36 @@ type CreateCommentPayload struct {
 	//	@example	"This is a great post!"
 	Content string `json:"content" validate:"required,min=1,max=500" example:"This is a great post!"`
 
-	// ID of the user creating the comment
-	//	@example	1
-	UserID int64 `json:"user_id" validate:"required" example:"1"`
+	// ID of the comment to reply to
+	//	@example	3
+	ParentID *int64 `json:"parent_id" validate:"omitempty,gt=0" example:"3"`
 
-	// No. of likes
-	//	@example	5
+	// Deprecated: ignored, comments are liked with reactions instead
 	Likes int `json:"likes"`
+
+	// Deprecated: ignored, the author is the authenticated user
+	UserID int64 `json:"user_id"`
 }
 
 // CreateComment adds a new comment to a specific post
 //
 //	@Summary		Create a comment on a post
-//	@Description	Add a new comment to an existing post with the provided content and user information
+//	@Description	Add a new comment of the authenticated user to an existing post, or a reply to a comment
+//	@Description	on the post if parent_id is set
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
 //	@Param			postID	path		int64					true	"Post ID to comment on"
 //	@Param			comment	body		CreateCommentPayload	true	"Comment creation payload"
 //	@Success		201		{object}	repo.Comment			"Comment created successfully"
-//	@Failure		400		{object}	map[string]string		"Invalid request payload or post ID"
+//	@Failure		400		{object}	map[string]string		"Invalid request payload, post ID or parent comment"
 //	@Failure		404		{object}	map[string]string		"Post not found"
 //	@Failure		422		{object}	map[string]string		"Validation failed for comment data"
 //	@Failure		500		{object}	map[string]string		"Internal server error"
 //	@Router			/v1/posts/{postID}/comments [post]
 func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
+	user := getUserFromContext(r)
 
 	var payload CreateCommentPayload
 	if err := readJSON(w, r, &payload); err != nil {
@@ -52,13 +73,19 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 	}
 
 	comment := &repo.Comment{
-		PostID:  post.ID,
-		UserID:  payload.UserID,
-		Content: payload.Content,
+		PostID:   post.ID,
+		UserID:   user.ID,
+		Content:  payload.Content,
+		ParentID: payload.ParentID,
 	}
 
 	if err := app.repo.Comments.Create(r.Context(), comment); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, repo.ErrParentNotFound):
+			app.badRequestResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
@@ -67,3 +94,218 @@ func (app *application) createCommentHandler(w http.ResponseWriter, r *http.Requ
 		return
 	}
 }
+
+// getCommentsHandler godoc
+//
+//	@Summary		Lists the comments on a post
+//	@Description	Pages through the top-level comments of a post, newest first, or the replies to a comment,
+//	@Description	oldest first. Each comment embeds its oldest replies down to depth levels; reply_count tells
+//	@Description	whether there are more, which are paged with the comment as parent_id.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID		path		int64	true	"Post ID"
+//	@Param			parent_id	query		int64	false	"Comment to list the replies of"
+//	@Param			limit		query		int		false	"Number of comments (default: 20, max: 100)"
+//	@Param			depth		query		int		false	"Levels of comments to return (default: 2, max: 5)"
+//	@Param			cursor		query		string	false	"next_cursor of the previous page"
+//	@Success		200			{object}	CommentsResponse
+//	@Header			200			{string}	Link	"Link to the next page"
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/comments [get]
+func (app *application) getCommentsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	qs := r.URL.Query()
+
+	q := repo.CommentQuery{
+		Limit: 20,
+		Depth: 2,
+	}
+
+	if limitStr := qs.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid limit parameter: %w", err))
+			return
+		}
+		q.Limit = limit
+	}
+
+	if depthStr := qs.Get("depth"); depthStr != "" {
+		depth, err := strconv.Atoi(depthStr)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid depth parameter: %w", err))
+			return
+		}
+		q.Depth = depth
+	}
+
+	if parentStr := qs.Get("parent_id"); parentStr != "" {
+		parentID, err := strconv.ParseInt(parentStr, 10, 64)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid parent_id parameter: %w", err))
+			return
+		}
+		q.ParentID = parentID
+	}
+
+	if cursorStr := qs.Get("cursor"); cursorStr != "" {
+		cursor, err := repo.DecodeCommentCursor(cursorStr)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.Cursor = cursor
+	}
+
+	if err := validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	page, err := app.repo.Comments.GetThread(r.Context(), post.ID, q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.attachCommentReactionCounts(r.Context(), page.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if link := cursorLinkHeader(r, page.NextCursor, ""); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	if err := writeJSON(w, http.StatusOK, CommentsResponse{Data: page.Comments, NextCursor: page.NextCursor}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// UpdateCommentPayload represents the request payload for editing a comment
+//
+//	@Description	Request payload for editing a comment
+type UpdateCommentPayload struct {
+	// New comment content
+	//	@example	"This is a great post! (edited)"
+	Content string `json:"content" validate:"required,min=1,max=500" example:"This is a great post! (edited)"`
+}
+
+// updateCommentHandler godoc
+//
+//	@Summary		Edits a comment
+//	@Description	Changes the content of a comment and marks it as edited. Send the version of the comment
+//	@Description	(e.g. "3") or the ETag of a previous edit in If-Match to edit it only if it was not changed
+//	@Description	meanwhile. Only the author and users with the comment.update.any permission can edit a comment.
+//	@Tags			posts
+//	@Accept			json
+//	@Produce		json
+//	@Param			postID		path		int64					true	"Post ID"
+//	@Param			commentID	path		int64					true	"Comment ID"
+//	@Param			If-Match	header		string					false	"Version or ETag of the comment"
+//	@Param			payload		body		UpdateCommentPayload	true	"New content"
+//	@Success		200			{object}	repo.Comment
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Comment was changed concurrently"
+//	@Failure		412			{object}	error	"Comment was changed since the version was read"
+//	@Failure		428			{object}	error	"If-Match header is required"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/comments/{commentID} [patch]
+func (app *application) updateCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	if !app.checkIfMatch(w, r, "comment", comment.ID, comment.Version) {
+		return
+	}
+
+	var payload UpdateCommentPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	comment.Content = payload.Content
+
+	if err := app.repo.Comments.Update(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, repo.ErrEditConflict):
+			app.editConflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	reactions, err := app.loadCommentReactionCounts(r.Context(), []int64{comment.ID})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	comment.Reactions = reactions[comment.ID]
+
+	if err := app.taggedJSONResponse(w, r, http.StatusOK, comment.Version, comment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// deleteCommentHandler godoc
+//
+//	@Summary		Deletes a comment
+//	@Description	Deletes a comment, which hides its replies too, until it is restored or purged after the
+//	@Description	retention period. Send the version or ETag of the comment in If-Match to delete it only if
+//	@Description	it was not changed. Only the author and users with the comment.delete.any permission can
+//	@Description	delete a comment.
+//	@Tags			posts
+//	@Param			postID		path	int64	true	"Post ID"
+//	@Param			commentID	path	int64	true	"Comment ID"
+//	@Param			If-Match	header	string	false	"Version or ETag of the comment"
+//	@Success		204			"Comment deleted"
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		409			{object}	error	"Comment was changed concurrently"
+//	@Failure		412			{object}	error	"Comment was changed since the version was read"
+//	@Failure		428			{object}	error	"If-Match header is required"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/comments/{commentID} [delete]
+func (app *application) deleteCommentHandler(w http.ResponseWriter, r *http.Request) {
+	comment := getCommentFromCtx(r)
+
+	if !app.checkIfMatch(w, r, "comment", comment.ID, comment.Version) {
+		return
+	}
+
+	if err := app.repo.Comments.Delete(r.Context(), comment); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, repo.ErrEditConflict):
+			app.editConflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func getCommentFromCtx(r *http.Request) *repo.Comment {
+	comment, _ := r.Context().Value(commentCtx).(*repo.Comment)
+	return comment
+}
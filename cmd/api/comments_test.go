@@ -0,0 +1,145 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestComments(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(t *testing.T, method, path, body string) (int, []byte) {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		return rr.Code, rr.Body.Bytes()
+	}
+
+	t.Run("should embed replies down to the requested depth", func(t *testing.T) {
+		code, body := request(t, http.MethodGet, "/v1/posts/1/comments?depth=2", "")
+		checkResponseCode(t, http.StatusOK, code)
+
+		var res CommentsResponse
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 1 || len(res.Data[0].Replies) != 1 {
+			t.Errorf("unexpected thread %+v", res.Data)
+		}
+	})
+
+	t.Run("should reject invalid parameters", func(t *testing.T) {
+		for _, query := range []string{"?depth=6", "?limit=0", "?parent_id=x", "?cursor=bm90IGEgY3Vyc29y"} {
+			code, _ := request(t, http.MethodGet, "/v1/posts/1/comments"+query, "")
+			checkResponseCode(t, http.StatusBadRequest, code)
+		}
+	})
+
+	t.Run("should reject replies to comments on other posts", func(t *testing.T) {
+		code, _ := request(t, http.MethodPost, "/v1/posts/1/comments", `{"content":"Agreed","parent_id":7}`)
+		checkResponseCode(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("should create replies", func(t *testing.T) {
+		code, _ := request(t, http.MethodPost, "/v1/posts/1/comments", `{"content":"Agreed","parent_id":1}`)
+		checkResponseCode(t, http.StatusCreated, code)
+	})
+
+	t.Run("should attribute comments to the authenticated user", func(t *testing.T) {
+		code, body := request(t, http.MethodPost, "/v1/posts/1/comments", `{"content":"Not mine","user_id":42}`)
+		checkResponseCode(t, http.StatusCreated, code)
+
+		var res struct {
+			Data repo.Comment `json:"data"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Data.UserID != 1 {
+			t.Errorf("comment attributed to user %d, want the authenticated user 1", res.Data.UserID)
+		}
+	})
+
+	t.Run("should mark edited comments", func(t *testing.T) {
+		code, body := request(t, http.MethodPatch, "/v1/posts/1/comments/1", `{"content":"Edited"}`)
+		checkResponseCode(t, http.StatusOK, code)
+
+		var res struct {
+			Data repo.Comment `json:"data"`
+		}
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if !res.Data.Edited || res.Data.Content != "Edited" {
+			t.Errorf("unexpected comment %+v", res.Data)
+		}
+	})
+
+	t.Run("should only let authors edit and delete comments", func(t *testing.T) {
+		code, _ := request(t, http.MethodPatch, "/v1/posts/1/comments/2", `{"content":"Edited"}`)
+		checkResponseCode(t, http.StatusForbidden, code)
+
+		code, _ = request(t, http.MethodDelete, "/v1/posts/1/comments/2", "")
+		checkResponseCode(t, http.StatusForbidden, code)
+
+		code, _ = request(t, http.MethodDelete, "/v1/posts/1/comments/1", "")
+		checkResponseCode(t, http.StatusNoContent, code)
+	})
+
+	t.Run("should only change the version of a comment named in If-Match", func(t *testing.T) {
+		conditional := func(t *testing.T, app *application, method, ifMatch string) *http.Response {
+			t.Helper()
+
+			req, err := http.NewRequest(method, "/v1/posts/1/comments/1", strings.NewReader(`{"content":"Edited"}`))
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+			if ifMatch != "" {
+				req.Header.Set("If-Match", ifMatch)
+			}
+
+			return executeRequest(req, app.mount()).Result()
+		}
+
+		for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+			res := conditional(t, app, method, `"1"`)
+			checkResponseCode(t, http.StatusPreconditionFailed, res.StatusCode)
+		}
+
+		res := conditional(t, app, http.MethodPatch, `"0"`)
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+		if got := res.Header.Get("ETag"); !strings.HasPrefix(got, `"1-`) {
+			t.Errorf("unexpected ETag %q", got)
+		}
+
+		res = conditional(t, app, http.MethodDelete, `"0"`)
+		checkResponseCode(t, http.StatusNoContent, res.StatusCode)
+
+		strict := newTestApplication(t, config{requireIfMatch: true})
+		for _, method := range []string{http.MethodPatch, http.MethodDelete} {
+			res := conditional(t, strict, method, "")
+			checkResponseCode(t, http.StatusPreconditionRequired, res.StatusCode)
+		}
+	})
+
+	t.Run("should not find comments of other posts", func(t *testing.T) {
+		code, _ := request(t, http.MethodDelete, "/v1/posts/2/comments/1", "")
+		checkResponseCode(t, http.StatusNotFound, code)
+	})
+}
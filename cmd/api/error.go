@@ -33,6 +33,18 @@ func (app *application) conflictResponse(w http.ResponseWriter, r *http.Request,
 	_ = writeJSONError(w, http.StatusConflict, err.Error())
 }
 
+// 412 — the If-Match header of the request holds an outdated version.
+func (app *application) preconditionFailedResponse(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("412 %s %s: %v", r.Method, r.URL.Path, err)
+	_ = writeJSONError(w, http.StatusPreconditionFailed, "Precondition Failed: "+err.Error())
+}
+
+// 428 — the request must be made conditional with If-Match.
+func (app *application) preconditionRequiredResponse(w http.ResponseWriter, r *http.Request) {
+	log.Printf("428 %s %s", r.Method, r.URL.Path)
+	_ = writeJSONError(w, http.StatusPreconditionRequired, "Precondition Required: the If-Match header is required")
+}
+
 func (app *application) unauthorizedErrorResponse(w http.ResponseWriter, r *http.Request, err error) {
 	app.logger.Warn("unauthorized error", "method", r.Method, "path", r.URL.Path, "error", err.Error())
 	err = writeJSONError(w, http.StatusUnauthorized, "unauthorized")
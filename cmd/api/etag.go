@@ -0,0 +1,107 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// postETag is the entity tag of a response about a post or comment. It starts
+// with the version of the post or comment, which If-Match is checked against,
+// and ends with a hash of the body, since the body also holds comments and
+// reactions that change without the post changing.
+func postETag(version int32, body []byte) string {
+	sum := sha256.Sum256(body)
+	return fmt.Sprintf(`"%d-%x"`, version, sum[:8])
+}
+
+// taggedJSONResponse writes data like jsonResponse, along with the ETag of the
+// post or comment at version. GET requests whose If-None-Match holds that tag get 304 Not
+// Modified instead.
+func (app *application) taggedJSONResponse(w http.ResponseWriter, r *http.Request, status int, version int32, data any) error {
+	type envelope struct {
+		Data any `json:"data"`
+	}
+
+	body, err := json.Marshal(&envelope{Data: data})
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	tag := postETag(version, body)
+	w.Header().Set("ETag", tag)
+
+	if r.Method == http.MethodGet && noneMatch(r.Header.Get("If-None-Match"), tag) {
+		w.WriteHeader(http.StatusNotModified)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(body)
+	return err
+}
+
+// checkIfMatch checks the If-Match header of a request changing the post or
+// comment id of kind, which is at version. The header holds ETags or, for
+// comments, which are listed without one, their quoted version. It responds
+// with 412 Precondition Failed if the header holds no tag of the current
+// version, or with 428 Precondition Required if the header is missing and
+// config.requireIfMatch is set. Reports whether the request may proceed.
+func (app *application) checkIfMatch(w http.ResponseWriter, r *http.Request, kind string, id int64, version int32) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		if app.config.requireIfMatch {
+			app.preconditionRequiredResponse(w, r)
+			return false
+		}
+		return true
+	}
+
+	for _, tag := range strings.Split(header, ",") {
+		tag = strings.TrimSpace(tag)
+		if tag == "*" {
+			return true
+		}
+
+		// If-Match uses the strong comparison, weak tags never match
+		if strings.HasPrefix(tag, "W/") {
+			continue
+		}
+
+		tagVersion, _, _ := strings.Cut(strings.Trim(tag, `"`), "-")
+		if v, err := strconv.ParseInt(tagVersion, 10, 32); err == nil && int32(v) == version {
+			return true
+		}
+	}
+
+	app.preconditionFailedResponse(w, r, fmt.Errorf("%s %d is at version %d", kind, id, version))
+	return false
+}
+
+// noneMatch reports whether the If-None-Match header holds tag, using the
+// weak comparison.
+func noneMatch(header, tag string) bool {
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimPrefix(strings.TrimSpace(t), "W/")
+		if t == "*" || t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// editConflictResponse responds to a write that lost the race against
+// another one: 412 if the client made it conditional with If-Match, 409
+// otherwise.
+func (app *application) editConflictResponse(w http.ResponseWriter, r *http.Request, err error) {
+	if r.Header.Get("If-Match") != "" {
+		app.preconditionFailedResponse(w, r, err)
+		return
+	}
+	app.conflictResponse(w, r, err)
+}
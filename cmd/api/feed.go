@@ -2,22 +2,39 @@ package main
 
 import (
 	"Go-Microservice/internal/repo"
+	"fmt"
 	"net/http"
+	"strings"
 )
 
+// FeedResponse is a page of the feed
+//
+//	@Description	Page of the feed with the cursors of the adjacent pages, which are omitted at either end
+type FeedResponse struct {
+	Data       []repo.PostWithMetadata `json:"data"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+	PrevCursor string                  `json:"prev_cursor,omitempty"`
+}
+
 // GetUserFeed retrieves the personalized feed for the authenticated user
 //
 //	@Summary		Get user's personalized feed
 //	@Description	Retrieve a chronological feed of posts from users that the authenticated user follows
-//	@Description	Returns posts ordered by creation date (newest first) with pagination support
+//	@Description	Returns posts ordered by creation date (newest first) with pagination support.
+//	@Description	Pass next_cursor or prev_cursor of a response as cursor to page without skipping or
+//	@Description	repeating posts; the same links are sent in the Link header. offset is still supported.
+//	@Description	mode=ranked orders the newest posts by recency, comments, affinity to the author and
+//	@Description	overlap with the tags of the recent activity of the user; it is paged with offset only.
 //	@Tags			users
 //	@Accept			json
 //	@Produce		json
 //	@Param			limit	query		int						false	"Number of posts to retrieve (default: 20, max: 100)"
 //	@Param			offset	query		int						false	"Number of posts to skip for pagination (default: 0)"
+//	@Param			cursor	query		string					false	"Opaque cursor of a previous page, takes precedence over offset"
+//	@Param			mode	query		string					false	"chronological (default) or ranked"
 //	@Param			since	query		string					false	"ISO 8601 timestamp to get posts created after this time"
-//	@Success		200		{array}		repo.Post				"User feed retrieved successfully"
-//	@Success		200		{object}	map[string]interface{}	"Feed with pagination metadata"
+//	@Success		200		{object}	FeedResponse			"User feed retrieved successfully"
+//	@Header			200		{string}	Link					"Links to the next and previous page"
 //	@Failure		400		{object}	map[string]string		"Invalid query parameters"
 //	@Failure		401		{object}	map[string]string		"Authentication required"
 //	@Failure		500		{object}	map[string]string		"Internal server error"
@@ -30,6 +47,7 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 		Sort:   "desc",
 		Tags:   []string{},
 		Search: "",
+		Mode:   repo.FeedModeChronological,
 	}
 
 	fq, err := fq.Parse(r)
@@ -44,15 +62,58 @@ func (app *application) getUserFeedHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	ctx := r.Context()
-	//user := getUserFromContext(r)
+	user := getUserFromContext(r)
 
-	feed, err := app.repo.Posts.GetUserFeed(ctx, int64(156), fq)
+	var page *repo.FeedPage
+	if fq.Mode == repo.FeedModeRanked {
+		if fq.Cursor != nil {
+			app.badRequestResponse(w, r, errRankedFeedCursor)
+			return
+		}
+		page, err = app.getRankedFeedPage(ctx, user.ID, fq)
+	} else {
+		page, err = app.getFeedPage(ctx, user.ID, fq)
+	}
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
 
-	if err := app.jsonResponse(w, http.StatusOK, feed); err != nil {
+	if err := app.attachReactionCounts(ctx, page.Posts); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if link := cursorLinkHeader(r, page.NextCursor, page.PrevCursor); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	res := FeedResponse{Data: page.Posts, NextCursor: page.NextCursor, PrevCursor: page.PrevCursor}
+	if err := writeJSON(w, http.StatusOK, res); err != nil {
 		app.internalServerError(w, r, err)
 	}
 }
+
+// cursorLinkHeader returns the RFC 8288 links to the pages of the given
+// cursors, which repeat the query of the request with the cursor replacing the
+// offset. Empty cursors are left out.
+func cursorLinkHeader(r *http.Request, next, prev string) string {
+	var links []string
+
+	link := func(cursor, rel string) {
+		if cursor == "" {
+			return
+		}
+
+		q := r.URL.Query()
+		q.Del("offset")
+		q.Set("cursor", cursor)
+
+		links = append(links, fmt.Sprintf(`<%s?%s>; rel="%s"`, r.URL.Path, q.Encode(), rel))
+	}
+
+	link(next, "next")
+	link(prev, "prev")
+
+	return strings.Join(links, ", ")
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"Go-Microservice/internal/ranking"
+	"Go-Microservice/internal/repo"
+	"Go-Microservice/internal/repo/cache"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestGetUserFeed(t *testing.T) {
+	withTimelines := config{
+		redisConfig: redisConfig{
+			enabled: true,
+		},
+		timeline: timelineConfig{
+			enabled: true,
+		},
+	}
+
+	app := newTestApplication(t, withTimelines)
+	mux := app.mount()
+
+	users := app.cacheStorage.Users.(*cache.MockUserStore)
+	users.On("Get", mock.Anything).Return(nil, nil)
+	users.On("Set", mock.Anything).Return(nil)
+
+	reactions := app.cacheStorage.Reactions.(*cache.MockReactionStore)
+	reactions.On("Get", mock.Anything).Return(map[int64]repo.ReactionCounts{}, nil)
+	reactions.On("Set", mock.Anything).Return(nil)
+
+	posts := app.repo.Posts.(*repo.MockPostStore)
+	posts.Feed = []repo.PostWithMetadata{
+		{Post: repo.Post{ID: 3, CreatedAt: "2024-01-15T10:32:00Z"}},
+		{Post: repo.Post{ID: 2, CreatedAt: "2024-01-15T10:31:00Z"}},
+	}
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	getFeed := func(t *testing.T) FeedResponse {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res FeedResponse
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return res
+	}
+
+	t.Run("should read the feed from the database and build the timeline of a cold user", func(t *testing.T) {
+		timelines := &cache.MockTimelineStore{}
+		timelines.On("Page", int64(1), mock.Anything).Return(nil, false, cache.ErrTimelineCold)
+		timelines.On("Set", int64(1), mock.Anything).Return(nil)
+		app.cacheStorage.Timelines = timelines
+		posts.FeedReads = 0
+
+		res := getFeed(t)
+
+		if len(res.Data) != 2 || posts.FeedReads != 1 {
+			t.Errorf("got %d posts from %d database reads", len(res.Data), posts.FeedReads)
+		}
+		timelines.AssertCalled(t, "Set", int64(1), mock.Anything)
+	})
+
+	t.Run("should hydrate the posts of a cached timeline", func(t *testing.T) {
+		timelines := &cache.MockTimelineStore{}
+		timelines.On("Page", int64(1), mock.Anything).Return([]int64{3, 2}, true, nil)
+		app.cacheStorage.Timelines = timelines
+		posts.FeedReads = 0
+
+		res := getFeed(t)
+
+		if len(res.Data) != 2 || res.Data[0].ID != 3 || res.Data[1].ID != 2 {
+			t.Fatalf("unexpected feed %+v", res.Data)
+		}
+		if posts.FeedReads != 0 {
+			t.Errorf("feed read from the database %d times", posts.FeedReads)
+		}
+		if res.NextCursor == "" {
+			t.Error("missing next cursor")
+		}
+	})
+
+	t.Run("should drop deleted posts from the timeline", func(t *testing.T) {
+		timelines := &cache.MockTimelineStore{}
+		timelines.On("Page", int64(1), mock.Anything).Return([]int64{3, 9, 2}, false, nil)
+		timelines.On("Remove", int64(1), []int64{9}).Return(nil)
+		app.cacheStorage.Timelines = timelines
+
+		res := getFeed(t)
+
+		if len(res.Data) != 2 {
+			t.Errorf("got %d posts, want 2", len(res.Data))
+		}
+		timelines.AssertCalled(t, "Remove", int64(1), []int64{9})
+	})
+
+	t.Run("should page the ranked feed with offset only", func(t *testing.T) {
+		cursor := repo.FeedCursor{ID: 3}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?mode=ranked&cursor="+cursor.Encode(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusBadRequest, rr.Code)
+	})
+	t.Run("should order the ranked feed by score", func(t *testing.T) {
+		timelines := &cache.MockTimelineStore{}
+		timelines.On("Page", int64(1), mock.Anything).Return(nil, false, cache.ErrTimelineMiss)
+		app.cacheStorage.Timelines = timelines
+
+		// only the affinity counts, so the older post of a followed author
+		// outranks the newer one of a stranger
+		app.config.ranking = rankingConfig{
+			weights:        ranking.Weights{Affinity: 1},
+			candidates:     10,
+			activityWindow: time.Hour,
+		}
+		posts.Feed = []repo.PostWithMetadata{
+			{Post: repo.Post{ID: 3, UserID: 5, CreatedAt: "2024-01-15T10:32:00Z"}},
+			{Post: repo.Post{ID: 2, UserID: 4, CreatedAt: "2024-01-15T10:31:00Z"}},
+		}
+		signals := app.repo.FeedSignals.(*repo.MockFeedSignalsStore)
+		signals.Signals = &repo.FeedSignals{Authors: map[int64]repo.AuthorSignals{4: {}}}
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/feed?mode=ranked", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res FeedResponse
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 2 || res.Data[0].ID != 2 || res.Data[1].ID != 3 {
+			t.Errorf("unexpected feed %+v", res.Data)
+		}
+	})
+}
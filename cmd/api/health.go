@@ -1,6 +1,7 @@
 package main
 
 import (
+	"Go-Microservice/internal/breaker"
 	"net/http"
 	"time"
 )
@@ -28,6 +29,11 @@ type HealthResponse struct {
 	// Current Env
 	// @example "dev"
 	Env string `json:"env" example:"dev"`
+
+	// State of the circuit breaker guarding Redis: closed, open or half-open.
+	// Omitted when Redis is disabled
+	//	@example	"closed"
+	Redis string `json:"redis,omitempty" example:"closed"`
 }
 
 // HealthCheck returns the current health status of the service
@@ -35,7 +41,8 @@ type HealthResponse struct {
 //	@Summary		Get service health status
 //	@Description	Returns comprehensive health information about the microservice including operational status,
 //	@Description	system timestamp, and version details. This endpoint is used for monitoring and load balancer health checks.
-//	@Description	Always returns 200 OK when the service is running and can process requests.
+//	@Description	Always returns 200 OK when the service is running and can process requests. The status is
+//	@Description	"degraded" while Redis is unavailable and requests are served from the database instead.
 //	@Tags			health
 //	@Accept			json
 //	@Produce		json
@@ -63,6 +70,19 @@ func (app *application) healthcheckHandler(w http.ResponseWriter, r *http.Reques
 		Env:       app.config.env,
 	}
 
+	if app.redisBreaker != nil {
+		// once the breaker cooled down, the ping probes whether Redis is back
+		if app.redisBreaker.State() != breaker.Closed {
+			_ = app.cacheStorage.Ping(r.Context())
+		}
+
+		healthResp.Redis = app.redisBreaker.State()
+		if healthResp.Redis != breaker.Closed {
+			healthResp.Status = "degraded"
+			healthResp.Message = "Redis is unavailable, falling back to the database"
+		}
+	}
+
 	w.WriteHeader(http.StatusOK)
 
 	if err := app.jsonResponse(w, http.StatusOK, healthResp); err != nil {
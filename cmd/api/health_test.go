@@ -0,0 +1,71 @@
+package main
+
+import (
+	"Go-Microservice/internal/breaker"
+	"Go-Microservice/internal/repo/cache"
+	"context"
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestHealthcheck(t *testing.T) {
+	basic := authConfig{basic: basicConfig{user: "admin", pass: "secret"}}
+
+	getHealth := func(t *testing.T, app *application) HealthResponse {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/health", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.SetBasicAuth("admin", "secret")
+
+		rr := executeRequest(req, app.mount())
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var body struct {
+			Data HealthResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		return body.Data
+	}
+
+	t.Run("should omit Redis when it is disabled", func(t *testing.T) {
+		app := newTestApplication(t, config{auth: basic})
+
+		health := getHealth(t, app)
+		if health.Status != "healthy" || health.Redis != "" {
+			t.Errorf("got status %q, redis %q", health.Status, health.Redis)
+		}
+	})
+
+	t.Run("should report degraded once the Redis breaker opens", func(t *testing.T) {
+		app := newTestApplication(t, config{auth: basic, redisConfig: redisConfig{enabled: true}})
+
+		// nothing listens on the port, so every command fails to connect
+		rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+		defer rdb.Close()
+
+		app.redisBreaker = breaker.New(breaker.Config{Failures: 2, Cooldown: time.Hour}, nil)
+		rdb.AddHook(breaker.RedisHook(app.redisBreaker))
+		app.cacheStorage = cache.NewRedisStorage(rdb, 10, time.Hour)
+
+		if health := getHealth(t, app); health.Status != "healthy" || health.Redis != breaker.Closed {
+			t.Fatalf("got status %q, redis %q before any failure", health.Status, health.Redis)
+		}
+
+		for range 2 {
+			app.cacheStorage.Ping(context.Background())
+		}
+
+		if health := getHealth(t, app); health.Status != "degraded" || health.Redis != breaker.Open {
+			t.Errorf("got status %q, redis %q", health.Status, health.Redis)
+		}
+	})
+}
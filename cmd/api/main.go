@@ -3,15 +3,18 @@ package main
 import (
 	"Go-Microservice/docs"
 	"Go-Microservice/internal/auth"
+	"Go-Microservice/internal/breaker"
 	"Go-Microservice/internal/db"
 	"Go-Microservice/internal/env"
 	formatLog "Go-Microservice/internal/log"
 	"Go-Microservice/internal/mailer"
+	"Go-Microservice/internal/ranking"
 	"Go-Microservice/internal/ratelimiter"
 	"Go-Microservice/internal/repo"
 	"Go-Microservice/internal/repo/cache"
 	"context"
 	"expvar"
+	"fmt"
 	"github.com/redis/go-redis/v9"
 	"log"
 	"log/slog"
@@ -20,6 +23,7 @@ import (
 	"os"
 	"os/signal"
 	"runtime"
+	"strings"
 	"syscall"
 	"time"
 )
@@ -60,6 +64,12 @@ const (
 // @tag.name				users
 // @tag.description		Operations related to user management and social features
 //
+// @tag.name				search
+// @tag.description		Full-text search over posts, comments and users
+//
+// @tag.name				admin
+// @tag.description		Restoring deleted posts, comments and users
+//
 // @tag.name				health
 // @tag.description		Health check and system status endpoints
 //
@@ -84,6 +94,18 @@ func main() {
 		},
 		apiUrl:            env.GetString("API_URL", "localhost:8000"),
 		invitationExpTime: env.GetDuration("INVITATION_EXP_TIME", time.Hour*5),
+		invitationSweep: invitationSweepConfig{
+			enabled:           env.GetBool("INVITATION_SWEEP_ENABLED", true),
+			interval:          env.GetDuration("INVITATION_SWEEP_INTERVAL", time.Hour),
+			unactivatedMaxAge: env.GetDuration("UNACTIVATED_USER_MAX_AGE", time.Hour*24*7),
+		},
+		retention: retentionConfig{
+			enabled:  env.GetBool("RETENTION_ENABLED", true),
+			period:   env.GetDuration("RETENTION_PERIOD", time.Hour*24*30),
+			interval: env.GetDuration("RETENTION_INTERVAL", time.Hour),
+		},
+		passwordResetExpTime: env.GetDuration("PASSWORD_RESET_EXP_TIME", time.Hour),
+		requireIfMatch:       env.GetBool("REQUIRE_IF_MATCH", false),
 		mailConfig: mailConfig{
 			sendGrid: sendGridConfig{
 				apiKey: env.GetString("SENDGRID_API_KEY", ""),
@@ -98,10 +120,17 @@ func main() {
 				pass: env.GetString("BASIC_AUTH_PASS", "admin"),
 			},
 			token: tokenConfig{
-				secret: env.GetString("JWT_SECRET", "secret"),
-				exp: env.GetDuration("JWT_EXP", time.Hour*24*30),
-				aud:    env.GetString("JWT_AUD", "Go Microservice"),
-				iss:    env.GetString("JWT_ISS", "Go Microservice"),
+				secret:     env.GetString("JWT_SECRET", "secret"),
+				exp:        env.GetDuration("JWT_EXP", time.Minute*15),
+				refreshExp: env.GetDuration("JWT_REFRESH_EXP", time.Hour*24*30),
+				mfaExp:     env.GetDuration("JWT_MFA_EXP", time.Minute*5),
+				aud:        env.GetString("JWT_AUD", "Go Microservice"),
+				iss:        env.GetString("JWT_ISS", "Go Microservice"),
+
+				keysDir:        env.GetString("JWT_KEYS_DIR", ""),
+				activeKID:      env.GetString("JWT_ACTIVE_KID", ""),
+				retiredKeys:    env.GetString("JWT_RETIRED_KEYS", ""),
+				keyGracePeriod: env.GetDuration("JWT_KEY_GRACE_PERIOD", time.Hour*24),
 			},
 		},
 		redisConfig: redisConfig{
@@ -109,13 +138,57 @@ func main() {
 			pw:      env.GetString("REDIS_PW", "9GfZuJI3RMooIJ0TFNc3fir9obuNZ7CU"),
 			db:      env.GetInt("REDIS_DB", 0),
 			enabled: env.GetBool("REDIS_ENABLED", true),
+			breaker: breaker.Config{
+				Failures: env.GetInt("REDIS_BREAKER_FAILURES", 5),
+				Cooldown: env.GetDuration("REDIS_BREAKER_COOLDOWN", time.Second*30),
+			},
+		},
+		timeline: timelineConfig{
+			enabled: env.GetBool("TIMELINE_ENABLED", true),
+			maxLen:  env.GetInt("TIMELINE_MAX_LEN", 800),
+			ttl:     env.GetDuration("TIMELINE_TTL", time.Hour*24*7),
+		},
+		cache: cacheConfig{
+			enabled: env.GetBool("CACHE_ENABLED", true),
+			postTTL: env.GetDuration("CACHE_POST_TTL", time.Minute*5),
+			feedTTL: env.GetDuration("CACHE_FEED_TTL", time.Second*30),
+		},
+		ranking: rankingConfig{
+			weights: ranking.Weights{
+				Recency:  env.GetFloat("FEED_RANK_RECENCY_WEIGHT", 1),
+				Comments: env.GetFloat("FEED_RANK_COMMENTS_WEIGHT", 0.3),
+				Affinity: env.GetFloat("FEED_RANK_AFFINITY_WEIGHT", 0.5),
+				Tags:     env.GetFloat("FEED_RANK_TAGS_WEIGHT", 0.4),
+				HalfLife: env.GetDuration("FEED_RANK_HALF_LIFE", time.Hour*24),
+			},
+			candidates:     env.GetInt("FEED_RANK_CANDIDATES", 200),
+			activityWindow: env.GetDuration("FEED_RANK_ACTIVITY_WINDOW", time.Hour*24*30),
 		},
 		rateLimiterConfig: ratelimiter.Config{
 			RequestsPerTimeFrame: env.GetInt("RATE_LIMITER_REQUESTS_PER_TIME_FRAME", 5),
 			TimeFrame:            env.GetDuration("RATE_LIMITER_TIME_FRAME", time.Minute*5),
 			Enabled:              env.GetBool("RATE_LIMITER_ENABLED", true),
+			Algorithm:            env.GetString("RATE_LIMITER_ALGORITHM", ratelimiter.FixedWindow),
 		},
+		loginLockout: ratelimiter.LockoutConfig{
+			FreeAttempts:    env.GetInt("LOGIN_FREE_ATTEMPTS", 3),
+			BaseDelay:       env.GetDuration("LOGIN_BACKOFF_BASE_DELAY", time.Second),
+			MaxAttempts:     env.GetInt("LOGIN_MAX_ATTEMPTS", 10),
+			LockoutDuration: env.GetDuration("LOGIN_LOCKOUT_DURATION", time.Minute*15),
+			Window:          env.GetDuration("LOGIN_ATTEMPTS_WINDOW", time.Hour),
+			MaxKeys:         env.GetInt("LOGIN_ATTEMPTS_MAX_KEYS", 100000),
+			Enabled:         env.GetBool("LOGIN_LOCKOUT_ENABLED", true),
+		},
+	}
+
+	config.oidcProviders = loadOIDCConfigs(env.GetString("OIDC_PROVIDERS", ""), config.apiUrl)
+
+	policies, err := loadRateLimitPolicies()
+	if err != nil {
+		logger.Error("Failed to load rate limit policies", "error", err)
+		os.Exit(1)
 	}
+	config.rateLimiterConfig.Policies = policies
 
 	dbConn, err := db.New(
 		config.db.addr,
@@ -133,7 +206,11 @@ func main() {
 
 	sendgrid := mailer.NewSendGrid(config.mailConfig.sendGrid.apiKey, config.mailConfig.fromEmail)
 
-	authenticator := auth.NewJWTAuthenticator(config.auth.token.secret, config.auth.token.iss, config.auth.token.aud)
+	authenticator, err := newAuthenticator(config.auth.token)
+	if err != nil {
+		logger.Error("Failed to initialize authenticator", "error", err)
+		os.Exit(1)
+	}
 
 	var rdb *redis.Client
 	if config.redisConfig.enabled {
@@ -145,12 +222,32 @@ func main() {
 		logger.Info("Connected to redis!")
 	}
 
-	// Rate limiter
-	rateLimiter := ratelimiter.NewRedisFixedWindowLimiter(
-		rdb,
-		config.rateLimiterConfig.RequestsPerTimeFrame,
-		config.rateLimiterConfig.TimeFrame,
-	)
+	// Read-through caches in front of the database, which drop what is written
+	// through them
+	if config.redisConfig.enabled && config.cache.enabled {
+		onError := func(err error) {
+			logger.Warn("Cache failure", "error", err)
+		}
+		posts := cache.NewPostStore(rdb, postgresRepo.Posts, postgresRepo.Followers, config.cache.postTTL, config.cache.feedTTL, onError)
+		postgresRepo.Posts = posts
+		postgresRepo.Followers = cache.NewFollowerStore(postgresRepo.Followers, posts)
+	}
+
+	// Rate limit policies, in memory when Redis is disabled
+	rateLimiter := ratelimiter.NewEngine(config.rateLimiterConfig, rdb)
+
+	// Failed login tracking
+	var loginTracker ratelimiter.LoginTracker
+	if config.redisConfig.enabled {
+		loginTracker = ratelimiter.NewRedisLoginTracker(rdb, config.loginLockout)
+	} else {
+		loginTracker = ratelimiter.NewInMemoryLoginTracker(config.loginLockout)
+	}
+
+	oidcProviders := make(map[string]*auth.OIDCProvider, len(config.oidcProviders))
+	for _, cfg := range config.oidcProviders {
+		oidcProviders[cfg.Name] = auth.NewOIDCProvider(cfg, nil)
+	}
 
 	app := &application{
 		config:        config,
@@ -158,8 +255,18 @@ func main() {
 		repo:          *postgresRepo,
 		mailer:        sendgrid,
 		authenticator: authenticator,
-		cacheStorage: cache.NewRedisStorage(rdb),
-		rateLimiter: rateLimiter,
+		cacheStorage:  cache.NewRedisStorage(rdb, config.timeline.maxLen, config.timeline.ttl),
+		rateLimiter:   rateLimiter,
+		loginTracker:  loginTracker,
+		oidcProviders: oidcProviders,
+	}
+
+	if rdb != nil {
+		app.redisBreaker = breaker.New(config.redisConfig.breaker, app.redisBreakerChanged)
+		rdb.AddHook(breaker.RedisHook(app.redisBreaker))
+
+		// Redis may have missed revocations while it was unavailable
+		go app.syncRevocations(context.Background())
 	}
 
 	expvar.NewString("version").Set("1.0.0")
@@ -170,6 +277,15 @@ func main() {
 		return runtime.NumGoroutine()
 	}))
 
+	sweepCtx, stopSweeper := context.WithCancel(context.Background())
+	defer stopSweeper()
+	if config.invitationSweep.enabled {
+		go app.sweepInvitations(sweepCtx)
+	}
+	if config.retention.enabled {
+		go app.purgeDeleted(sweepCtx)
+	}
+
 	router := app.mount()
 	if err := app.runWithGracefulShutdown(router); err != nil {
 		logger.Error("Failed to start application", "error", err)
@@ -177,6 +293,70 @@ func main() {
 	}
 }
 
+// newAuthenticator returns an asymmetric key set authenticator when signing
+// keys are configured and falls back to the shared secret HMAC authenticator.
+func newAuthenticator(cfg tokenConfig) (auth.Authenticator, error) {
+	if cfg.keysDir == "" {
+		return auth.NewJWTAuthenticator(cfg.secret, cfg.iss, cfg.aud), nil
+	}
+
+	retired, err := auth.ParseRetiredKeys(cfg.retiredKeys)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := auth.LoadSigningKeys(cfg.keysDir, retired)
+	if err != nil {
+		return nil, err
+	}
+
+	return auth.NewKeySetAuthenticator(keys, cfg.activeKID, cfg.keyGracePeriod, cfg.iss, cfg.aud)
+}
+
+// loadOIDCConfigs reads the settings of the comma separated providers from
+// OIDC_<NAME>_ISSUER, OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET and
+// OIDC_<NAME>_REDIRECT_URL.
+func loadOIDCConfigs(names, apiURL string) []auth.OIDCConfig {
+	var configs []auth.OIDCConfig
+	for _, name := range strings.Split(names, ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		configs = append(configs, auth.OIDCConfig{
+			Name:         name,
+			Issuer:       env.GetString(prefix+"ISSUER", ""),
+			ClientID:     env.GetString(prefix+"CLIENT_ID", ""),
+			ClientSecret: env.GetString(prefix+"CLIENT_SECRET", ""),
+			RedirectURL: env.GetString(prefix+"REDIRECT_URL",
+				fmt.Sprintf("http://%s/v1/authentication/oidc/%s/callback", apiURL, name)),
+		})
+	}
+
+	return configs
+}
+
+// loadRateLimitPolicies reads the overrides of rate limit policies from the
+// file at RATE_LIMIT_POLICIES_FILE, or else from RATE_LIMIT_POLICIES, both
+// in the format of ratelimiter.ParsePolicies. Only the policies of
+// rateLimitPolicies can be overridden.
+func loadRateLimitPolicies() (map[string]ratelimiter.Policy, error) {
+	data := []byte(env.GetString("RATE_LIMIT_POLICIES", ""))
+	if path := env.GetString("RATE_LIMIT_POLICIES_FILE", ""); path != "" {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("failed to read rate limit policies: %w", err)
+		}
+	}
+
+	if len(data) == 0 {
+		return nil, nil
+	}
+	return ratelimiter.ParsePolicies(data, rateLimitPolicies)
+}
+
 // runWithGracefulShutdown starts the HTTP server and implements graceful shutdown
 // on receiving termination signals (SIGINT, SIGTERM). This ensures ongoing requests
 // are completed before server termination, preventing data loss or corruption.
@@ -241,10 +421,30 @@ func (app *application) handleGracefulShutdown(srv *http.Server, done chan<- str
 		app.logger.Error("Server forced to shutdown", "error", err)
 	}
 
+	// Let background tasks of the last requests finish, e.g. sending emails
+	app.tasks.Wait()
+
 	// Signal shutdown completion
 	close(done)
 }
 
+// background runs fn after the response of a request, and holds the
+// shutdown of the server until it returns. Panics are logged.
+func (app *application) background(fn func()) {
+	app.tasks.Add(1)
+
+	go func() {
+		defer app.tasks.Done()
+		defer func() {
+			if err := recover(); err != nil {
+				app.logger.Error("background task panicked", "error", err)
+			}
+		}()
+
+		fn()
+	}()
+}
+
 // getLocalIP returns the first non-loopback IPv4 address of the local machine.
 // This is used for debugging and logging purposes to identify which instance
 // is serving requests in multi-instance deployments.
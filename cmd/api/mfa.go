@@ -0,0 +1,495 @@
+package main
+
+import (
+	"Go-Microservice/internal/auth"
+	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// mfaPendingTokenType marks the token handed out after the password step of a
+// login of a user with MFA. It can only be exchanged at /authentication/mfa
+// and is rejected by AuthTokenMiddleware.
+const mfaPendingTokenType = "mfa_pending"
+
+// mfaRecoveryCodes is the number of recovery codes issued on enrollment
+const mfaRecoveryCodes = 10
+
+// MFAChallenge is returned instead of a token pair when the user has MFA enabled
+//
+//	@Description	Token to exchange together with a TOTP or recovery code for a token pair
+type MFAChallenge struct {
+	// Always true
+	MFARequired bool `json:"mfa_required" example:"true"`
+
+	// Token to send to /authentication/mfa
+	MFAToken string `json:"mfa_token"`
+
+	// Lifetime of the MFA token in seconds
+	//	@example	300
+	ExpiresIn int64 `json:"expires_in" example:"300"`
+}
+
+// MFAEnrollment holds the secret of a pending MFA enrollment
+//
+//	@Description	TOTP secret to add to an authenticator app
+type MFAEnrollment struct {
+	// Base32 encoded TOTP secret
+	Secret string `json:"secret" example:"JBSWY3DPEHPK3PXP"`
+
+	// otpauth:// URI, usually rendered as QR code
+	URI string `json:"otpauth_uri"`
+}
+
+// MFARecoveryCodes is returned once when MFA is enabled
+//
+//	@Description	Single-use codes that replace a TOTP code when the authenticator is lost
+type MFARecoveryCodes struct {
+	RecoveryCodes []string `json:"recovery_codes"`
+}
+
+type VerifyMFAPayload struct {
+	Code string `json:"code" validate:"required,len=6,numeric"`
+}
+
+type DisableMFAPayload struct {
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
+
+type MFALoginPayload struct {
+	MFAToken     string `json:"mfa_token" validate:"required"`
+	Code         string `json:"code" validate:"required_without=RecoveryCode,omitempty,len=6,numeric"`
+	RecoveryCode string `json:"recovery_code" validate:"required_without=Code,omitempty,max=32"`
+}
+
+// enrollMFAHandler godoc
+//
+//	@Summary		Starts an MFA enrollment
+//	@Description	Generates a new TOTP secret for the authenticated user. MFA is enabled once a
+//	@Description	code of the secret is confirmed at /users/mfa/verify.
+//	@Tags			users
+//	@Produce		json
+//	@Success		200	{object}	MFAEnrollment
+//	@Failure		401	{object}	error
+//	@Failure		409	{object}	error	"MFA is already enabled"
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/mfa/enroll [post]
+func (app *application) enrollMFAHandler(w http.ResponseWriter, r *http.Request) {
+	user := getUserFromContext(r)
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.repo.MFA.SetSecret(r.Context(), user.ID, secret); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrConflict):
+			app.conflictResponse(w, r, errors.New("mfa is already enabled"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	enrollment := MFAEnrollment{
+		Secret: secret,
+		URI:    auth.TOTPURI(app.config.auth.token.iss, user.Email, secret),
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, enrollment); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// verifyMFAHandler godoc
+//
+//	@Summary		Enables MFA
+//	@Description	Confirms the pending enrollment with a TOTP code and enables MFA. The returned
+//	@Description	recovery codes are shown only once.
+//	@Tags			users
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		VerifyMFAPayload	true	"TOTP code"
+//	@Success		200		{object}	MFARecoveryCodes
+//	@Failure		400		{object}	error	"Invalid code"
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error	"No pending enrollment"
+//	@Failure		409		{object}	error	"MFA is already enabled"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/mfa/verify [post]
+func (app *application) verifyMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload VerifyMFAPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	settings, err := app.repo.MFA.Get(ctx, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if settings.Enabled {
+		app.conflictResponse(w, r, errors.New("mfa is already enabled"))
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(settings.Secret, payload.Code, time.Now())
+	if !ok {
+		app.badRequestResponse(w, r, errors.New("invalid code"))
+		return
+	}
+
+	if err := app.repo.MFA.UseTOTPStep(ctx, user.ID, step); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrTOTPCodeReused):
+			app.badRequestResponse(w, r, errors.New("invalid code"))
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(mfaRecoveryCodes)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = hashToken(code)
+	}
+
+	if err := app.repo.MFA.Enable(ctx, user.ID, hashes); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if app.config.redisConfig.enabled {
+		app.cacheStorage.Users.Delete(ctx, user.ID)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, MFARecoveryCodes{RecoveryCodes: codes}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// disableMFAHandler godoc
+//
+//	@Summary		Disables MFA
+//	@Description	Turns off MFA for the authenticated user after checking a TOTP code or an unused
+//	@Description	recovery code, and drops the secret and the recovery codes. A pending enrollment
+//	@Description	is dropped without a code.
+//	@Tags			users
+//	@Accept			json
+//	@Param			payload	body	DisableMFAPayload	false	"TOTP or recovery code, required once MFA is enabled"
+//	@Success		204		"MFA disabled"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error	"Invalid code"
+//	@Failure		404		{object}	error	"No enrollment"
+//	@Failure		429		{object}	error	"Too many failed attempts for this account"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/mfa [delete]
+func (app *application) disableMFAHandler(w http.ResponseWriter, r *http.Request) {
+	var payload DisableMFAPayload
+	if err := readJSON(w, r, &payload); err != nil && !errors.Is(err, io.EOF) {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user := getUserFromContext(r)
+	ctx := r.Context()
+
+	settings, err := app.repo.MFA.Get(ctx, user.ID)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	// a stolen session must not be enough to turn off the second factor
+	if settings.Enabled {
+		if err := validate.Struct(payload); err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+
+		attemptsKey := strings.ToLower(user.Email)
+
+		if app.config.loginLockout.Enabled {
+			status, err := app.loginTracker.Check(ctx, attemptsKey)
+			if err != nil {
+				app.logger.Warn("failed to check login attempts", "error", err)
+			} else if status.Blocked() {
+				app.rateLimitExceededResponse(w, r, retryAfterSeconds(status.RetryAfter))
+				return
+			}
+		}
+
+		if err := app.verifySecondFactor(ctx, settings, payload.Code, payload.RecoveryCode); err != nil {
+			if errors.Is(err, errInvalidSecondFactor) {
+				app.recordFailedLogin(ctx, attemptsKey, user)
+				app.unauthorizedErrorResponse(w, r, err)
+				return
+			}
+			app.internalServerError(w, r, err)
+			return
+		}
+	}
+
+	app.disableMFA(w, r, user.ID)
+}
+
+// resetMFAHandler godoc
+//
+//	@Summary		Resets the MFA of a user
+//	@Description	Turns off MFA for a user who lost their authenticator and recovery codes, so that
+//	@Description	they can sign in with their password and enroll again.
+//	@Tags			users
+//	@Param			userID	path	int64	true	"User ID"
+//	@Success		204		"MFA disabled"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error	"User has no enrollment"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/users/{userID}/mfa [delete]
+func (app *application) resetMFAHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	app.disableMFA(w, r, userID)
+}
+
+func (app *application) disableMFA(w http.ResponseWriter, r *http.Request, userID int64) {
+	ctx := r.Context()
+
+	if err := app.repo.MFA.Disable(ctx, userID); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("mfa disabled", "user_id", userID, "by", getUserFromContext(r).ID)
+
+	if app.config.redisConfig.enabled {
+		app.cacheStorage.Users.Delete(ctx, userID)
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// mfaLoginHandler godoc
+//
+//	@Summary		Completes an MFA login
+//	@Description	Exchanges the MFA token returned by /authentication/token together with a TOTP
+//	@Description	code or an unused recovery code for a token pair.
+//	@Tags			authentication
+//	@Accept			json
+//	@Produce		json
+//	@Param			payload	body		MFALoginPayload	true	"MFA token and code"
+//	@Success		201		{object}	TokenPair		"Token pair"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		429		{object}	error	"Too many failed attempts for this account"
+//	@Failure		500		{object}	error
+//	@Router			/authentication/mfa [post]
+func (app *application) mfaLoginHandler(w http.ResponseWriter, r *http.Request) {
+	var payload MFALoginPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	jwtToken, err := app.authenticator.ValidateToken(payload.MFAToken)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	claims, _ := jwtToken.Claims.(jwt.MapClaims)
+	if typ, _ := claims["typ"].(string); typ != mfaPendingTokenType {
+		app.unauthorizedErrorResponse(w, r, errors.New("not an mfa token"))
+		return
+	}
+
+	userID, err := subjectFromClaims(claims)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	// MFA tokens are single-use, a used one is on the revocation list
+	revoked, err := app.isTokenRevoked(ctx, claims, userID)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+	if revoked {
+		app.unauthorizedErrorResponse(w, r, errors.New("mfa token has already been used"))
+		return
+	}
+
+	user, err := app.repo.Users.GetByID(ctx, userID)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	// codes are guessed against the same counters as passwords
+	attemptsKey := strings.ToLower(user.Email)
+
+	if app.config.loginLockout.Enabled {
+		status, err := app.loginTracker.Check(ctx, attemptsKey)
+		if err != nil {
+			app.logger.Warn("failed to check login attempts", "error", err)
+		} else if status.Blocked() {
+			app.rateLimitExceededResponse(w, r, retryAfterSeconds(status.RetryAfter))
+			return
+		}
+	}
+
+	settings, err := app.repo.MFA.Get(ctx, user.ID)
+	if err != nil || !settings.Enabled {
+		app.unauthorizedErrorResponse(w, r, errors.New("mfa is not enabled"))
+		return
+	}
+
+	if err := app.verifySecondFactor(ctx, settings, payload.Code, payload.RecoveryCode); err != nil {
+		if errors.Is(err, errInvalidSecondFactor) {
+			app.recordFailedLogin(ctx, attemptsKey, user)
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	exp, err := claims.GetExpirationTime()
+	if err != nil || exp == nil {
+		app.unauthorizedErrorResponse(w, r, errors.New("mfa token has no expiry"))
+		return
+	}
+
+	jti, _ := claims["jti"].(string)
+	if err := app.revocations().Revoke(ctx, jti, exp.Time); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.resetFailedLogins(ctx, attemptsKey)
+
+	tokens, err := app.newTokenPair(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+var errInvalidSecondFactor = errors.New("invalid mfa code")
+
+// verifySecondFactor checks the TOTP code or, if it is empty, consumes the
+// recovery code. Wrong or reused codes yield errInvalidSecondFactor.
+func (app *application) verifySecondFactor(ctx context.Context, settings *repo.MFASettings, totpCode, recoveryCode string) error {
+	if totpCode != "" {
+		step, ok := auth.ValidateTOTP(settings.Secret, totpCode, time.Now())
+		if !ok {
+			return errInvalidSecondFactor
+		}
+
+		err := app.repo.MFA.UseTOTPStep(ctx, settings.UserID, step)
+		if errors.Is(err, repo.ErrTOTPCodeReused) {
+			return errInvalidSecondFactor
+		}
+		return err
+	}
+
+	code := strings.ToLower(strings.TrimSpace(recoveryCode))
+
+	err := app.repo.MFA.UseRecoveryCode(ctx, settings.UserID, hashToken(code))
+	if errors.Is(err, repo.ErrNotFound) {
+		return errInvalidSecondFactor
+	}
+	if err == nil {
+		app.logger.Info("mfa recovery code used", "user_id", settings.UserID)
+	}
+	return err
+}
+
+// newMFAChallenge issues the short-lived token a user with MFA receives after
+// the password step of a login.
+func (app *application) newMFAChallenge(userID int64) (*MFAChallenge, error) {
+	claims := jwt.MapClaims{
+		"jti": uuid.New().String(),
+		"sub": userID,
+		"typ": mfaPendingTokenType,
+		"exp": time.Now().Add(app.config.auth.token.mfaExp).Unix(),
+		"iat": time.Now().Unix(),
+		"nbf": time.Now().Unix(),
+		"iss": app.config.auth.token.iss,
+		"aud": app.config.auth.token.aud,
+	}
+
+	token, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MFAChallenge{
+		MFARequired: true,
+		MFAToken:    token,
+		ExpiresIn:   int64(app.config.auth.token.mfaExp.Seconds()),
+	}, nil
+}
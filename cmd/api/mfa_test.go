@@ -0,0 +1,247 @@
+package main
+
+import (
+	"Go-Microservice/internal/auth"
+	"Go-Microservice/internal/repo"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mfaStore keeps the MFA settings of a single user in memory.
+type mfaStore struct {
+	mu       sync.Mutex
+	secret   string
+	enabled  bool
+	lastStep int64
+	codes    map[string]bool
+}
+
+func (s *mfaStore) Get(ctx context.Context, userID int64) (*repo.MFASettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.secret == "" {
+		return nil, repo.ErrNotFound
+	}
+	return &repo.MFASettings{UserID: userID, Secret: s.secret, Enabled: s.enabled}, nil
+}
+
+func (s *mfaStore) SetSecret(ctx context.Context, userID int64, secret string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.enabled {
+		return repo.ErrConflict
+	}
+	s.secret, s.lastStep = secret, 0
+	return nil
+}
+
+func (s *mfaStore) Enable(ctx context.Context, userID int64, recoveryCodes []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.secret == "" {
+		return repo.ErrNotFound
+	}
+	s.enabled = true
+	s.codes = map[string]bool{}
+	for _, code := range recoveryCodes {
+		s.codes[code] = true
+	}
+	return nil
+}
+
+func (s *mfaStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if step <= s.lastStep {
+		return repo.ErrTOTPCodeReused
+	}
+	s.lastStep = step
+	return nil
+}
+
+func (s *mfaStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.codes[code] {
+		return repo.ErrNotFound
+	}
+	delete(s.codes, code)
+	return nil
+}
+
+func (s *mfaStore) Disable(ctx context.Context, userID int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.secret == "" {
+		return repo.ErrNotFound
+	}
+	s.secret, s.enabled, s.lastStep, s.codes = "", false, 0, nil
+	return nil
+}
+
+func TestMFA(t *testing.T) {
+	app := newTestApplication(t, config{
+		auth: authConfig{token: tokenConfig{exp: time.Minute * 15, mfaExp: time.Minute * 5}},
+	})
+	store := &mfaStore{}
+	app.repo.MFA = store
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(t *testing.T, method, path, token, body string) *http.Response {
+		req, err := http.NewRequest(method, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	challenge := func(t *testing.T) string {
+		c, err := app.newMFAChallenge(1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c.MFAToken
+	}
+
+	var secret string
+	var recoveryCodes []string
+
+	t.Run("should enroll with a new secret", func(t *testing.T) {
+		res := request(t, http.MethodPost, "/v1/users/mfa/enroll", testToken, "")
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct{ Data MFAEnrollment }
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.Secret == "" || body.Data.Secret != store.secret {
+			t.Fatalf("enrolled %q, stored %q", body.Data.Secret, store.secret)
+		}
+		secret = body.Data.Secret
+	})
+
+	t.Run("should not enable MFA with a wrong code", func(t *testing.T) {
+		res := request(t, http.MethodPost, "/v1/users/mfa/verify", testToken, `{"code": "000000"}`)
+		checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("should enable MFA with a code of the secret", func(t *testing.T) {
+		code, _ := auth.TOTPCode(secret, time.Now())
+		res := request(t, http.MethodPost, "/v1/users/mfa/verify", testToken, fmt.Sprintf(`{"code": %q}`, code))
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct{ Data MFARecoveryCodes }
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if len(body.Data.RecoveryCodes) != mfaRecoveryCodes || !store.enabled {
+			t.Fatalf("got %d recovery codes, enabled %v", len(body.Data.RecoveryCodes), store.enabled)
+		}
+		recoveryCodes = body.Data.RecoveryCodes
+	})
+
+	t.Run("should not enroll again once enabled", func(t *testing.T) {
+		res := request(t, http.MethodPost, "/v1/users/mfa/enroll", testToken, "")
+		checkResponseCode(t, http.StatusConflict, res.StatusCode)
+	})
+
+	t.Run("should reject a code used before", func(t *testing.T) {
+		code, _ := auth.TOTPCode(secret, time.Now())
+		body := fmt.Sprintf(`{"mfa_token": %q, "code": %q}`, challenge(t), code)
+
+		res := request(t, http.MethodPost, "/v1/authentication/mfa", "", body)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should log in with a new code once", func(t *testing.T) {
+		code, _ := auth.TOTPCode(secret, time.Now().Add(auth.TOTPPeriod))
+		body := fmt.Sprintf(`{"mfa_token": %q, "code": %q}`, challenge(t), code)
+
+		res := request(t, http.MethodPost, "/v1/authentication/mfa", "", body)
+		checkResponseCode(t, http.StatusCreated, res.StatusCode)
+
+		res = request(t, http.MethodPost, "/v1/authentication/mfa", "", body)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should log in with a recovery code once", func(t *testing.T) {
+		body := fmt.Sprintf(`{"mfa_token": %q, "recovery_code": %q}`, challenge(t), recoveryCodes[0])
+		res := request(t, http.MethodPost, "/v1/authentication/mfa", "", body)
+		checkResponseCode(t, http.StatusCreated, res.StatusCode)
+
+		body = fmt.Sprintf(`{"mfa_token": %q, "recovery_code": %q}`, challenge(t), recoveryCodes[0])
+		res = request(t, http.MethodPost, "/v1/authentication/mfa", "", body)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should only accept MFA tokens", func(t *testing.T) {
+		body := fmt.Sprintf(`{"mfa_token": %q, "recovery_code": %q}`, testToken, recoveryCodes[1])
+		res := request(t, http.MethodPost, "/v1/authentication/mfa", "", body)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should require a code to disable MFA", func(t *testing.T) {
+		res := request(t, http.MethodDelete, "/v1/users/mfa", testToken, "")
+		checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+
+		res = request(t, http.MethodDelete, "/v1/users/mfa", testToken, `{"recovery_code": "aaaaa-bbbbb"}`)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+
+		if !store.enabled {
+			t.Fatal("MFA disabled without a valid code")
+		}
+	})
+
+	t.Run("should disable MFA with a recovery code", func(t *testing.T) {
+		body := fmt.Sprintf(`{"recovery_code": %q}`, recoveryCodes[1])
+		res := request(t, http.MethodDelete, "/v1/users/mfa", testToken, body)
+		checkResponseCode(t, http.StatusNoContent, res.StatusCode)
+
+		if store.enabled || store.secret != "" {
+			t.Fatal("MFA still enabled")
+		}
+
+		res = request(t, http.MethodDelete, "/v1/users/mfa", testToken, "")
+		checkResponseCode(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("should forbid resetting the MFA of others without the permission", func(t *testing.T) {
+		res := request(t, http.MethodDelete, "/v1/users/2/mfa", testToken, "")
+		checkResponseCode(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	t.Run("should let admins reset the MFA of others", func(t *testing.T) {
+		app.repo.Users = &adminUsers{permissions: []string{permUserMFAReset}}
+		defer func() { app.repo.Users = &repo.MockUserStore{} }()
+
+		store.SetSecret(context.Background(), 2, secret)
+		store.Enable(context.Background(), 2, nil)
+
+		res := request(t, http.MethodDelete, "/v1/users/2/mfa", testToken, "")
+		checkResponseCode(t, http.StatusNoContent, res.StatusCode)
+
+		if store.enabled {
+			t.Fatal("MFA still enabled")
+		}
+	})
+}
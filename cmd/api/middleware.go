@@ -1,16 +1,24 @@
 package main
 
 import (
+	"Go-Microservice/internal/breaker"
+	"Go-Microservice/internal/ratelimiter"
 	"Go-Microservice/internal/repo"
+	"Go-Microservice/internal/repo/cache"
 	"context"
 	"encoding/base64"
 	"errors"
 	"fmt"
 	"github.com/go-chi/chi/v5"
 	"github.com/golang-jwt/jwt/v5"
+	"log/slog"
+	"net"
 	"net/http"
+	"slices"
 	"strconv"
 	"strings"
+	"sync/atomic"
+	"time"
 )
 
 func (app *application) BasicAuthMiddleware() func(http.Handler) http.Handler {
@@ -61,11 +69,16 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
+		if len(parts) != 2 || (parts[0] != "Bearer" && parts[0] != "ApiKey") {
 			app.unauthorizedErrorResponse(w, r, fmt.Errorf("authorization header is malformed"))
 			return
 		}
 
+		if parts[0] == "ApiKey" {
+			app.authenticateAPIKey(w, r, next, parts[1])
+			return
+		}
+
 		token := parts[1]
 		jwtToken, err := app.authenticator.ValidateToken(token)
 		if err != nil {
@@ -75,7 +88,13 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		claims, _ := jwtToken.Claims.(jwt.MapClaims)
 
-		userID, err := strconv.ParseInt(fmt.Sprintf("%.f", claims["sub"]), 10, 64)
+		// only access tokens are accepted, e.g. not the token of a pending MFA login
+		if typ, ok := claims["typ"]; ok {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("unexpected token type %v", typ))
+			return
+		}
+
+		userID, err := subjectFromClaims(claims)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
 			return
@@ -83,6 +102,16 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 
 		ctx := r.Context()
 
+		revoked, err := app.isTokenRevoked(ctx, claims, userID)
+		if err != nil {
+			app.unauthorizedErrorResponse(w, r, err)
+			return
+		}
+		if revoked {
+			app.unauthorizedErrorResponse(w, r, fmt.Errorf("token has been revoked"))
+			return
+		}
+
 		user, err := app.getUser(ctx, userID)
 		if err != nil {
 			app.unauthorizedErrorResponse(w, r, err)
@@ -90,11 +119,74 @@ func (app *application) AuthTokenMiddleware(next http.Handler) http.Handler {
 		}
 
 		ctx = context.WithValue(ctx, userCtx, user)
+		ctx = context.WithValue(ctx, tokenClaimsCtx, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	}
 	return handlerFunc
 }
 
+// authenticateAPIKey serves the request as the owner of the API key. Which
+// routes the key may call is decided by requireScope.
+func (app *application) authenticateAPIKey(w http.ResponseWriter, r *http.Request, next http.Handler, secret string) {
+	ctx := r.Context()
+
+	key, err := app.repo.APIKeys.Authenticate(ctx, hashToken(secret))
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	user, err := app.getUser(ctx, key.UserID)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	ctx = context.WithValue(ctx, userCtx, user)
+	ctx = context.WithValue(ctx, apiKeyCtx, key)
+	next.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// requireScope restricts requests authenticated with an API key to keys that
+// were granted scope. Requests authenticated with a JWT pass.
+func (app *application) requireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.hasScope(r, scope) {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// hasScope reports whether the request may act within scope, which is always
+// the case for requests authenticated with a JWT.
+func (app *application) hasScope(r *http.Request, scope string) bool {
+	if key := getAPIKeyFromCtx(r); key != nil && !slices.Contains(key.Scopes, scope) {
+		app.logger.Warn("api key lacks scope", "key_id", key.ID, "scope", scope)
+		return false
+	}
+
+	return true
+}
+
+// requireSession rejects requests authenticated with an API key, for routes
+// that manage the account itself.
+func (app *application) requireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if key := getAPIKeyFromCtx(r); key != nil {
+			app.logger.Warn("api key used on session only route", "key_id", key.ID)
+			app.forbiddenResponse(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 //lint:ignore U1000 middleware function may be used conditionally
 func (app *application) usersContextMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -148,7 +240,9 @@ func (app *application) postsContextMiddleware(next http.Handler) http.Handler {
 	})
 }
 
-func (app *application) checkPostOwnership(requiredRole string, next http.HandlerFunc) http.HandlerFunc {
+// checkPostOwnership lets the author of the post through, and other users
+// only if they hold permission.
+func (app *application) checkPostOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		user := getUserFromContext(r)
 		post := getPostFromCtx(r)
@@ -157,12 +251,60 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 			next.ServeHTTP(w, r)
 			return
 		}
-		allowed, err := app.checkRolePrecedence(r.Context(), user, requiredRole)
+
+		if !app.checkPermission(user, permission) {
+			app.forbiddenResponse(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	}
+}
+
+// commentsContextMiddleware loads the comment of the path, which must be on
+// the post loaded by postsContextMiddleware.
+func (app *application) commentsContextMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.ParseInt(chi.URLParam(r, "commentID"), 10, 64)
 		if err != nil {
-			app.internalServerError(w, r, err)
+			app.badRequestResponse(w, r, fmt.Errorf("invalid comment ID: %w", err))
 			return
 		}
-		if !allowed {
+
+		ctx := r.Context()
+		post := getPostFromCtx(r)
+
+		comment, err := app.repo.Comments.GetByID(ctx, id)
+		if err == nil && comment.PostID != post.ID {
+			err = fmt.Errorf("%w: comment %d on post %d", repo.ErrNotFound, id, post.ID)
+		}
+		if err != nil {
+			switch {
+			case errors.Is(err, repo.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		ctx = context.WithValue(ctx, commentCtx, comment)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// checkCommentOwnership lets the author of the comment through, and other
+// users only if they hold permission.
+func (app *application) checkCommentOwnership(permission string, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user := getUserFromContext(r)
+		comment := getCommentFromCtx(r)
+
+		if comment.UserID == user.ID {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if !app.checkPermission(user, permission) {
 			app.forbiddenResponse(w, r)
 			return
 		}
@@ -170,13 +312,35 @@ func (app *application) checkPostOwnership(requiredRole string, next http.Handle
 	}
 }
 
-func (app *application) checkRolePrecedence(ctx context.Context, user *repo.User, roleName string) (bool, error) {
-	role, err := app.repo.Roles.GetByName(ctx, roleName)
-	if err != nil {
-		return false, err
+// requirePermission only lets authenticated users through whose role was
+// granted permission.
+func (app *application) requirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !app.checkPermission(getUserFromContext(r), permission) {
+				app.forbiddenResponse(w, r)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// checkPermission reports whether the role of user was granted permission.
+// The permissions of a role that requires MFA are withheld from users who
+// have not enabled it.
+func (app *application) checkPermission(user *repo.User, permission string) bool {
+	if !user.Role.HasPermission(permission) {
+		return false
 	}
 
-	return user.Role.Level >= role.Level, nil
+	if user.Role.RequireMFA && !user.MFAEnabled {
+		app.logger.Warn("role requires mfa", "user_id", user.ID, "role", user.Role.Name)
+		return false
+	}
+
+	return true
 }
 
 func (app *application) getUser(ctx context.Context, userID int64) (*repo.User, error) {
@@ -186,7 +350,9 @@ func (app *application) getUser(ctx context.Context, userID int64) (*repo.User,
 
 	user, err := app.cacheStorage.Users.Get(ctx, userID)
 	if err != nil {
-		return nil, err
+		// Redis being down must not lock everyone out
+		app.logger.Warn("failed to read cached user", "user_id", userID, "error", err)
+		return app.repo.Users.GetByID(ctx, userID)
 	}
 
 	if user == nil {
@@ -196,22 +362,216 @@ func (app *application) getUser(ctx context.Context, userID int64) (*repo.User,
 		}
 
 		if err := app.cacheStorage.Users.Set(ctx, user); err != nil {
-			return nil, err
+			app.logger.Warn("failed to cache user", "user_id", userID, "error", err)
 		}
 	}
 
 	return user, nil
 }
 
-func (app *application) rateLimitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if app.config.rateLimiterConfig.Enabled {
-			if allow, retryAfter := app.rateLimiter.Allow(r.RemoteAddr); !allow {
-				app.rateLimitExceededResponse(w, r, retryAfter.String())
+// isTokenRevoked checks the token against the revocation list, which lives in
+// Redis when it is enabled and in Postgres otherwise.
+func (app *application) isTokenRevoked(ctx context.Context, claims jwt.MapClaims, userID int64) (bool, error) {
+	jti, _ := claims["jti"].(string)
+
+	var issuedAt time.Time
+	if iat, err := claims.GetIssuedAt(); err == nil && iat != nil {
+		issuedAt = iat.Time
+	}
+
+	return app.revocations().IsRevoked(ctx, jti, userID, issuedAt)
+}
+
+func (app *application) revocations() repo.RevokedTokensRepository {
+	if !app.config.redisConfig.enabled {
+		return app.repo.RevokedTokens
+	}
+
+	return cachedRevocations{
+		db:         app.repo.RevokedTokens,
+		cache:      app.cacheStorage.Revocations,
+		logger:     app.logger,
+		staleUntil: &app.revocationsStaleUntil,
+		markStale:  app.markRevocationsStale,
+	}
+}
+
+// cachedRevocations writes revocations to both Postgres and Redis, and checks
+// tokens against Redis, falling back to Postgres while Redis is unavailable.
+//
+// Redis misses the revocations written while it was unavailable. Until every
+// token they revoke has expired, tokens Redis accepts are checked against
+// Postgres as well.
+type cachedRevocations struct {
+	db     repo.RevokedTokensRepository
+	cache  cache.RevocationCache
+	logger *slog.Logger
+	// staleUntil is the unix time in nanoseconds up to which Redis may miss
+	// revocations
+	staleUntil *atomic.Int64
+	markStale  func()
+}
+
+func (c cachedRevocations) Revoke(ctx context.Context, jti string, exp time.Time) error {
+	if err := c.db.Revoke(ctx, jti, exp); err != nil {
+		return err
+	}
+	if err := c.cache.Revoke(ctx, jti, exp); err != nil {
+		c.logger.Warn("failed to cache revoked token", "error", err)
+		c.markStale()
+	}
+	return nil
+}
+
+func (c cachedRevocations) RevokeAllForUser(ctx context.Context, userID int64, exp time.Time) error {
+	if err := c.db.RevokeAllForUser(ctx, userID, exp); err != nil {
+		return err
+	}
+	if err := c.cache.RevokeAllForUser(ctx, userID, exp); err != nil {
+		c.logger.Warn("failed to cache revoked tokens", "user_id", userID, "error", err)
+		c.markStale()
+	}
+	return nil
+}
+
+func (c cachedRevocations) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	revoked, err := c.cache.IsRevoked(ctx, jti, userID, issuedAt)
+	if err != nil {
+		c.logger.Warn("failed to check cached revocations", "error", err)
+		return c.db.IsRevoked(ctx, jti, userID, issuedAt)
+	}
+	if !revoked && time.Now().UnixNano() < c.staleUntil.Load() {
+		return c.db.IsRevoked(ctx, jti, userID, issuedAt)
+	}
+	return revoked, nil
+}
+
+func (c cachedRevocations) List(ctx context.Context) ([]repo.Revocation, error) {
+	return c.db.List(ctx)
+}
+
+// markRevocationsStale has tokens checked against Postgres until those
+// revoked so far have expired.
+func (app *application) markRevocationsStale() {
+	until := time.Now().Add(app.config.auth.token.exp).UnixNano()
+	for {
+		current := app.revocationsStaleUntil.Load()
+		if current >= until || app.revocationsStaleUntil.CompareAndSwap(current, until) {
+			return
+		}
+	}
+}
+
+// syncRevocations copies the Postgres revocation list to Redis, which missed
+// the revocations written while it was unavailable.
+func (app *application) syncRevocations(ctx context.Context) {
+	revocations, err := app.repo.RevokedTokens.List(ctx)
+	if err != nil {
+		app.logger.Warn("failed to sync revocations to cache", "error", err)
+		return
+	}
+
+	if err := app.cacheStorage.Revocations.Import(ctx, revocations); err != nil {
+		app.logger.Warn("failed to sync revocations to cache", "error", err)
+	}
+}
+
+// redisBreakerChanged is told about the state changes of the breaker guarding
+// Redis. It is called with the breaker locked, so Redis is called in the
+// background.
+func (app *application) redisBreakerChanged(state string) {
+	app.logger.Warn("Redis circuit breaker changed state", "state", state)
+
+	if state != breaker.Closed {
+		return
+	}
+
+	// other instances may have revoked tokens while Redis was unavailable
+	app.markRevocationsStale()
+	go app.syncRevocations(context.Background())
+
+	// and cached posts may have missed their invalidation
+	go app.flushPostCache(context.Background())
+}
+
+// postCacheFlusher is implemented by cache.PostStore.
+type postCacheFlusher interface {
+	Flush(ctx context.Context) error
+}
+
+// flushPostCache drops every cached post and feed page, if they are cached.
+// Failures are logged only, the cached entries expire either way.
+func (app *application) flushPostCache(ctx context.Context) {
+	posts, ok := app.repo.Posts.(postCacheFlusher)
+	if !ok {
+		return
+	}
+
+	if err := posts.Flush(ctx); err != nil {
+		app.logger.Warn("failed to flush cached posts", "error", err)
+	}
+}
+
+// rateLimit limits the requests to the routes it wraps with policy, as
+// overridden by the configuration. Policies counting by user or API key must
+// come after AuthTokenMiddleware; before it, requests are counted by IP.
+func (app *application) rateLimit(policy ratelimiter.Policy) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		if !app.config.rateLimiterConfig.Enabled {
+			return next
+		}
+
+		// the policies are declared in mount, an invalid one is a bug
+		if err := app.rateLimiter.Register(policy); err != nil {
+			panic(err)
+		}
+
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			subject := ratelimiter.Subject{IP: clientIP(r)}
+			if user := getUserFromContext(r); user != nil {
+				subject.UserID = user.ID
+				subject.Level = user.Role.Level
+			}
+			if key := getAPIKeyFromCtx(r); key != nil {
+				subject.APIKeyID = key.ID
+			}
+
+			result := app.rateLimiter.Allow(policy.Name, subject)
+			setRateLimitHeaders(w, result)
+			if !result.Allowed {
+				app.rateLimitExceededResponse(w, r, retryAfterSeconds(result.RetryAfter))
 				return
 			}
-		}
 
-		next.ServeHTTP(w, r)
-	})
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// setRateLimitHeaders reports the quota left to the client in the RateLimit
+// headers. Requests can count against several policies, the one with the
+// fewest requests remaining is reported.
+func setRateLimitHeaders(w http.ResponseWriter, result ratelimiter.Result) {
+	if result.Limit == 0 {
+		return
+	}
+
+	h := w.Header()
+	if remaining, err := strconv.Atoi(h.Get("RateLimit-Remaining")); err == nil && remaining <= result.Remaining {
+		return
+	}
+
+	h.Set("RateLimit-Limit", strconv.Itoa(result.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(result.Remaining))
+	h.Set("RateLimit-Reset", retryAfterSeconds(result.Reset))
+}
+
+// clientIP returns the IP address of r.RemoteAddr, which holds a port unless
+// middleware.RealIP took the address from a proxy header.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
 }
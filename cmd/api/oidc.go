@@ -0,0 +1,312 @@
+package main
+
+import (
+	"Go-Microservice/internal/auth"
+	"Go-Microservice/internal/repo"
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// oidcStateTokenType marks the token kept in the state cookie between the
+// redirect to the identity provider and the callback.
+const oidcStateTokenType = "oidc_state"
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcStateExp    = 10 * time.Minute
+)
+
+var (
+	errOIDCUnverifiedEmail = errors.New("identity provider did not verify the email address")
+	usernameDisallowed     = regexp.MustCompile(`[^a-zA-Z0-9_.-]+`)
+)
+
+// oidcStartHandler godoc
+//
+//	@Summary		Starts an external login
+//	@Description	Redirects to the identity provider, using the authorization code flow with PKCE.
+//	@Description	The provider sends the user back to /authentication/oidc/{provider}/callback.
+//	@Tags			authentication
+//	@Param			provider	path	string	true	"Provider name, e.g. google"
+//	@Success		302			"Redirect to the identity provider"
+//	@Failure		404			{object}	error	"Unknown provider"
+//	@Failure		500			{object}	error
+//	@Router			/authentication/oidc/{provider}/start [get]
+func (app *application) oidcStartHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r, errors.New("unknown oidc provider"))
+		return
+	}
+
+	state, err := auth.RandomToken(16)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	nonce, err := auth.RandomToken(16)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	verifier, err := auth.RandomToken(32)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"jti":   uuid.New().String(),
+		"typ":   oidcStateTokenType,
+		"prv":   provider.Name(),
+		"state": state,
+		"nonce": nonce,
+		"cv":    verifier,
+		"exp":   time.Now().Add(oidcStateExp).Unix(),
+		"iat":   time.Now().Unix(),
+		"nbf":   time.Now().Unix(),
+		"iss":   app.config.auth.token.iss,
+		"aud":   app.config.auth.token.aud,
+	}
+
+	stateToken, err := app.authenticator.GenerateToken(claims)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	http.SetCookie(w, app.oidcStateCookie(provider.Name(), stateToken, int(oidcStateExp.Seconds())))
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler godoc
+//
+//	@Summary		Completes an external login
+//	@Description	Exchanges the authorization code for the identity of the user. Unknown identities
+//	@Description	are linked to the user with the same verified email, or get a new activated account.
+//	@Description	Returns a token pair, or an MFA token for users with MFA enabled.
+//	@Tags			authentication
+//	@Produce		json
+//	@Param			provider	path		string			true	"Provider name, e.g. google"
+//	@Param			code		query		string			true	"Authorization code"
+//	@Param			state		query		string			true	"State of the authorization request"
+//	@Success		201			{object}	TokenPair		"Token pair"
+//	@Success		202			{object}	MFAChallenge	"Second factor required"
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error	"Unknown provider"
+//	@Failure		409			{object}	error	"Email belongs to an account that is not activated"
+//	@Failure		500			{object}	error
+//	@Router			/authentication/oidc/{provider}/callback [get]
+func (app *application) oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := app.oidcProviders[chi.URLParam(r, "provider")]
+	if !ok {
+		app.notFoundResponse(w, r, errors.New("unknown oidc provider"))
+		return
+	}
+
+	// the state cookie is single-use
+	http.SetCookie(w, app.oidcStateCookie(provider.Name(), "", -1))
+
+	q := r.URL.Query()
+	if errCode := q.Get("error"); errCode != "" {
+		app.unauthorizedErrorResponse(w, r, fmt.Errorf("identity provider returned %s", errCode))
+		return
+	}
+
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	stateToken, err := app.authenticator.ValidateToken(cookie.Value)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	claims, _ := stateToken.Claims.(jwt.MapClaims)
+	typ, _ := claims["typ"].(string)
+	prv, _ := claims["prv"].(string)
+	state, _ := claims["state"].(string)
+	nonce, _ := claims["nonce"].(string)
+	verifier, _ := claims["cv"].(string)
+
+	if typ != oidcStateTokenType || prv != provider.Name() || state == "" ||
+		subtle.ConstantTimeCompare([]byte(state), []byte(q.Get("state"))) != 1 {
+		app.unauthorizedErrorResponse(w, r, errors.New("oidc state mismatch"))
+		return
+	}
+
+	ctx := r.Context()
+
+	identity, err := provider.Exchange(ctx, q.Get("code"), verifier, nonce)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	userID, err := app.resolveOIDCUser(ctx, provider.Name(), identity)
+	if err != nil {
+		switch {
+		case errors.Is(err, errOIDCUnverifiedEmail):
+			app.unauthorizedErrorResponse(w, r, err)
+		case errors.Is(err, repo.ErrDuplicateEmail):
+			app.conflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.repo.Users.GetByID(ctx, userID)
+	if err != nil {
+		app.unauthorizedErrorResponse(w, r, err)
+		return
+	}
+
+	app.logger.Info("oidc login", "provider", provider.Name(), "user_id", user.ID)
+
+	// the second factor is not delegated to the identity provider
+	if user.MFAEnabled {
+		challenge, err := app.newMFAChallenge(user.ID)
+		if err != nil {
+			app.internalServerError(w, r, err)
+			return
+		}
+
+		if err := app.jsonResponse(w, http.StatusAccepted, challenge); err != nil {
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	tokens, err := app.newTokenPair(ctx, user.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusCreated, tokens); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// resolveOIDCUser returns the user linked to the external identity. A new
+// identity is linked to the active user with the same email, or otherwise
+// gets a new account, but only if the provider verified the email.
+func (app *application) resolveOIDCUser(ctx context.Context, provider string, identity *auth.OIDCIdentity) (int64, error) {
+	userID, err := app.repo.Identities.GetUserID(ctx, provider, identity.Subject)
+	if err == nil || !errors.Is(err, repo.ErrNotFound) {
+		return userID, err
+	}
+
+	if identity.Email == "" || !identity.EmailVerified {
+		return 0, errOIDCUnverifiedEmail
+	}
+
+	link := &repo.Identity{
+		Provider: provider,
+		Subject:  identity.Subject,
+		Email:    identity.Email,
+	}
+
+	existing, err := app.repo.Users.GetByEmail(ctx, identity.Email)
+	switch {
+	case err == nil:
+		link.UserID = existing.ID
+		if err := app.repo.Identities.Link(ctx, link); err != nil {
+			return 0, err
+		}
+		app.logger.Info("oidc identity linked", "provider", provider, "user_id", existing.ID)
+		return existing.ID, nil
+	case !errors.Is(err, repo.ErrNotFound):
+		return 0, err
+	}
+
+	role, err := app.repo.Roles.GetByName(ctx, "user")
+	if err != nil {
+		return 0, err
+	}
+
+	// nobody knows the password, it can be set through the reset flow
+	password, err := auth.RandomToken(32)
+	if err != nil {
+		return 0, err
+	}
+
+	username := oidcUsername(identity)
+	for attempt := 0; ; attempt++ {
+		user := &repo.User{
+			Username: username,
+			Email:    identity.Email,
+			RoleID:   role.ID,
+		}
+		if err := user.Password.Set(password); err != nil {
+			return 0, err
+		}
+
+		err := app.repo.Identities.CreateUser(ctx, user, link)
+		if errors.Is(err, repo.ErrDuplicateUsername) && attempt < 3 {
+			suffix, err := auth.RandomToken(3)
+			if err != nil {
+				return 0, err
+			}
+			username = fmt.Sprintf("%s-%s", oidcUsername(identity), strings.ToLower(suffix))
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+
+		app.logger.Info("user created from oidc identity", "provider", provider, "user_id", user.ID)
+		return user.ID, nil
+	}
+}
+
+// oidcUsername derives a username from the preferred username of the identity
+// or the local part of its email.
+func oidcUsername(identity *auth.OIDCIdentity) string {
+	name := identity.PreferredUsername
+	if name == "" {
+		name, _, _ = strings.Cut(identity.Email, "@")
+	}
+
+	name = usernameDisallowed.ReplaceAllString(name, "")
+	if name == "" {
+		name = "user"
+	}
+	if len(name) > 80 {
+		name = name[:80]
+	}
+
+	return name
+}
+
+func (app *application) oidcStateCookie(provider, value string, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     oidcStateCookie,
+		Value:    value,
+		Path:     "/v1/authentication/oidc/" + provider,
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   app.config.env != "development",
+		SameSite: http.SameSiteLaxMode,
+	}
+}
@@ -0,0 +1,390 @@
+package main
+
+import (
+	"Go-Microservice/internal/auth"
+	"Go-Microservice/internal/repo"
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// oidcIdP is an identity provider that signs in whoever it is told to.
+type oidcIdP struct {
+	*httptest.Server
+	signer *auth.KeySetAuthenticator
+	code   string
+	// identity holds the claims of the next ID token
+	identity auth.OIDCIdentity
+	// nonce and challenge are sent to the authorization endpoint
+	nonce, challenge string
+}
+
+func newOIDCIdP(t *testing.T) *oidcIdP {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signer, err := auth.NewKeySetAuthenticator([]auth.SigningKey{{ID: "idp-1", Private: key}}, "idp-1", 0, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &oidcIdP{signer: signer, code: "test-code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(signer.JWKS())
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != idp.code || auth.PKCEChallenge(r.PostFormValue("code_verifier")) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		idToken, err := signer.GenerateToken(jwt.MapClaims{
+			"iss":                idp.URL,
+			"aud":                r.PostFormValue("client_id"),
+			"sub":                idp.identity.Subject,
+			"exp":                time.Now().Add(time.Minute).Unix(),
+			"iat":                time.Now().Unix(),
+			"nonce":              idp.nonce,
+			"email":              idp.identity.Email,
+			"email_verified":     idp.identity.EmailVerified,
+			"preferred_username": idp.identity.PreferredUsername,
+		})
+		if err != nil {
+			t.Error(err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// oidcUsers keeps users in memory, looked up by id or email.
+type oidcUsers struct {
+	repo.MockUserStore
+	mu    sync.Mutex
+	users map[int64]*repo.User
+}
+
+func (s *oidcUsers) GetByID(ctx context.Context, userID int64) (*repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	user, ok := s.users[userID]
+	if !ok {
+		return nil, repo.ErrNotFound
+	}
+	return user, nil
+}
+
+func (s *oidcUsers) GetByEmail(ctx context.Context, email string) (*repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, repo.ErrNotFound
+}
+
+// oidcIdentities links identities to the users of an oidcUsers.
+type oidcIdentities struct {
+	users *oidcUsers
+	links map[string]int64
+}
+
+func (s *oidcIdentities) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	userID, ok := s.links[provider+":"+subject]
+	if !ok {
+		return 0, repo.ErrNotFound
+	}
+	return userID, nil
+}
+
+func (s *oidcIdentities) Link(ctx context.Context, identity *repo.Identity) error {
+	key := identity.Provider + ":" + identity.Subject
+	if _, ok := s.links[key]; ok {
+		return repo.ErrConflict
+	}
+	s.links[key] = identity.UserID
+	return nil
+}
+
+func (s *oidcIdentities) CreateUser(ctx context.Context, user *repo.User, identity *repo.Identity) error {
+	s.users.mu.Lock()
+	defer s.users.mu.Unlock()
+
+	for _, u := range s.users.users {
+		if u.Username == user.Username {
+			return repo.ErrDuplicateUsername
+		}
+	}
+
+	user.ID = int64(len(s.users.users) + 1)
+	user.IsActive = true
+	s.users.users[user.ID] = user
+
+	identity.UserID = user.ID
+	s.links[identity.Provider+":"+identity.Subject] = user.ID
+	return nil
+}
+
+// oidcRoles knows every role by name.
+type oidcRoles struct {
+	repo.RoleRepository
+}
+
+func (oidcRoles) GetByName(ctx context.Context, slug string) (*repo.Role, error) {
+	return &repo.Role{ID: 1, Name: slug}, nil
+}
+
+// newOIDCTestApplication returns an application signing in with the provider
+// "stub", backed by idp, and the users it knows.
+func newOIDCTestApplication(t *testing.T, idp *oidcIdP) (*application, *oidcIdentities) {
+	t.Helper()
+
+	app := newTestApplication(t, config{
+		auth: authConfig{token: tokenConfig{exp: time.Minute * 15, mfaExp: time.Minute * 5}},
+	})
+
+	users := &oidcUsers{users: map[int64]*repo.User{}}
+	identities := &oidcIdentities{users: users, links: map[string]int64{}}
+	app.repo.Users = users
+	app.repo.Identities = identities
+	app.repo.Roles = oidcRoles{}
+
+	app.oidcProviders = map[string]*auth.OIDCProvider{
+		"stub": auth.NewOIDCProvider(auth.OIDCConfig{
+			Name:        "stub",
+			Issuer:      idp.URL,
+			ClientID:    "client-1",
+			RedirectURL: "http://localhost/v1/authentication/oidc/stub/callback",
+		}, idp.Client()),
+	}
+
+	return app, identities
+}
+
+func TestOIDCLogin(t *testing.T) {
+	idp := newOIDCIdP(t)
+	app, identities := newOIDCTestApplication(t, idp)
+	users := identities.users
+	mux := app.mount()
+
+	get := func(t *testing.T, path string, cookies ...*http.Cookie) *http.Response {
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, cookie := range cookies {
+			req.AddCookie(cookie)
+		}
+		return executeRequest(req, mux).Result()
+	}
+
+	// start redirects to the provider and returns the state of the request
+	// with the state cookie
+	start := func(t *testing.T) (string, *http.Cookie) {
+		t.Helper()
+
+		res := get(t, "/v1/authentication/oidc/stub/start")
+		checkResponseCode(t, http.StatusFound, res.StatusCode)
+
+		authURL, err := url.Parse(res.Header.Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.HasPrefix(authURL.String(), idp.URL+"/authorize") {
+			t.Fatalf("redirected to %s", authURL)
+		}
+
+		q := authURL.Query()
+		idp.nonce, idp.challenge = q.Get("nonce"), q.Get("code_challenge")
+
+		for _, cookie := range res.Cookies() {
+			if cookie.Name == oidcStateCookie {
+				return q.Get("state"), cookie
+			}
+		}
+		t.Fatal("no state cookie set")
+		return "", nil
+	}
+
+	callback := func(t *testing.T) *http.Response {
+		t.Helper()
+
+		state, cookie := start(t)
+		return get(t, "/v1/authentication/oidc/stub/callback?code="+idp.code+"&state="+url.QueryEscape(state), cookie)
+	}
+
+	t.Run("should not know other providers", func(t *testing.T) {
+		res := get(t, "/v1/authentication/oidc/other/start")
+		checkResponseCode(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("should create an account for a new verified identity", func(t *testing.T) {
+		idp.identity = auth.OIDCIdentity{Subject: "ext-1", Email: "jane@example.com", EmailVerified: true, PreferredUsername: "jane doe"}
+
+		res := callback(t)
+		checkResponseCode(t, http.StatusCreated, res.StatusCode)
+
+		var body struct{ Data TokenPair }
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if body.Data.AccessToken == "" || body.Data.RefreshToken == "" {
+			t.Errorf("got token pair %+v", body.Data)
+		}
+
+		user, err := users.GetByEmail(context.Background(), "jane@example.com")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if user.Username != "janedoe" || identities.links["stub:ext-1"] != user.ID {
+			t.Errorf("created %q, linked to %d", user.Username, identities.links["stub:ext-1"])
+		}
+	})
+
+	t.Run("should sign in a linked identity again", func(t *testing.T) {
+		res := callback(t)
+		checkResponseCode(t, http.StatusCreated, res.StatusCode)
+
+		if len(users.users) != 1 {
+			t.Errorf("got %d users, want 1", len(users.users))
+		}
+	})
+
+	t.Run("should reject an unverified email", func(t *testing.T) {
+		idp.identity = auth.OIDCIdentity{Subject: "ext-2", Email: "john@example.com"}
+
+		res := callback(t)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should ask users with MFA for the second factor", func(t *testing.T) {
+		users.users[10] = &repo.User{ID: 10, Email: "mfa@example.com", MFAEnabled: true}
+		idp.identity = auth.OIDCIdentity{Subject: "ext-3", Email: "mfa@example.com", EmailVerified: true}
+
+		res := callback(t)
+		checkResponseCode(t, http.StatusAccepted, res.StatusCode)
+
+		var body struct{ Data MFAChallenge }
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if !body.Data.MFARequired || body.Data.MFAToken == "" {
+			t.Errorf("got challenge %+v", body.Data)
+		}
+	})
+
+	t.Run("should reject a callback for another state", func(t *testing.T) {
+		_, cookie := start(t)
+
+		res := get(t, "/v1/authentication/oidc/stub/callback?code="+idp.code+"&state=forged", cookie)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should reject a callback without the state cookie", func(t *testing.T) {
+		state, _ := start(t)
+
+		res := get(t, "/v1/authentication/oidc/stub/callback?code="+idp.code+"&state="+url.QueryEscape(state))
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+
+	t.Run("should reject errors of the provider", func(t *testing.T) {
+		state, cookie := start(t)
+
+		res := get(t, "/v1/authentication/oidc/stub/callback?error=access_denied&state="+url.QueryEscape(state), cookie)
+		checkResponseCode(t, http.StatusUnauthorized, res.StatusCode)
+	})
+}
+
+func TestResolveOIDCUser(t *testing.T) {
+	ctx := context.Background()
+	idp := newOIDCIdP(t)
+
+	t.Run("should return the user linked to the identity", func(t *testing.T) {
+		app, identities := newOIDCTestApplication(t, idp)
+		identities.links["stub:ext-1"] = 7
+
+		// the email is not needed anymore once linked
+		userID, err := app.resolveOIDCUser(ctx, "stub", &auth.OIDCIdentity{Subject: "ext-1"})
+		if err != nil || userID != 7 {
+			t.Errorf("resolveOIDCUser() = %d, %v, want 7", userID, err)
+		}
+	})
+
+	t.Run("should link the user with the same email", func(t *testing.T) {
+		app, identities := newOIDCTestApplication(t, idp)
+		identities.users.users[3] = &repo.User{ID: 3, Email: "jane@example.com"}
+
+		userID, err := app.resolveOIDCUser(ctx, "stub", &auth.OIDCIdentity{Subject: "ext-1", Email: "jane@example.com", EmailVerified: true})
+		if err != nil || userID != 3 {
+			t.Fatalf("resolveOIDCUser() = %d, %v, want 3", userID, err)
+		}
+		if identities.links["stub:ext-1"] != 3 {
+			t.Errorf("linked to %d, want 3", identities.links["stub:ext-1"])
+		}
+	})
+
+	t.Run("should not link or create users for unverified emails", func(t *testing.T) {
+		app, identities := newOIDCTestApplication(t, idp)
+		identities.users.users[3] = &repo.User{ID: 3, Email: "jane@example.com"}
+
+		for _, identity := range []*auth.OIDCIdentity{
+			{Subject: "ext-1", Email: "jane@example.com"},
+			{Subject: "ext-2", Email: "john@example.com"},
+			{Subject: "ext-3", EmailVerified: true},
+		} {
+			if _, err := app.resolveOIDCUser(ctx, "stub", identity); !errors.Is(err, errOIDCUnverifiedEmail) {
+				t.Errorf("resolveOIDCUser(%+v) = %v, want errOIDCUnverifiedEmail", identity, err)
+			}
+		}
+		if len(identities.links) != 0 || len(identities.users.users) != 1 {
+			t.Errorf("got %d links and %d users", len(identities.links), len(identities.users.users))
+		}
+	})
+
+	t.Run("should pick another username if taken", func(t *testing.T) {
+		app, identities := newOIDCTestApplication(t, idp)
+		identities.users.users[1] = &repo.User{ID: 1, Username: "jane", Email: "other@example.com"}
+
+		userID, err := app.resolveOIDCUser(ctx, "stub", &auth.OIDCIdentity{Subject: "ext-1", Email: "jane@example.com", EmailVerified: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		user := identities.users.users[userID]
+		if !strings.HasPrefix(user.Username, "jane-") || user.Email != "jane@example.com" {
+			t.Errorf("created %q with %q", user.Username, user.Email)
+		}
+	})
+}
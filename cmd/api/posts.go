@@ -4,9 +4,6 @@ import (
 	"Go-Microservice/internal/repo"
 	"errors"
 	"net/http"
-	"strconv"
-
-	"github.com/go-chi/chi/v5"
 )
 
 type contextKey string
@@ -61,6 +58,8 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 		return
 	}
 
+	app.fanOutPost(ctx, post)
+
 	if err := app.jsonResponse(w, http.StatusCreated, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
@@ -72,11 +71,15 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 //	@Summary		Get post by ID
 //	@Description	Retrieve detailed information about a specific post including all associated comments
 //	@Description	Returns the complete post object with nested comments and user information
+//	@Description	The ETag header identifies the response; send it back in If-None-Match to get 304 when
+//	@Description	nothing changed, or in If-Match to update or delete the post only if it was not changed.
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			postID	path		int64				true	"Post ID to retrieve"
-//	@Success		200		{object}	repo.Post			"Post details with comments retrieved successfully"
+//	@Param			postID			path		int64				true	"Post ID to retrieve"
+//	@Param			If-None-Match	header		string				false	"ETag of a previous response"
+//	@Success		200				{object}	repo.Post			"Post details with comments retrieved successfully"
+//	@Success		304				"Post not modified"
 //	@Failure		400		{object}	map[string]string	"Invalid post ID format"
 //	@Failure		404		{object}	map[string]string	"Post not found"
 //	@Failure		500		{object}	map[string]string	"Internal server error"
@@ -84,14 +87,26 @@ func (app *application) createPostHandler(w http.ResponseWriter, r *http.Request
 func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
-	comments, err := app.repo.Comments.GetByPostID(r.Context(), post.ID)
+	comments, err := app.repo.Comments.GetThread(r.Context(), post.ID, repo.CommentQuery{Limit: embeddedComments, Depth: 1})
 	if err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
-	post.Comments = comments
+	if err := app.attachCommentReactionCounts(r.Context(), comments.Comments); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	post.Comments = comments.Comments
+	post.CommentsNextCursor = comments.NextCursor
 
-	if err := app.jsonResponse(w, http.StatusOK, post); err != nil {
+	reactions, err := app.getReactionCounts(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	post.Reactions = reactions
+
+	if err := app.taggedJSONResponse(w, r, http.StatusOK, post.Version, post); err != nil {
 		app.internalServerError(w, r, err)
 		return
 	}
@@ -100,31 +115,34 @@ func (app *application) getPostHandler(w http.ResponseWriter, r *http.Request) {
 // DeletePost removes a post from the system
 //
 //	@Summary		Delete a post
-//	@Description	Permanently delete a post and all associated data including comments
-//	@Description	This action cannot be undone. Only the post owner can delete their posts.
+//	@Description	Delete a post together with its comments. The post can be restored by an admin until it is
+//	@Description	purged after the retention period. Only the post owner can delete their posts.
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			postID	path	int64	true	"Post ID to delete"
-//	@Success		204		"Post deleted successfully (no content returned)"
+//	@Param			postID		path	int64	true	"Post ID to delete"
+//	@Param			If-Match	header	string	false	"ETag of the post, to delete it only if it was not changed"
+//	@Success		204			"Post deleted successfully (no content returned)"
 //	@Failure		400		{object}	map[string]string	"Invalid post ID format"
 //	@Failure		404		{object}	map[string]string	"Post not found"
+//	@Failure		409		{object}	map[string]string	"Post was changed concurrently"
+//	@Failure		412		{object}	map[string]string	"Post was changed since the ETag was issued"
+//	@Failure		428		{object}	map[string]string	"If-Match header is required"
 //	@Failure		500		{object}	map[string]string	"Internal server error"
 //	@Router			/v1/posts/{postID} [delete]
 func (app *application) deletePostHandler(w http.ResponseWriter, r *http.Request) {
-	idParam := chi.URLParam(r, "postID")
-	id, err := strconv.ParseInt(idParam, 10, 64)
-	if err != nil {
-		app.internalServerError(w, r, err)
+	post := getPostFromCtx(r)
+
+	if !app.checkIfMatch(w, r, "post", post.ID, post.Version) {
 		return
 	}
 
-	ctx := r.Context()
-
-	if err := app.repo.Posts.Delete(ctx, id); err != nil {
+	if err := app.repo.Posts.Delete(r.Context(), post); err != nil {
 		switch {
 		case errors.Is(err, repo.ErrNotFound):
 			app.notFoundResponse(w, r, err)
+		case errors.Is(err, repo.ErrEditConflict):
+			app.editConflictResponse(w, r, err)
 		default:
 
 			app.internalServerError(w, r, err)
@@ -141,23 +159,33 @@ type UpdatePostPayload struct {
 	Tags    []string `json:"tags"`
 }
 
-// DeletePost removes a post from the system
+// UpdatePost changes the title, content or tags of a post
 //
-//	@Summary		Delete a post
-//	@Description	Permanently delete a post and all associated data including comments
-//	@Description	This action cannot be undone. Only the post owner can delete their posts.
+//	@Summary		Update a post
+//	@Description	Update the fields of a post present in the payload. The previous version is kept in the
+//	@Description	post's revisions. Send the ETag of the post in If-Match to update it only if it was not
+//	@Description	changed meanwhile. Only the post owner can update their posts.
 //	@Tags			posts
 //	@Accept			json
 //	@Produce		json
-//	@Param			postID	path	int64	true	"Post ID to delete"
-//	@Success		204		"Post deleted successfully (no content returned)"
-//	@Failure		400		{object}	map[string]string	"Invalid post ID format"
-//	@Failure		404		{object}	map[string]string	"Post not found"
-//	@Failure		500		{object}	map[string]string	"Internal server error"
-//	@Router			/v1/posts/{postID} [delete]
+//	@Param			postID		path		int64				true	"Post ID to update"
+//	@Param			If-Match	header		string				false	"ETag of the post"
+//	@Param			post		body		UpdatePostPayload	true	"Fields to update"
+//	@Success		200			{object}	repo.Post			"Updated post"
+//	@Failure		400			{object}	map[string]string	"Invalid request payload"
+//	@Failure		404			{object}	map[string]string	"Post not found"
+//	@Failure		409			{object}	map[string]string	"Post was changed concurrently"
+//	@Failure		412			{object}	map[string]string	"Post was changed since the ETag was issued"
+//	@Failure		428			{object}	map[string]string	"If-Match header is required"
+//	@Failure		500			{object}	map[string]string	"Internal server error"
+//	@Router			/v1/posts/{postID} [patch]
 func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request) {
 	post := getPostFromCtx(r)
 
+	if !app.checkIfMatch(w, r, "post", post.ID, post.Version) {
+		return
+	}
+
 	var payload UpdatePostPayload
 
 	if err := readJSON(w, r, &payload); err != nil {
@@ -183,10 +211,20 @@ func (app *application) updatePostHandler(w http.ResponseWriter, r *http.Request
 	}
 
 	if err := app.repo.Posts.Update(r.Context(), post); err != nil {
-		app.internalServerError(w, r, err)
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		case errors.Is(err, repo.ErrEditConflict):
+			app.editConflictResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
 		return
 	}
 
+	if err := app.taggedJSONResponse(w, r, http.StatusOK, post.Version, post); err != nil {
+		app.internalServerError(w, r, err)
+	}
 }
 
 func getPostFromCtx(r *http.Request) *repo.Post {
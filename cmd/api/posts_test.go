@@ -0,0 +1,73 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPostETags(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(t *testing.T, mux http.Handler, method, body string, header http.Header) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(method, "/v1/posts/1", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range header {
+			req.Header[k] = v
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Result()
+	}
+
+	res := request(t, mux, http.MethodGet, "", nil)
+	checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+	etag := res.Header.Get("ETag")
+	if !strings.HasPrefix(etag, `"0-`) {
+		t.Fatalf("unexpected ETag %q", etag)
+	}
+
+	t.Run("should respond not modified to a matching If-None-Match", func(t *testing.T) {
+		res := request(t, mux, http.MethodGet, "", http.Header{"If-None-Match": {`"other", ` + etag}})
+		checkResponseCode(t, http.StatusNotModified, res.StatusCode)
+	})
+
+	t.Run("should reject changes to another version", func(t *testing.T) {
+		res := request(t, mux, http.MethodPatch, `{"title":"New title"}`, http.Header{"If-Match": {`"3-0123456789abcdef"`}})
+		checkResponseCode(t, http.StatusPreconditionFailed, res.StatusCode)
+
+		res = request(t, mux, http.MethodDelete, "", http.Header{"If-Match": {"W/" + etag}})
+		checkResponseCode(t, http.StatusPreconditionFailed, res.StatusCode)
+	})
+
+	t.Run("should update the matching version", func(t *testing.T) {
+		res := request(t, mux, http.MethodPatch, `{"title":"New title"}`, http.Header{"If-Match": {etag}})
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		if got := res.Header.Get("ETag"); !strings.HasPrefix(got, `"1-`) {
+			t.Errorf("unexpected ETag %q", got)
+		}
+	})
+
+	t.Run("should require If-Match when configured", func(t *testing.T) {
+		app := newTestApplication(t, config{requireIfMatch: true})
+		mux := app.mount()
+
+		res := request(t, mux, http.MethodDelete, "", nil)
+		checkResponseCode(t, http.StatusPreconditionRequired, res.StatusCode)
+
+		res = request(t, mux, http.MethodDelete, "", http.Header{"If-Match": {etag}})
+		checkResponseCode(t, http.StatusNoContent, res.StatusCode)
+	})
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"Go-Microservice/internal/ranking"
+	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var errRankedFeedCursor = errors.New("the ranked feed is paged with offset, not cursor")
+
+// getRankedFeedPage ranks the newest posts of the feed of a user for the user
+// and returns the page of fq. The ranked feed is paged with fq.Offset, as the
+// order changes over time.
+func (app *application) getRankedFeedPage(ctx context.Context, userID int64, fq repo.PaginatedFeedQuery) (*repo.FeedPage, error) {
+	cq := fq
+	cq.Limit = app.config.ranking.candidates
+	cq.Offset = 0
+	cq.Sort = "desc"
+	cq.Cursor = nil
+
+	candidates, err := app.getFeedPage(ctx, userID, cq)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
+	signals, err := app.repo.FeedSignals.Get(ctx, userID, now.Add(-app.config.ranking.activityWindow))
+	if err != nil {
+		return nil, err
+	}
+
+	ranked, err := rankPosts(ranking.NewScorer(app.config.ranking.weights), candidates.Posts, signals, now)
+	if err != nil {
+		return nil, err
+	}
+
+	start := min(fq.Offset, len(ranked))
+	end := min(start+fq.Limit, len(ranked))
+
+	return &repo.FeedPage{Posts: ranked[start:end]}, nil
+}
+
+// rankPosts orders posts by their score for the reader with signals.
+func rankPosts(scorer *ranking.Scorer, posts []repo.PostWithMetadata, signals *repo.FeedSignals, now time.Time) ([]repo.PostWithMetadata, error) {
+	byID := make(map[int64]repo.PostWithMetadata, len(posts))
+	candidates := make([]ranking.Candidate, len(posts))
+	for i, p := range posts {
+		createdAt, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to rank post %d: %w", p.ID, err)
+		}
+
+		candidates[i] = ranking.Candidate{
+			PostID:    p.ID,
+			AuthorID:  p.UserID,
+			CreatedAt: createdAt,
+			Comments:  p.CommentsCount,
+			Tags:      p.Tags,
+		}
+		byID[p.ID] = p
+	}
+
+	scored := scorer.Rank(candidates, signals, now)
+
+	ranked := make([]repo.PostWithMetadata, len(scored))
+	for i, s := range scored {
+		ranked[i] = byID[s.PostID]
+	}
+
+	return ranked, nil
+}
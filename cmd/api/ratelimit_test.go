@@ -0,0 +1,136 @@
+package main
+
+import (
+	"Go-Microservice/internal/ratelimiter"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func TestRateLimitPolicies(t *testing.T) {
+	cfg := config{
+		rateLimiterConfig: ratelimiter.Config{
+			Enabled:              true,
+			RequestsPerTimeFrame: 2,
+			TimeFrame:            time.Minute,
+			Policies:             map[string]ratelimiter.Policy{"auth": {Limit: 1}},
+		},
+	}
+
+	app := newTestApplication(t, cfg)
+	app.rateLimiter = ratelimiter.NewEngine(cfg.rateLimiterConfig, nil)
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	send := func(t *testing.T, method, path, ip string, authenticated bool) *httptest.ResponseRecorder {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("X-Real-IP", ip)
+		if authenticated {
+			req.Header.Set("Authorization", "Bearer "+testToken)
+		}
+
+		return executeRequest(req, mux)
+	}
+	request := func(t *testing.T, method, path, ip string, authenticated bool) int {
+		t.Helper()
+		return send(t, method, path, ip, authenticated).Code
+	}
+
+	t.Run("should limit users wherever they connect from", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodGet, "/v1/posts/1", "10.0.0.1", true))
+		checkResponseCode(t, http.StatusOK, request(t, http.MethodGet, "/v1/posts/1", "10.0.0.2", true))
+
+		rr := send(t, http.MethodGet, "/v1/posts/1", "10.0.0.3", true)
+		checkResponseCode(t, http.StatusTooManyRequests, rr.Code)
+
+		if retryAfter, err := strconv.Atoi(rr.Header().Get("Retry-After")); err != nil || retryAfter < 1 || retryAfter > 60 {
+			t.Errorf("invalid Retry-After %q", rr.Header().Get("Retry-After"))
+		}
+	})
+
+	t.Run("should report the quota left", func(t *testing.T) {
+		rr := send(t, http.MethodGet, "/v1/posts/1", "10.0.0.1", true)
+
+		want := map[string]string{"RateLimit-Limit": "2", "RateLimit-Remaining": "0"}
+		for header, value := range want {
+			if got := rr.Header().Get(header); got != value {
+				t.Errorf("%s = %q, want %q", header, got, value)
+			}
+		}
+		if reset, err := strconv.Atoi(rr.Header().Get("RateLimit-Reset")); err != nil || reset < 1 || reset > 60 {
+			t.Errorf("invalid RateLimit-Reset %q", rr.Header().Get("RateLimit-Reset"))
+		}
+	})
+
+	t.Run("should limit anonymous routes by IP with their own policy", func(t *testing.T) {
+		if code := request(t, http.MethodPost, "/v1/authentication/token", "10.0.0.1", false); code == http.StatusTooManyRequests {
+			t.Fatal("first login attempt throttled")
+		}
+		checkResponseCode(t, http.StatusTooManyRequests, request(t, http.MethodPost, "/v1/authentication/token", "10.0.0.1", false))
+
+		if code := request(t, http.MethodPost, "/v1/authentication/token", "10.0.0.2", false); code == http.StatusTooManyRequests {
+			t.Fatal("login attempt from another IP throttled")
+		}
+	})
+	t.Run("should limit public routes by IP", func(t *testing.T) {
+		for _, path := range []string{"/.well-known/jwks.json", "/v1/swagger/index.html"} {
+			if code := request(t, http.MethodGet, path, "10.0.0.5", false); code == http.StatusTooManyRequests {
+				t.Fatalf("first request to %s throttled", path)
+			}
+		}
+		checkResponseCode(t, http.StatusTooManyRequests, request(t, http.MethodGet, "/v1/health", "10.0.0.5", false))
+
+		if code := request(t, http.MethodGet, "/v1/health", "10.0.0.6", false); code == http.StatusTooManyRequests {
+			t.Fatal("request from another IP throttled")
+		}
+	})
+	t.Run("should count the connections of an IP together", func(t *testing.T) {
+		for i, port := range []string{"40001", "40002"} {
+			req, err := http.NewRequest(http.MethodPost, "/v1/authentication/token", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.RemoteAddr = "10.0.0.9:" + port
+
+			code := executeRequest(req, mux).Code
+			if throttled := code == http.StatusTooManyRequests; throttled != (i == 1) {
+				t.Errorf("request from port %s got %d", port, code)
+			}
+		}
+	})
+}
+
+func TestLoadRateLimitPolicies(t *testing.T) {
+	t.Run("should load overrides of the declared policies", func(t *testing.T) {
+		t.Setenv("RATE_LIMIT_POLICIES", `{"auth": {"limit": 5}, "feed": {"window": "30s"}}`)
+
+		policies, err := loadRateLimitPolicies()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if policies[policyAuth].Limit != 5 || policies[policyFeed].Window != 30*time.Second {
+			t.Errorf("got %+v", policies)
+		}
+	})
+
+	t.Run("should fail on unknown or invalid policies", func(t *testing.T) {
+		for _, overrides := range []string{`{"feeds": {"limit": 5}}`, `{"auth": {"limit": -5}}`} {
+			t.Setenv("RATE_LIMIT_POLICIES", overrides)
+
+			if _, err := loadRateLimitPolicies(); err == nil {
+				t.Errorf("loaded %s", overrides)
+			}
+		}
+	})
+}
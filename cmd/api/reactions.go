@@ -0,0 +1,273 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"Go-Microservice/internal/repo/cache"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// ReactionsResponse holds the reaction counts of a post or comment
+//
+//	@Description	Number of users who reacted with each kind, kinds nobody reacted with are omitted
+type ReactionsResponse struct {
+	Reactions repo.ReactionCounts `json:"reactions"`
+}
+
+// putReactionHandler godoc
+//
+//	@Summary		Reacts to a post
+//	@Description	Adds a reaction of the authenticated user to a post. Each user can react once with each
+//	@Description	kind (like, love, laugh, insightful, sad); reacting again has no effect.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int64	true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind"
+//	@Success		200		{object}	ReactionsResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/reactions/{kind} [put]
+func (app *application) putReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeReaction(w, r, true)
+}
+
+// deleteReactionHandler godoc
+//
+//	@Summary		Withdraws a reaction to a post
+//	@Description	Removes the reaction of the given kind of the authenticated user from a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int64	true	"Post ID"
+//	@Param			kind	path		string	true	"Reaction kind"
+//	@Success		200		{object}	ReactionsResponse
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/reactions/{kind} [delete]
+func (app *application) deleteReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeReaction(w, r, false)
+}
+
+// putCommentReactionHandler godoc
+//
+//	@Summary		Reacts to a comment
+//	@Description	Adds a reaction of the authenticated user to a comment on a post
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID		path		int64	true	"Post ID"
+//	@Param			commentID	path		int64	true	"Comment ID"
+//	@Param			kind		path		string	true	"Reaction kind"
+//	@Success		200			{object}	ReactionsResponse
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/comments/{commentID}/reactions/{kind} [put]
+func (app *application) putCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeReaction(w, r, true)
+}
+
+// deleteCommentReactionHandler godoc
+//
+//	@Summary		Withdraws a reaction to a comment
+//	@Description	Removes the reaction of the given kind of the authenticated user from a comment
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID		path		int64	true	"Post ID"
+//	@Param			commentID	path		int64	true	"Comment ID"
+//	@Param			kind		path		string	true	"Reaction kind"
+//	@Success		200			{object}	ReactionsResponse
+//	@Failure		400			{object}	error
+//	@Failure		401			{object}	error
+//	@Failure		404			{object}	error
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/comments/{commentID}/reactions/{kind} [delete]
+func (app *application) deleteCommentReactionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeReaction(w, r, false)
+}
+
+// changeReaction adds or removes the reaction of the user to the post, or
+// the comment in the path, and responds with the updated counts.
+func (app *application) changeReaction(w http.ResponseWriter, r *http.Request, add bool) {
+	user := getUserFromContext(r)
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+
+	kind := chi.URLParam(r, "kind")
+	if !slices.Contains(repo.ReactionKinds, kind) {
+		app.badRequestResponse(w, r, fmt.Errorf("unknown reaction kind %q", kind))
+		return
+	}
+
+	target := repo.ReactionTarget{PostID: post.ID}
+	if comment := getCommentFromCtx(r); comment != nil {
+		target.CommentID = comment.ID
+	}
+
+	change, delta := app.repo.Reactions.Add, 1
+	if !add {
+		change, delta = app.repo.Reactions.Remove, -1
+	}
+
+	changed, err := change(ctx, user.ID, target, kind)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	cached, id, load := app.cacheStorage.Reactions, post.ID, app.loadReactionCounts
+	if target.CommentID != 0 {
+		cached, id, load = app.cacheStorage.CommentReactions, target.CommentID, app.loadCommentReactionCounts
+	}
+
+	if changed && app.config.redisConfig.enabled {
+		if err := cached.Incr(ctx, id, kind, delta); err != nil {
+			// a stale counter would outlive the reaction until it expires
+			app.logger.Warn("failed to update cached reaction count", "post_id", post.ID, "comment_id", target.CommentID, "error", err)
+			cached.Delete(ctx, id)
+		}
+	}
+
+	counts, err := load(ctx, []int64{id})
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, ReactionsResponse{Reactions: counts[id]}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getReactionCounts returns the reaction counts of a post.
+func (app *application) getReactionCounts(ctx context.Context, postID int64) (repo.ReactionCounts, error) {
+	counts, err := app.loadReactionCounts(ctx, []int64{postID})
+	if err != nil {
+		return nil, err
+	}
+	return counts[postID], nil
+}
+
+// attachReactionCounts sets the reaction counts of the posts of a feed page.
+func (app *application) attachReactionCounts(ctx context.Context, posts []repo.PostWithMetadata) error {
+	if len(posts) == 0 {
+		return nil
+	}
+
+	ids := make([]int64, len(posts))
+	for i, p := range posts {
+		ids[i] = p.ID
+	}
+
+	counts, err := app.loadReactionCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	for i := range posts {
+		posts[i].Reactions = counts[posts[i].ID]
+	}
+	return nil
+}
+
+// attachCommentReactionCounts sets the reaction counts of comments and of
+// their embedded replies.
+func (app *application) attachCommentReactionCounts(ctx context.Context, comments []repo.Comment) error {
+	var ids []int64
+	var collect func(comments []repo.Comment)
+	collect = func(comments []repo.Comment) {
+		for _, c := range comments {
+			ids = append(ids, c.ID)
+			collect(c.Replies)
+		}
+	}
+	collect(comments)
+	if len(ids) == 0 {
+		return nil
+	}
+
+	counts, err := app.loadCommentReactionCounts(ctx, ids)
+	if err != nil {
+		return err
+	}
+
+	var attach func(comments []repo.Comment)
+	attach = func(comments []repo.Comment) {
+		for i := range comments {
+			comments[i].Reactions = counts[comments[i].ID]
+			attach(comments[i].Replies)
+		}
+	}
+	attach(comments)
+	return nil
+}
+
+// loadReactionCounts reads the reaction counts of posts from the cache when
+// Redis is enabled, and aggregates the counts of the posts missing from it.
+// Cache failures fall back to the database.
+func (app *application) loadReactionCounts(ctx context.Context, postIDs []int64) (map[int64]repo.ReactionCounts, error) {
+	return app.loadCachedReactionCounts(ctx, app.cacheStorage.Reactions, app.repo.Reactions.PostCounts, postIDs)
+}
+
+// loadCommentReactionCounts is loadReactionCounts for comments.
+func (app *application) loadCommentReactionCounts(ctx context.Context, commentIDs []int64) (map[int64]repo.ReactionCounts, error) {
+	return app.loadCachedReactionCounts(ctx, app.cacheStorage.CommentReactions, app.repo.Reactions.CommentCounts, commentIDs)
+}
+
+func (app *application) loadCachedReactionCounts(
+	ctx context.Context,
+	cached cache.ReactionCache,
+	aggregate func(ctx context.Context, ids []int64) (map[int64]repo.ReactionCounts, error),
+	ids []int64,
+) (map[int64]repo.ReactionCounts, error) {
+	if !app.config.redisConfig.enabled {
+		return aggregate(ctx, ids)
+	}
+
+	counts, err := cached.Get(ctx, ids)
+	if err != nil {
+		app.logger.Warn("failed to read cached reaction counts", "error", err)
+		counts = map[int64]repo.ReactionCounts{}
+	}
+
+	var missing []int64
+	for _, id := range ids {
+		if _, ok := counts[id]; !ok {
+			missing = append(missing, id)
+		}
+	}
+	if len(missing) == 0 {
+		return counts, nil
+	}
+
+	loaded, err := aggregate(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cached.Set(ctx, loaded); err != nil {
+		app.logger.Warn("failed to cache reaction counts", "error", err)
+	}
+
+	for id, c := range loaded {
+		counts[id] = c
+	}
+	return counts, nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"Go-Microservice/internal/repo/cache"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/mock"
+)
+
+func TestReactions(t *testing.T) {
+	withRedis := config{
+		redisConfig: redisConfig{
+			enabled: true,
+		},
+	}
+
+	app := newTestApplication(t, withRedis)
+	mux := app.mount()
+
+	users := app.cacheStorage.Users.(*cache.MockUserStore)
+	users.On("Get", mock.Anything).Return(nil, nil)
+	users.On("Set", mock.Anything).Return(nil)
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	react := func(t *testing.T, method, path string) *ReactionsResponse {
+		t.Helper()
+
+		req, err := http.NewRequest(method, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		if rr.Code != http.StatusOK {
+			checkResponseCode(t, http.StatusOK, rr.Code)
+			return nil
+		}
+
+		var res struct {
+			Data ReactionsResponse `json:"data"`
+		}
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		return &res.Data
+	}
+
+	t.Run("should count a new reaction in the cache", func(t *testing.T) {
+		reactions := &cache.MockReactionStore{}
+		reactions.On("Incr", int64(1), "love", 1).Return(nil)
+		reactions.On("Get", []int64{1}).Return(map[int64]repo.ReactionCounts{1: {"love": 3}}, nil)
+		app.cacheStorage.Reactions = reactions
+
+		res := react(t, http.MethodPut, "/v1/posts/1/reactions/love")
+
+		if res == nil || res.Reactions["love"] != 3 {
+			t.Errorf("unexpected counts %+v", res)
+		}
+		reactions.AssertCalled(t, "Incr", int64(1), "love", 1)
+	})
+
+	t.Run("should aggregate the counts missing from the cache", func(t *testing.T) {
+		reactions := &cache.MockReactionStore{}
+		reactions.On("Incr", int64(1), "like", -1).Return(nil)
+		reactions.On("Get", []int64{1}).Return(map[int64]repo.ReactionCounts{}, nil)
+		reactions.On("Set", map[int64]repo.ReactionCounts{1: {"like": 1}}).Return(nil)
+		app.cacheStorage.Reactions = reactions
+
+		res := react(t, http.MethodDelete, "/v1/posts/1/reactions/like")
+
+		if res == nil || res.Reactions["like"] != 1 {
+			t.Errorf("unexpected counts %+v", res)
+		}
+		reactions.AssertCalled(t, "Set", map[int64]repo.ReactionCounts{1: {"like": 1}})
+	})
+
+	t.Run("should count reactions on comments in the cache of comments", func(t *testing.T) {
+		reactions := &cache.MockReactionStore{}
+		app.cacheStorage.Reactions = reactions
+		comments := &cache.MockReactionStore{}
+		comments.On("Incr", int64(2), "like", 1).Return(nil)
+		comments.On("Get", []int64{2}).Return(map[int64]repo.ReactionCounts{2: {"like": 4}}, nil)
+		app.cacheStorage.CommentReactions = comments
+
+		res := react(t, http.MethodPut, "/v1/posts/1/comments/2/reactions/like")
+
+		if res == nil || res.Reactions["like"] != 4 {
+			t.Errorf("unexpected counts %+v", res)
+		}
+		comments.AssertCalled(t, "Incr", int64(2), "like", 1)
+		reactions.AssertNotCalled(t, "Incr", mock.Anything, mock.Anything, mock.Anything)
+	})
+
+	t.Run("should attach cached counts to the comments of a thread", func(t *testing.T) {
+		comments := &cache.MockReactionStore{}
+		comments.On("Get", []int64{1, 2}).Return(map[int64]repo.ReactionCounts{1: {"love": 2}}, nil)
+		comments.On("Set", map[int64]repo.ReactionCounts{2: {"like": 1}}).Return(nil)
+		app.cacheStorage.CommentReactions = comments
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/posts/1/comments", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		var res CommentsResponse
+		if err := json.NewDecoder(rr.Body).Decode(&res); err != nil {
+			t.Fatal(err)
+		}
+		if len(res.Data) != 1 || len(res.Data[0].Replies) != 1 {
+			t.Fatalf("unexpected thread %+v", res.Data)
+		}
+		if res.Data[0].Reactions["love"] != 2 || res.Data[0].Replies[0].Reactions["like"] != 1 {
+			t.Errorf("unexpected counts %+v, %+v", res.Data[0].Reactions, res.Data[0].Replies[0].Reactions)
+		}
+		comments.AssertCalled(t, "Set", map[int64]repo.ReactionCounts{2: {"like": 1}})
+	})
+
+	t.Run("should reject unknown kinds", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPut, "/v1/posts/1/reactions/angry", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		checkResponseCode(t, http.StatusBadRequest, executeRequest(req, mux).Code)
+	})
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// restorePostHandler godoc
+//
+//	@Summary		Restores a deleted post
+//	@Description	Undoes the deletion of a post that was not purged yet, together with its comments
+//	@Tags			admin
+//	@Param			postID	path	int64	true	"Post ID"
+//	@Success		204		"Post restored"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error	"No such deleted post"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/admin/posts/{postID}/restore [put]
+func (app *application) restorePostHandler(w http.ResponseWriter, r *http.Request) {
+	id, ok := app.restore(w, r, "postID", app.repo.Posts.Restore)
+	if !ok {
+		return
+	}
+
+	// timelines dropped the post when it was deleted
+	if app.timelinesEnabled() {
+		post, err := app.repo.Posts.GetByID(r.Context(), id)
+		if err != nil {
+			app.logger.Warn("failed to fan out restored post", "post_id", id, "error", err)
+		} else {
+			app.fanOutPost(r.Context(), post)
+		}
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// restoreCommentHandler godoc
+//
+//	@Summary		Restores a deleted comment
+//	@Description	Undoes the deletion of a comment that was not purged yet, together with its replies
+//	@Tags			admin
+//	@Param			commentID	path	int64	true	"Comment ID"
+//	@Success		204			"Comment restored"
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error	"No such deleted comment"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/admin/comments/{commentID}/restore [put]
+func (app *application) restoreCommentHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.restore(w, r, "commentID", app.repo.Comments.Restore); ok {
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// restoreUserHandler godoc
+//
+//	@Summary		Restores a deleted user
+//	@Description	Undoes the deletion of a user account that was not purged yet. The user signs in again.
+//	@Tags			admin
+//	@Param			userID	path	int64	true	"User ID"
+//	@Success		204		"User restored"
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error	"No such deleted user"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/admin/users/{userID}/restore [put]
+func (app *application) restoreUserHandler(w http.ResponseWriter, r *http.Request) {
+	if _, ok := app.restore(w, r, "userID", app.repo.Users.Restore); ok {
+		// the posts of the user are shown again
+		app.flushPostCache(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// restore restores the row whose ID is the path parameter param and responds
+// with an error if that fails. It reports whether the row was restored.
+func (app *application) restore(
+	w http.ResponseWriter,
+	r *http.Request,
+	param string,
+	restore func(ctx context.Context, id int64) error,
+) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, param), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return 0, false
+	}
+
+	if err := restore(r.Context(), id); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return 0, false
+	}
+
+	app.logger.Info("restored", param, id, "by", getUserFromContext(r).ID)
+
+	return id, true
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"net/http"
+	"testing"
+)
+
+// adminUsers grants user 1 permissions, other users have none.
+type adminUsers struct {
+	repo.MockUserStore
+	permissions []string
+}
+
+func (s *adminUsers) GetByID(ctx context.Context, userID int64) (*repo.User, error) {
+	user := &repo.User{ID: userID}
+	if userID == 1 {
+		user.Role = repo.Role{Name: "admin", Permissions: s.permissions}
+	}
+	return user, nil
+}
+
+// flushedPosts counts how often the cached posts were flushed.
+type flushedPosts struct {
+	repo.MockPostStore
+	flushes int
+}
+
+func (s *flushedPosts) Flush(ctx context.Context) error {
+	s.flushes++
+	return nil
+}
+
+func TestRestore(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should forbid users without the permission to delete or restore", func(t *testing.T) {
+		routes := []struct{ method, path string }{
+			{http.MethodPut, "/v1/admin/posts/1/restore"},
+			{http.MethodPut, "/v1/admin/comments/1/restore"},
+			{http.MethodPut, "/v1/admin/users/2/restore"},
+			{http.MethodDelete, "/v1/users/2"},
+		}
+
+		for _, route := range routes {
+			req, err := http.NewRequest(route.method, route.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusForbidden, rr.Code)
+		}
+	})
+
+	t.Run("should let users with the permission delete and restore", func(t *testing.T) {
+		app.repo.Users = &adminUsers{permissions: []string{permPostRestore, permCommentRestore, permUserDelete, permUserRestore}}
+		defer func() { app.repo.Users = &repo.MockUserStore{} }()
+
+		routes := []struct{ method, path string }{
+			{http.MethodDelete, "/v1/users/2"},
+			{http.MethodPut, "/v1/admin/users/2/restore"},
+			{http.MethodPut, "/v1/admin/posts/1/restore"},
+			{http.MethodPut, "/v1/admin/comments/1/restore"},
+		}
+
+		for _, route := range routes {
+			req, err := http.NewRequest(route.method, route.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+
+			checkResponseCode(t, http.StatusNoContent, rr.Code)
+		}
+	})
+	t.Run("should drop the cached posts as users are deleted or restored", func(t *testing.T) {
+		app.repo.Users = &adminUsers{permissions: []string{permUserDelete, permUserRestore}}
+		posts := &flushedPosts{}
+		app.repo.Posts = posts
+		defer func() {
+			app.repo.Users = &repo.MockUserStore{}
+			app.repo.Posts = &repo.MockPostStore{}
+		}()
+
+		for i, route := range []struct{ method, path string }{
+			{http.MethodDelete, "/v1/users/2"},
+			{http.MethodPut, "/v1/admin/users/2/restore"},
+		} {
+			req, err := http.NewRequest(route.method, route.path, nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			req.Header.Set("Authorization", "Bearer "+testToken)
+
+			rr := executeRequest(req, mux)
+			checkResponseCode(t, http.StatusNoContent, rr.Code)
+
+			if posts.flushes != i+1 {
+				t.Errorf("%s %s: flushed %d times, want %d", route.method, route.path, posts.flushes, i+1)
+			}
+		}
+	})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"Go-Microservice/internal/diff"
+	"Go-Microservice/internal/repo"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// RevisionsResponse lists the versions of a post
+type RevisionsResponse struct {
+	Revisions []repo.PostRevision `json:"revisions"`
+}
+
+// RevisionDiff holds the changes between two versions of a post
+//
+//	@Description	Word-level changes of the title and content, and the tags added and removed
+type RevisionDiff struct {
+	From        int32     `json:"from" example:"1"`
+	To          int32     `json:"to" example:"2"`
+	Title       []diff.Op `json:"title"`
+	Content     []diff.Op `json:"content"`
+	TagsAdded   []string  `json:"tags_added" example:"golang"`
+	TagsRemoved []string  `json:"tags_removed" example:"go"`
+}
+
+// RevisionResponse holds a version of a post and what changed in it
+type RevisionResponse struct {
+	Revision repo.PostRevision `json:"revision"`
+	// Diff is null for the version the post was created with
+	Diff *RevisionDiff `json:"diff"`
+}
+
+// listRevisionsHandler godoc
+//
+//	@Summary		Lists the versions of a post
+//	@Description	Returns every version the post went through, newest first. Only the author and users
+//	@Description	allowed to update any post can see them.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int64	true	"Post ID"
+//	@Success		200		{object}	RevisionsResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/revisions [get]
+func (app *application) listRevisionsHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+
+	revisions, err := app.repo.Posts.GetRevisions(r.Context(), post.ID)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, RevisionsResponse{Revisions: revisions}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// getRevisionHandler godoc
+//
+//	@Summary		Gets a version of a post
+//	@Description	Returns a version of the post with the changes from another version, by default the
+//	@Description	one before it. Only the author and users allowed to update any post can see it.
+//	@Tags			posts
+//	@Produce		json
+//	@Param			postID	path		int64	true	"Post ID"
+//	@Param			version	path		int32	true	"Version"
+//	@Param			compare	query		int32	false	"Version to diff against, defaults to the previous one"
+//	@Success		200		{object}	RevisionResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/posts/{postID}/revisions/{version} [get]
+func (app *application) getRevisionHandler(w http.ResponseWriter, r *http.Request) {
+	post := getPostFromCtx(r)
+	ctx := r.Context()
+
+	version, err := parseVersion(chi.URLParam(r, "version"))
+	if err != nil {
+		app.badRequestResponse(w, r, fmt.Errorf("invalid version: %w", err))
+		return
+	}
+
+	compare := version - 1
+	if s := r.URL.Query().Get("compare"); s != "" {
+		if compare, err = parseVersion(s); err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid compare version: %w", err))
+			return
+		}
+	}
+
+	rev, err := app.repo.Posts.GetRevision(ctx, post.ID, version)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	res := RevisionResponse{Revision: *rev}
+	if compare >= 0 && compare != version {
+		base, err := app.repo.Posts.GetRevision(ctx, post.ID, compare)
+		if err != nil {
+			switch {
+			case errors.Is(err, repo.ErrNotFound):
+				app.notFoundResponse(w, r, err)
+			default:
+				app.internalServerError(w, r, err)
+			}
+			return
+		}
+
+		res.Diff = &RevisionDiff{
+			From:    base.Version,
+			To:      rev.Version,
+			Title:   diff.Words(base.Title, rev.Title),
+			Content: diff.Words(base.Content, rev.Content),
+		}
+		res.Diff.TagsAdded, res.Diff.TagsRemoved = diff.Sets(base.Tags, rev.Tags)
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func parseVersion(s string) (int32, error) {
+	v, err := strconv.ParseInt(s, 10, 32)
+	if err != nil {
+		return 0, err
+	}
+	if v < 0 {
+		return 0, errors.New("must not be negative")
+	}
+	return int32(v), nil
+}
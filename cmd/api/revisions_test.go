@@ -0,0 +1,88 @@
+package main
+
+import (
+	"Go-Microservice/internal/diff"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestRevisions(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func(t *testing.T, path string) (int, []byte) {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+		return rr.Code, rr.Body.Bytes()
+	}
+
+	t.Run("should list versions newest first", func(t *testing.T) {
+		code, body := request(t, "/v1/posts/1/revisions")
+		checkResponseCode(t, http.StatusOK, code)
+
+		var res struct{ Data RevisionsResponse }
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if revs := res.Data.Revisions; len(revs) != 2 || revs[0].Version != 1 || !revs[0].Current {
+			t.Errorf("unexpected revisions %+v", revs)
+		}
+	})
+
+	t.Run("should diff a version against the previous one", func(t *testing.T) {
+		code, body := request(t, "/v1/posts/1/revisions/1")
+		checkResponseCode(t, http.StatusOK, code)
+
+		var res struct{ Data RevisionResponse }
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+
+		d := res.Data.Diff
+		if d == nil || d.From != 0 || d.To != 1 {
+			t.Fatalf("unexpected diff %+v", d)
+		}
+		want := []diff.Op{{Type: diff.Equal, Text: "Go is simple"}, {Type: diff.Insert, Text: " and fast"}}
+		if !reflect.DeepEqual(d.Content, want) {
+			t.Errorf("got content diff %+v, want %+v", d.Content, want)
+		}
+	})
+
+	t.Run("should not diff the first version", func(t *testing.T) {
+		code, body := request(t, "/v1/posts/1/revisions/0")
+		checkResponseCode(t, http.StatusOK, code)
+
+		var res struct{ Data RevisionResponse }
+		if err := json.Unmarshal(body, &res); err != nil {
+			t.Fatal(err)
+		}
+		if res.Data.Diff != nil {
+			t.Errorf("unexpected diff %+v", res.Data.Diff)
+		}
+	})
+
+	t.Run("should reject invalid and unknown versions", func(t *testing.T) {
+		code, _ := request(t, "/v1/posts/1/revisions/x")
+		checkResponseCode(t, http.StatusBadRequest, code)
+
+		code, _ = request(t, "/v1/posts/1/revisions/1?compare=-1")
+		checkResponseCode(t, http.StatusBadRequest, code)
+
+		code, _ = request(t, "/v1/posts/1/revisions/5")
+		checkResponseCode(t, http.StatusNotFound, code)
+	})
+}
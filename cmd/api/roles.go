@@ -0,0 +1,235 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// Permissions checked by the API. They are seeded by the migrations and
+// granted to roles through the /v1/roles endpoints.
+const (
+	permPostUpdateAny    = "post.update.any"
+	permPostDeleteAny    = "post.delete.any"
+	permCommentUpdateAny = "comment.update.any"
+	permCommentDeleteAny = "comment.delete.any"
+	permPostRestore      = "post.restore"
+	permCommentRestore   = "comment.restore"
+	permUserDelete       = "user.delete"
+	permUserRestore      = "user.restore"
+	permUserUnlock       = "user.unlock"
+	permUserMFAReset     = "user.mfa.reset"
+	permAPIKeyManageAny  = "apikey.manage.any"
+	permRoleManage       = "role.manage"
+)
+
+// listRolesHandler godoc
+//
+//	@Summary		Lists roles
+//	@Description	Lists all roles together with the permissions granted to them
+//	@Tags			roles
+//	@Produce		json
+//	@Success		200	{array}		repo.Role
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/roles [get]
+func (app *application) listRolesHandler(w http.ResponseWriter, r *http.Request) {
+	roles, err := app.repo.Roles.List(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, roles); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// listPermissionsHandler godoc
+//
+//	@Summary		Lists permissions
+//	@Description	Lists every permission that can be granted to a role
+//	@Tags			roles
+//	@Produce		json
+//	@Success		200	{array}		repo.Permission
+//	@Failure		403	{object}	error
+//	@Failure		500	{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/permissions [get]
+func (app *application) listPermissionsHandler(w http.ResponseWriter, r *http.Request) {
+	permissions, err := app.repo.Roles.ListPermissions(r.Context())
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if err := app.jsonResponse(w, http.StatusOK, permissions); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// grantPermissionHandler godoc
+//
+//	@Summary		Grants a permission to a role
+//	@Tags			roles
+//	@Param			roleID		path	int64	true	"Role ID"
+//	@Param			permission	path	string	true	"Permission name, e.g. post.update.any"
+//	@Success		204			"Permission granted"
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error	"Unknown role or permission"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/roles/{roleID}/permissions/{permission} [put]
+func (app *application) grantPermissionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeRolePermission(w, r, app.repo.Roles.GrantPermission)
+}
+
+// revokePermissionHandler godoc
+//
+//	@Summary		Revokes a permission from a role
+//	@Tags			roles
+//	@Param			roleID		path	int64	true	"Role ID"
+//	@Param			permission	path	string	true	"Permission name, e.g. post.update.any"
+//	@Success		204			"Permission revoked"
+//	@Failure		400			{object}	error
+//	@Failure		403			{object}	error
+//	@Failure		404			{object}	error	"Role does not have the permission"
+//	@Failure		500			{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/roles/{roleID}/permissions/{permission} [delete]
+func (app *application) revokePermissionHandler(w http.ResponseWriter, r *http.Request) {
+	app.changeRolePermission(w, r, app.repo.Roles.RevokePermission)
+}
+
+// SetRoleMFAPayload represents the request payload for requiring MFA on a role
+//
+//	@Description	Request payload for requiring MFA on a role
+type SetRoleMFAPayload struct {
+	// Whether members of the role keep its permissions only with MFA enabled
+	//	@example	true
+	RequireMFA *bool `json:"require_mfa" validate:"required" example:"true"`
+}
+
+// RoleMFAResponse tells how many members a change of the MFA requirement affects
+//
+//	@Description	MFA requirement of a role and the members that have not enabled MFA
+type RoleMFAResponse struct {
+	RequireMFA bool `json:"require_mfa" example:"true"`
+	// Active members of the role without MFA, who hold none of its permissions while MFA is required
+	MembersWithoutMFA int `json:"members_without_mfa" example:"2"`
+}
+
+// setRoleMFAHandler godoc
+//
+//	@Summary		Requires MFA on a role
+//	@Description	Sets whether members of a role keep its permissions only once they enabled MFA. The response
+//	@Description	counts the members without MFA, who lose the permissions of the role while it is required.
+//	@Tags			roles
+//	@Accept			json
+//	@Produce		json
+//	@Param			roleID	path		int64				true	"Role ID"
+//	@Param			payload	body		SetRoleMFAPayload	true	"MFA requirement"
+//	@Success		200		{object}	RoleMFAResponse
+//	@Failure		400		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		404		{object}	error	"Unknown role"
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/roles/{roleID}/mfa [put]
+func (app *application) setRoleMFAHandler(w http.ResponseWriter, r *http.Request) {
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	var payload SetRoleMFAPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	withoutMFA, err := app.repo.Roles.SetRequireMFA(ctx, roleID, *payload.RequireMFA)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("role mfa requirement changed",
+		"role_id", roleID, "require_mfa", *payload.RequireMFA, "members_without_mfa", withoutMFA, "by", getUserFromContext(r).ID)
+
+	app.evictRoleMembers(ctx, roleID)
+
+	res := RoleMFAResponse{RequireMFA: *payload.RequireMFA, MembersWithoutMFA: withoutMFA}
+	if err := app.jsonResponse(w, http.StatusOK, res); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+func (app *application) changeRolePermission(
+	w http.ResponseWriter,
+	r *http.Request,
+	change func(ctx context.Context, roleID int64, permission string) error,
+) {
+	roleID, err := strconv.ParseInt(chi.URLParam(r, "roleID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	permission := chi.URLParam(r, "permission")
+	ctx := r.Context()
+
+	if err := change(ctx, roleID, permission); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	app.logger.Info("role permissions changed",
+		"role_id", roleID, "permission", permission, "method", r.Method, "by", getUserFromContext(r).ID)
+
+	app.evictRoleMembers(ctx, roleID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// evictRoleMembers drops the cached users holding a role, whose cached
+// permissions are stale after the role changed.
+func (app *application) evictRoleMembers(ctx context.Context, roleID int64) {
+	if !app.config.redisConfig.enabled {
+		return
+	}
+
+	userIDs, err := app.repo.Roles.GetUserIDs(ctx, roleID)
+	if err != nil {
+		app.logger.Warn("failed to evict role members from cache", "role_id", roleID, "error", err)
+		return
+	}
+
+	for _, id := range userIDs {
+		app.cacheStorage.Users.Delete(ctx, id)
+	}
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+// mfaRoles knows role 2, which has a single member without MFA.
+type mfaRoles struct {
+	repo.RoleRepository
+	requireMFA bool
+}
+
+func (s *mfaRoles) SetRequireMFA(ctx context.Context, roleID int64, require bool) (int, error) {
+	if roleID != 2 {
+		return 0, fmt.Errorf("%w: role %d", repo.ErrNotFound, roleID)
+	}
+	s.requireMFA = require
+	return 1, nil
+}
+
+func TestSetRoleMFA(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	roles := &mfaRoles{}
+	app.repo.Roles = roles
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	setRoleMFA := func(t *testing.T, path, body string) *http.Response {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodPut, path, strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		return executeRequest(req, mux).Result()
+	}
+
+	t.Run("should forbid users without the permission", func(t *testing.T) {
+		res := setRoleMFA(t, "/v1/roles/2/mfa", `{"require_mfa": true}`)
+		checkResponseCode(t, http.StatusForbidden, res.StatusCode)
+	})
+
+	app.repo.Users = &adminUsers{permissions: []string{permRoleManage}}
+
+	t.Run("should require MFA and count the members without it", func(t *testing.T) {
+		res := setRoleMFA(t, "/v1/roles/2/mfa", `{"require_mfa": true}`)
+		checkResponseCode(t, http.StatusOK, res.StatusCode)
+
+		var body struct {
+			Data RoleMFAResponse `json:"data"`
+		}
+		if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+			t.Fatal(err)
+		}
+		if !roles.requireMFA || !body.Data.RequireMFA || body.Data.MembersWithoutMFA != 1 {
+			t.Errorf("unexpected response %+v", body.Data)
+		}
+	})
+
+	t.Run("should reject a payload without the setting", func(t *testing.T) {
+		res := setRoleMFA(t, "/v1/roles/2/mfa", `{}`)
+		checkResponseCode(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("should not find unknown roles", func(t *testing.T) {
+		res := setRoleMFA(t, "/v1/roles/9/mfa", `{"require_mfa": false}`)
+		checkResponseCode(t, http.StatusNotFound, res.StatusCode)
+	})
+}
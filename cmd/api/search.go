@@ -0,0 +1,110 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// SearchResponse is a page of search results
+//
+//	@Description	Page of search results with the cursor of the next page, which is omitted on the last page
+type SearchResponse struct {
+	Data       []repo.SearchResult `json:"data"`
+	NextCursor string              `json:"next_cursor,omitempty"`
+}
+
+// searchHandler godoc
+//
+//	@Summary		Searches posts, comments or users
+//	@Description	Full-text search over the title, content and tags of posts (weighted in that order) or the
+//	@Description	content of comments, ranked by relevance with highlighted snippets. Users are matched by
+//	@Description	similarity of their username. q supports the web search syntax: "phrases", -excluded, or.
+//	@Tags			search
+//	@Produce		json
+//	@Param			q		query		string	true	"Search terms"
+//	@Param			type	query		string	false	"posts (default), comments or users"
+//	@Param			limit	query		int		false	"Number of results (default: 20, max: 50)"
+//	@Param			cursor	query		string	false	"next_cursor of the previous page"
+//	@Success		200		{object}	SearchResponse
+//	@Header			200		{string}	Link	"Link to the next page"
+//	@Failure		400		{object}	error
+//	@Failure		401		{object}	error
+//	@Failure		403		{object}	error
+//	@Failure		500		{object}	error
+//	@Security		ApiKeyAuth
+//	@Router			/v1/search [get]
+func (app *application) searchHandler(w http.ResponseWriter, r *http.Request) {
+	qs := r.URL.Query()
+
+	q := repo.SearchQuery{
+		Query: strings.TrimSpace(qs.Get("q")),
+		Type:  repo.SearchTypePosts,
+		Limit: 20,
+	}
+
+	if t := qs.Get("type"); t != "" {
+		q.Type = t
+	}
+
+	if limitStr := qs.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil {
+			app.badRequestResponse(w, r, fmt.Errorf("invalid limit parameter: %w", err))
+			return
+		}
+		q.Limit = limit
+	}
+
+	if cursorStr := qs.Get("cursor"); cursorStr != "" {
+		cursor, err := repo.DecodeSearchCursor(cursorStr)
+		if err != nil {
+			app.badRequestResponse(w, r, err)
+			return
+		}
+		q.Cursor = cursor
+	}
+
+	if err := validate.Struct(q); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	search := app.repo.Search.Posts
+	switch q.Type {
+	case repo.SearchTypeComments:
+		search = app.repo.Search.Comments
+	case repo.SearchTypeUsers:
+		search = app.repo.Search.Users
+	}
+
+	page, err := search(r.Context(), q)
+	if err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	if link := cursorLinkHeader(r, page.NextCursor, ""); link != "" {
+		w.Header().Set("Link", link)
+	}
+
+	if err := writeJSON(w, http.StatusOK, SearchResponse{Data: page.Results, NextCursor: page.NextCursor}); err != nil {
+		app.internalServerError(w, r, err)
+	}
+}
+
+// requireSearchScope requires the read scope of the searched type: users:read
+// for users and posts:read for posts and their comments.
+func (app *application) requireSearchScope(next http.Handler) http.Handler {
+	posts, users := app.requireScope(scopePostsRead)(next), app.requireScope(scopeUsersRead)(next)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("type") == repo.SearchTypeUsers {
+			users.ServeHTTP(w, r)
+			return
+		}
+		posts.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"net/http"
+	"testing"
+)
+
+func TestSearch(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	search := func(t *testing.T, query, authorization string) int {
+		t.Helper()
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/search"+query, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		req.Header.Set("Authorization", authorization)
+
+		return executeRequest(req, mux).Code
+	}
+
+	t.Run("should search posts by default", func(t *testing.T) {
+		checkResponseCode(t, http.StatusOK, search(t, "?q=golang", "Bearer "+testToken))
+	})
+
+	t.Run("should require search terms", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, search(t, "?type=posts", "Bearer "+testToken))
+	})
+
+	t.Run("should reject unknown types", func(t *testing.T) {
+		checkResponseCode(t, http.StatusBadRequest, search(t, "?q=golang&type=tags", "Bearer "+testToken))
+	})
+
+	keys := app.repo.APIKeys.(*repo.MockAPIKeyStore)
+
+	t.Run("should require the scope of the searched type", func(t *testing.T) {
+		keys.Scopes = []string{scopePostsRead}
+		checkResponseCode(t, http.StatusForbidden, search(t, "?q=jane&type=users", "ApiKey gms_test"))
+		checkResponseCode(t, http.StatusOK, search(t, "?q=golang&type=comments", "ApiKey gms_test"))
+
+		keys.Scopes = []string{scopeUsersRead}
+		checkResponseCode(t, http.StatusForbidden, search(t, "?q=golang", "ApiKey gms_test"))
+		checkResponseCode(t, http.StatusOK, search(t, "?q=jane&type=users", "ApiKey gms_test"))
+	})
+
+	t.Run("should check the scope before the query", func(t *testing.T) {
+		keys.Scopes = []string{scopeFeedRead}
+		checkResponseCode(t, http.StatusForbidden, search(t, "?limit=abc", "ApiKey gms_test"))
+	})
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"time"
+)
+
+// sweepInvitations periodically deletes expired invitations and the accounts
+// that were never activated, so that their email and username can be
+// registered again. It returns when ctx is done.
+func (app *application) sweepInvitations(ctx context.Context) {
+	ticker := time.NewTicker(app.config.invitationSweep.interval)
+	defer ticker.Stop()
+
+	for {
+		app.sweepInvitationsOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) sweepInvitationsOnce(ctx context.Context) {
+	invitations, err := app.repo.Users.DeleteExpiredInvitations(ctx)
+	if err != nil {
+		app.logger.Error("failed to delete expired invitations", "error", err)
+		return
+	}
+
+	users, err := app.repo.Users.DeleteUnactivated(ctx, app.config.invitationSweep.unactivatedMaxAge)
+	if err != nil {
+		app.logger.Error("failed to delete unactivated users", "error", err)
+		return
+	}
+
+	if invitations > 0 || users > 0 {
+		app.logger.Info("swept invitations", "invitations", invitations, "users", users)
+	}
+}
+
+// purgeDeleted periodically removes the posts, comments and users that were
+// deleted longer than the retention period ago. It returns when ctx is done.
+func (app *application) purgeDeleted(ctx context.Context) {
+	ticker := time.NewTicker(app.config.retention.interval)
+	defer ticker.Stop()
+
+	for {
+		app.purgeDeletedOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (app *application) purgeDeletedOnce(ctx context.Context) {
+	before := time.Now().Add(-app.config.retention.period)
+
+	// comments first, purging their posts and users would take them along
+	comments, err := app.repo.Comments.PurgeDeleted(ctx, before)
+	if err != nil {
+		app.logger.Error("failed to purge deleted comments", "error", err)
+		return
+	}
+
+	posts, err := app.repo.Posts.PurgeDeleted(ctx, before)
+	if err != nil {
+		app.logger.Error("failed to purge deleted posts", "error", err)
+		return
+	}
+
+	users, err := app.repo.Users.PurgeDeleted(ctx, before)
+	if err != nil {
+		app.logger.Error("failed to purge deleted users", "error", err)
+		return
+	}
+
+	// posts purged along with their author may still be cached
+	if posts > 0 || users > 0 {
+		app.flushPostCache(ctx)
+	}
+
+	if comments > 0 || posts > 0 || users > 0 {
+		app.logger.Info("purged deleted rows", "comments", comments, "posts", posts, "users", users)
+	}
+}
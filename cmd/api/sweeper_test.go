@@ -0,0 +1,101 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// sweptUsers counts the sweeps of invitations and unactivated users.
+type sweptUsers struct {
+	repo.MockUserStore
+	mu          sync.Mutex
+	invitations int
+	unactivated []time.Duration
+	err         error
+}
+
+func (s *sweptUsers) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.invitations++
+	return 2, s.err
+}
+
+func (s *sweptUsers) DeleteUnactivated(ctx context.Context, maxAge time.Duration) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.unactivated = append(s.unactivated, maxAge)
+	return 1, nil
+}
+
+func (s *sweptUsers) sweeps() (int, int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.invitations, len(s.unactivated)
+}
+
+func TestSweepInvitations(t *testing.T) {
+	sweep := invitationSweepConfig{enabled: true, interval: 10 * time.Millisecond, unactivatedMaxAge: 72 * time.Hour}
+
+	t.Run("should delete expired invitations and old unactivated users", func(t *testing.T) {
+		app := newTestApplication(t, config{invitationSweep: sweep})
+		users := &sweptUsers{}
+		app.repo.Users = users
+
+		app.sweepInvitationsOnce(context.Background())
+
+		if users.invitations != 1 || len(users.unactivated) != 1 {
+			t.Fatalf("swept %d times and %d times, want once each", users.invitations, len(users.unactivated))
+		}
+		if users.unactivated[0] != sweep.unactivatedMaxAge {
+			t.Errorf("deleted users unactivated for %v, want %v", users.unactivated[0], sweep.unactivatedMaxAge)
+		}
+	})
+
+	t.Run("should keep unactivated users if invitations cannot be swept", func(t *testing.T) {
+		app := newTestApplication(t, config{invitationSweep: sweep})
+		users := &sweptUsers{err: errors.New("connection refused")}
+		app.repo.Users = users
+
+		app.sweepInvitationsOnce(context.Background())
+
+		if len(users.unactivated) != 0 {
+			t.Errorf("deleted unactivated users after a failed sweep")
+		}
+	})
+
+	t.Run("should sweep right away and every interval until canceled", func(t *testing.T) {
+		app := newTestApplication(t, config{invitationSweep: sweep})
+		users := &sweptUsers{}
+		app.repo.Users = users
+
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			app.sweepInvitations(ctx)
+			close(done)
+		}()
+
+		deadline := time.Now().Add(time.Second)
+		for n, _ := users.sweeps(); n < 3; n, _ = users.sweeps() {
+			if time.Now().After(deadline) {
+				t.Fatalf("swept %d times in a second, want 3", n)
+			}
+			time.Sleep(sweep.interval)
+		}
+
+		cancel()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("sweepInvitations did not return after ctx was canceled")
+		}
+	})
+}
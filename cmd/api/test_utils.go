@@ -3,6 +3,7 @@ package main
 import (
 	"Go-Microservice/internal/auth"
 	formatLog "Go-Microservice/internal/log"
+	"Go-Microservice/internal/mailer"
 	"Go-Microservice/internal/repo"
 	"Go-Microservice/internal/repo/cache"
 	"log/slog"
@@ -26,6 +27,7 @@ func newTestApplication(t *testing.T, cfg config) *application {
 	return &application{
 		repo:          mockStore,
 		cacheStorage:  mockCacheStore,
+		mailer:        &mailer.MockMailer{},
 		authenticator: testAuth,
 		config:        cfg,
 		logger:        logger,
@@ -0,0 +1,143 @@
+package main
+
+import (
+	"Go-Microservice/internal/repo"
+	"Go-Microservice/internal/repo/cache"
+	"context"
+	"errors"
+	"time"
+)
+
+func (app *application) timelinesEnabled() bool {
+	return app.config.timeline.enabled && app.config.redisConfig.enabled
+}
+
+// getFeedPage reads a page of the feed of a user from the cached timeline and
+// falls back to the database when the page is not cached. The timeline of a
+// user without one is built from the database.
+func (app *application) getFeedPage(ctx context.Context, userID int64, fq repo.PaginatedFeedQuery) (*repo.FeedPage, error) {
+	if !app.timelinesEnabled() {
+		return app.repo.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	ids, hasMore, err := app.cacheStorage.Timelines.Page(ctx, userID, fq)
+	if err != nil {
+		if errors.Is(err, cache.ErrTimelineCold) {
+			app.buildTimeline(ctx, userID)
+		} else if !errors.Is(err, cache.ErrTimelineMiss) {
+			app.logger.Warn("failed to read timeline", "user_id", userID, "error", err)
+		}
+		return app.repo.Posts.GetUserFeed(ctx, userID, fq)
+	}
+
+	posts, err := app.repo.Posts.GetByIDs(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+
+	// deleted posts are dropped from the timeline as they are found
+	if len(posts) < len(ids) {
+		app.removeDeletedFromTimeline(ctx, userID, ids, posts)
+	}
+
+	return repo.NewFeedPage(posts, fq, hasMore)
+}
+
+// buildTimeline caches the newest posts of the feed of a user.
+func (app *application) buildTimeline(ctx context.Context, userID int64) {
+	entries, err := app.repo.Posts.GetTimelineEntries(ctx, userID, app.cacheStorage.Timelines.MaxLen())
+	if err != nil {
+		app.logger.Warn("failed to build timeline", "user_id", userID, "error", err)
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Set(ctx, userID, entries); err != nil {
+		app.logger.Warn("failed to build timeline", "user_id", userID, "error", err)
+	}
+}
+
+func (app *application) removeDeletedFromTimeline(ctx context.Context, userID int64, ids []int64, posts []repo.PostWithMetadata) {
+	found := make(map[int64]bool, len(posts))
+	for _, p := range posts {
+		found[p.ID] = true
+	}
+
+	var deleted []int64
+	for _, id := range ids {
+		if !found[id] {
+			deleted = append(deleted, id)
+		}
+	}
+
+	if err := app.cacheStorage.Timelines.Remove(ctx, userID, deleted); err != nil {
+		app.logger.Warn("failed to remove deleted posts from timeline", "user_id", userID, "error", err)
+	}
+}
+
+// fanOutPost pushes a new post to the timelines of its author and of the
+// followers of its author. Failures are logged only, the post is created
+// either way.
+func (app *application) fanOutPost(ctx context.Context, post *repo.Post) {
+	if !app.timelinesEnabled() {
+		return
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, post.CreatedAt)
+	if err != nil {
+		app.logger.Warn("failed to fan out post", "post_id", post.ID, "error", err)
+		return
+	}
+
+	followerIDs, err := app.repo.Followers.GetFollowerIDs(ctx, post.UserID)
+	if err != nil {
+		app.logger.Warn("failed to fan out post", "post_id", post.ID, "error", err)
+		return
+	}
+
+	entry := repo.TimelineEntry{PostID: post.ID, CreatedAt: createdAt}
+	if err := app.cacheStorage.Timelines.Push(ctx, entry, append(followerIDs, post.UserID)); err != nil {
+		app.logger.Warn("failed to fan out post", "post_id", post.ID, "error", err)
+	}
+}
+
+// backfillTimeline adds the posts of a newly followed user to the timeline of
+// the follower.
+func (app *application) backfillTimeline(ctx context.Context, followerID, followedID int64) {
+	if !app.timelinesEnabled() {
+		return
+	}
+
+	entries, err := app.repo.Posts.GetAuthorTimelineEntries(ctx, followedID, app.cacheStorage.Timelines.MaxLen())
+	if err != nil {
+		app.logger.Warn("failed to backfill timeline", "user_id", followerID, "error", err)
+		return
+	}
+
+	if err := app.cacheStorage.Timelines.Backfill(ctx, followerID, entries); err != nil {
+		app.logger.Warn("failed to backfill timeline", "user_id", followerID, "error", err)
+	}
+}
+
+// pruneTimeline removes the posts of an unfollowed user from the timeline of
+// the former follower. Only the newest posts of the unfollowed user can be in
+// the capped timeline.
+func (app *application) pruneTimeline(ctx context.Context, followerID, unfollowedID int64) {
+	if !app.timelinesEnabled() {
+		return
+	}
+
+	entries, err := app.repo.Posts.GetAuthorTimelineEntries(ctx, unfollowedID, app.cacheStorage.Timelines.MaxLen())
+	if err != nil {
+		app.logger.Warn("failed to prune timeline", "user_id", followerID, "error", err)
+		return
+	}
+
+	postIDs := make([]int64, len(entries))
+	for i, e := range entries {
+		postIDs[i] = e.PostID
+	}
+
+	if err := app.cacheStorage.Timelines.Remove(ctx, followerID, postIDs); err != nil {
+		app.logger.Warn("failed to prune timeline", "user_id", followerID, "error", err)
+	}
+}
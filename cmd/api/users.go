@@ -2,10 +2,14 @@ package main
 
 import (
 	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
 )
 
 type userKey string
@@ -82,6 +86,8 @@ func (app *application) followUserHandler(w http.ResponseWriter, r *http.Request
 		}
 	}
 
+	app.backfillTimeline(ctx, followingUser.ID, followedID)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -117,6 +123,8 @@ func (app *application) unfollowUserHandler(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
+	app.pruneTimeline(ctx, unFollowingUser.ID, unFollowedID)
+
 	if err := app.jsonResponse(w, http.StatusNoContent, nil); err != nil {
 		app.internalServerError(w, r, err)
 	}
@@ -153,6 +161,156 @@ func (app *application) activateUserHandler(w http.ResponseWriter, r *http.Reque
 	}
 }
 
+type ResendInvitationPayload struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
+
+// ResendInvitation godoc
+//
+//	@Summary		Resends an activation email
+//	@Description	Replaces the invitation of an account that is not activated yet and emails the new
+//	@Description	activation link. The response is the same whether or not such an account exists.
+//	@Tags			users
+//	@Accept			json
+//	@Param			payload	body	ResendInvitationPayload	true	"Account email"
+//	@Success		202		"Activation email sent if the account exists"
+//	@Failure		400		{object}	error
+//	@Failure		500		{object}	error
+//	@Router			/v1/users/invitations/resend [post]
+func (app *application) resendInvitationHandler(w http.ResponseWriter, r *http.Request) {
+	var payload ResendInvitationPayload
+	if err := readJSON(w, r, &payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	if err := validate.Struct(payload); err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	// the invitation is rotated after responding, so that the response time
+	// doesn't reveal whether the account exists or is already active
+	ctx := context.WithoutCancel(r.Context())
+	app.background(func() {
+		app.resendInvitation(ctx, payload.Email)
+	})
+
+	w.WriteHeader(http.StatusAccepted)
+}
+
+// resendInvitation replaces the invitation of the pending account with the
+// email, if any, and emails the new activation link. Failures are logged, the
+// request was answered already.
+func (app *application) resendInvitation(ctx context.Context, email string) {
+	plainToken := uuid.New().String()
+
+	user, err := app.repo.Users.RotateInvitation(ctx, email, hashToken(plainToken), app.config.invitationExpTime)
+	if err != nil {
+		if !errors.Is(err, repo.ErrNotFound) {
+			app.logger.Error("failed to rotate invitation", "error", err)
+		}
+		return
+	}
+
+	status, err := app.sendInvitation(user, plainToken)
+	if err != nil {
+		app.logger.Error("error resending welcome email", "user_id", user.ID, "error", err)
+		return
+	}
+	app.logger.Info("Email sent", "status code", status)
+}
+
+// UnlockUser lifts the login lockout of a user
+//
+//	@Summary		Unlock a user account
+//	@Description	Clears the failed login attempts of a user, lifting a lockout or backoff. Admins only.
+//	@Tags			users
+//	@Param			userID	path	int64	true	"ID of the user to unlock"
+//	@Success		204		"Account unlocked"
+//	@Failure		400		{object}	map[string]string	"Invalid user ID"
+//	@Failure		403		{object}	map[string]string	"Not an admin"
+//	@Failure		404		{object}	map[string]string	"User not found"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/v1/users/{userID}/lockout [delete]
+func (app *application) unlockUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	user, err := app.repo.Users.GetByID(r.Context(), userID)
+	if err != nil {
+		switch err {
+		case repo.ErrNotFound:
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.loginTracker.Reset(r.Context(), strings.ToLower(user.Email)); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+
+	app.logger.Info("account unlocked", "user_id", user.ID, "by", getUserFromContext(r).ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteUser deletes a user account
+//
+//	@Summary		Delete a user account
+//	@Description	Soft deletes a user, who is signed out everywhere and can no longer sign in. The account can be
+//	@Description	restored until it is purged after the retention period, together with the posts and
+//	@Description	comments of the user. Requires the user.delete permission.
+//	@Tags			users
+//	@Param			userID	path	int64	true	"ID of the user to delete"
+//	@Success		204		"Account deleted"
+//	@Failure		400		{object}	map[string]string	"Invalid user ID"
+//	@Failure		403		{object}	map[string]string	"Missing permission"
+//	@Failure		404		{object}	map[string]string	"User not found"
+//	@Failure		500		{object}	map[string]string	"Internal server error"
+//	@Security		ApiKeyAuth
+//	@Router			/v1/users/{userID} [delete]
+func (app *application) deleteUserHandler(w http.ResponseWriter, r *http.Request) {
+	userID, err := strconv.ParseInt(chi.URLParam(r, "userID"), 10, 64)
+	if err != nil {
+		app.badRequestResponse(w, r, err)
+		return
+	}
+
+	ctx := r.Context()
+
+	if err := app.repo.Users.Delete(ctx, userID); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrNotFound):
+			app.notFoundResponse(w, r, err)
+		default:
+			app.internalServerError(w, r, err)
+		}
+		return
+	}
+
+	if err := app.revokeUserSessions(ctx, userID); err != nil {
+		app.internalServerError(w, r, err)
+		return
+	}
+	if app.config.redisConfig.enabled {
+		app.cacheStorage.Users.Delete(ctx, userID)
+	}
+	// the posts of the user are hidden, from their followers' feeds too
+	app.flushPostCache(ctx)
+
+	app.logger.Info("user deleted", "user_id", userID, "by", getUserFromContext(r).ID)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
 func getUserFromContext(r *http.Request) *repo.User {
 	user, _ := r.Context().Value(userCtx).(*repo.User)
 	return user
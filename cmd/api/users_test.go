@@ -1,9 +1,19 @@
 package main
 
 import (
+	"Go-Microservice/internal/breaker"
+	"Go-Microservice/internal/mailer"
+	"Go-Microservice/internal/repo"
 	"Go-Microservice/internal/repo/cache"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"net/http"
+	"strings"
+	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/mock"
 )
@@ -104,4 +114,148 @@ func TestGetUser(t *testing.T) {
 
 		mockCacheStore.Calls = nil // Reset mock expectations
 	})
-}
\ No newline at end of file
+
+	t.Run("should read from the database while Redis is unavailable", func(t *testing.T) {
+		app := newTestApplication(t, withRedis)
+		mux := app.mount()
+
+		mockCacheStore := app.cacheStorage.Users.(*cache.MockUserStore)
+		mockCacheStore.On("Get", mock.Anything).Return(nil, breaker.ErrOpen)
+
+		revocations := &cache.MockRevocationStore{}
+		revocations.On("IsRevoked", mock.Anything, mock.Anything, mock.Anything).Return(false, breaker.ErrOpen)
+		app.cacheStorage.Revocations = revocations
+
+		req, err := http.NewRequest(http.MethodGet, "/v1/users/1", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusOK, rr.Code)
+
+		mockCacheStore.AssertNotCalled(t, "Set", mock.Anything)
+	})
+}
+func TestUnlockUser(t *testing.T) {
+	app := newTestApplication(t, config{})
+	mux := app.mount()
+
+	testToken, err := app.authenticator.GenerateToken(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should forbid users without the user.unlock permission", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodDelete, "/v1/users/2/lockout", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		req.Header.Set("Authorization", "Bearer "+testToken)
+
+		rr := executeRequest(req, mux)
+
+		checkResponseCode(t, http.StatusForbidden, rr.Code)
+	})
+}
+
+// invitedUsers knows a single account that is not activated yet, and keeps
+// the hash of its current invitation token.
+type invitedUsers struct {
+	repo.MockUserStore
+	mu    sync.Mutex
+	token string
+	err   error
+}
+
+func (s *invitedUsers) RotateInvitation(ctx context.Context, email string, token string, exp time.Duration) (*repo.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return nil, s.err
+	}
+	if email != "pending@example.com" {
+		return nil, fmt.Errorf("%w: user", repo.ErrNotFound)
+	}
+	s.token = token
+	return &repo.User{ID: 1, Username: "pending", Email: email}, nil
+}
+
+func TestResendInvitation(t *testing.T) {
+	app := newTestApplication(t, config{invitationExpTime: time.Hour})
+	users := &invitedUsers{token: "old"}
+	app.repo.Users = users
+	mails := app.mailer.(*mailer.MockMailer)
+	mux := app.mount()
+
+	resend := func(t *testing.T, body string) (int, string) {
+		req, err := http.NewRequest(http.MethodPost, "/v1/users/invitations/resend", strings.NewReader(body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rr := executeRequest(req, mux)
+		// the invitation is resent after responding
+		app.tasks.Wait()
+		return rr.Code, rr.Body.String()
+	}
+
+	var sentResponse string
+
+	t.Run("should email a new activation link to a pending account", func(t *testing.T) {
+		code, body := resend(t, `{"email": "pending@example.com"}`)
+		checkResponseCode(t, http.StatusAccepted, code)
+		sentResponse = body
+
+		sent := mails.Sent()
+		if len(sent) != 1 || sent[0].Template != mailer.UserWelcomeTemplate || sent[0].Email != "pending@example.com" {
+			t.Fatalf("sent %+v", sent)
+		}
+
+		var vars struct{ ActivationURL string }
+		data, _ := json.Marshal(sent[0].Data)
+		if err := json.Unmarshal(data, &vars); err != nil {
+			t.Fatal(err)
+		}
+		token := vars.ActivationURL[strings.LastIndex(vars.ActivationURL, "/")+1:]
+		if users.token != hashToken(token) {
+			t.Error("the mailed token is not the one stored")
+		}
+	})
+
+	t.Run("should answer the same for unknown emails without sending one", func(t *testing.T) {
+		code, body := resend(t, `{"email": "nobody@example.com"}`)
+		checkResponseCode(t, http.StatusAccepted, code)
+
+		if body != sentResponse {
+			t.Errorf("got %q, want the response for a pending account %q", body, sentResponse)
+		}
+		if n := len(mails.Sent()); n != 1 {
+			t.Errorf("sent %d emails, want 1", n)
+		}
+	})
+
+	t.Run("should reject an invalid email", func(t *testing.T) {
+		code, _ := resend(t, `{"email": "not-an-email"}`)
+		checkResponseCode(t, http.StatusBadRequest, code)
+	})
+
+	t.Run("should answer the same if the invitation cannot be rotated", func(t *testing.T) {
+		users.err = errors.New("connection refused")
+		defer func() { users.err = nil }()
+
+		code, body := resend(t, `{"email": "pending@example.com"}`)
+		checkResponseCode(t, http.StatusAccepted, code)
+
+		if body != sentResponse {
+			t.Errorf("got %q, want %q", body, sentResponse)
+		}
+		if n := len(mails.Sent()); n != 1 {
+			t.Errorf("sent %d emails, want 1", n)
+		}
+	})
+}
@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS revoked_tokens
+(
+    jti    uuid PRIMARY KEY,
+    expiry timestamp(0) with time zone NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS user_token_revocations
+(
+    user_id        bigint PRIMARY KEY,
+    revoked_before timestamp(0) with time zone NOT NULL,
+    expiry         timestamp(0) with time zone NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,9 @@
+DROP TABLE IF EXISTS mfa_recovery_codes;
+
+ALTER TABLE roles
+    DROP COLUMN IF EXISTS require_mfa;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS mfa_last_step,
+    DROP COLUMN IF EXISTS mfa_enabled,
+    DROP COLUMN IF EXISTS mfa_secret;
@@ -0,0 +1,23 @@
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS mfa_secret    text,
+    ADD COLUMN IF NOT EXISTS mfa_enabled   boolean NOT NULL DEFAULT false,
+    ADD COLUMN IF NOT EXISTS mfa_last_step bigint;
+
+ALTER TABLE roles
+    ADD COLUMN IF NOT EXISTS require_mfa boolean NOT NULL DEFAULT false;
+
+UPDATE roles
+SET require_mfa = true
+WHERE name IN ('moderator', 'admin');
+
+CREATE TABLE IF NOT EXISTS mfa_recovery_codes
+(
+    id      bigserial PRIMARY KEY,
+    code    bytea                       NOT NULL,
+    user_id bigint                      NOT NULL,
+    used_at timestamp(0) with time zone,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_mfa_recovery_codes_user_id ON mfa_recovery_codes (user_id);
@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS api_keys
+(
+    id           bigserial PRIMARY KEY,
+    key          bytea UNIQUE                NOT NULL,
+    prefix       varchar(16)                 NOT NULL,
+    name         varchar(100)                NOT NULL,
+    scopes       varchar(50)[]               NOT NULL,
+    user_id      bigint                      NOT NULL,
+    expiry       timestamp(0) with time zone,
+    created_at   timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+    last_used_at timestamp(0) with time zone,
+    revoked_at   timestamp(0) with time zone,
+
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
+
+CREATE INDEX IF NOT EXISTS idx_api_keys_user_id ON api_keys (user_id);
@@ -0,0 +1,40 @@
+CREATE TABLE IF NOT EXISTS permissions
+(
+    id          bigserial PRIMARY KEY,
+    name        varchar(100) NOT NULL UNIQUE,
+    description text
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions
+(
+    role_id       bigint NOT NULL,
+    permission_id bigint NOT NULL,
+
+    PRIMARY KEY (role_id, permission_id),
+    FOREIGN KEY (role_id) REFERENCES roles (id) ON DELETE CASCADE,
+    FOREIGN KEY (permission_id) REFERENCES permissions (id) ON DELETE CASCADE
+);
+
+INSERT INTO permissions (name, description)
+VALUES ('post.update.any', 'Update posts of other users'),
+       ('post.delete.any', 'Delete posts of other users'),
+       ('comment.delete.any', 'Delete comments of other users'),
+       ('user.unlock', 'Lift the login lockout of a user'),
+       ('apikey.manage.any', 'List and revoke API keys of other users'),
+       ('role.manage', 'Grant and revoke permissions of roles')
+ON CONFLICT (name) DO NOTHING;
+
+-- Carry over what the role levels used to allow
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         JOIN permissions ON permissions.name IN ('post.update.any', 'comment.delete.any')
+WHERE roles.name = 'moderator'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         CROSS JOIN permissions
+WHERE roles.name = 'admin'
+ON CONFLICT DO NOTHING;
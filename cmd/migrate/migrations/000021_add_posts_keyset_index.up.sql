@@ -0,0 +1,2 @@
+-- Keyset pagination of the feed seeks on (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_posts_created_at_id ON posts (created_at, id);
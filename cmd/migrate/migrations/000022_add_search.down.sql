@@ -0,0 +1,15 @@
+DROP INDEX IF EXISTS idx_users_username_trgm;
+
+DROP INDEX IF EXISTS idx_comments_search_vector;
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS search_vector;
+
+DROP INDEX IF EXISTS idx_posts_search_vector;
+
+DROP TRIGGER IF EXISTS trg_posts_search_vector ON posts;
+
+DROP FUNCTION IF EXISTS posts_search_vector();
+
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS search_vector;
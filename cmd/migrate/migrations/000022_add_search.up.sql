@@ -0,0 +1,35 @@
+-- Weighted full-text search: title (A), content (B), tags (C)
+ALTER TABLE posts
+    ADD COLUMN search_vector tsvector;
+
+CREATE OR REPLACE FUNCTION posts_search_vector() RETURNS trigger AS
+$$
+BEGIN
+    NEW.search_vector :=
+            setweight(to_tsvector('english', coalesce(NEW.title, '')), 'A') ||
+            setweight(to_tsvector('english', coalesce(NEW.content, '')), 'B') ||
+            setweight(to_tsvector('english', coalesce(array_to_string(NEW.tags, ' '), '')), 'C');
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER trg_posts_search_vector
+    BEFORE INSERT OR UPDATE OF title, content, tags
+    ON posts
+    FOR EACH ROW
+EXECUTE FUNCTION posts_search_vector();
+
+UPDATE posts
+SET search_vector = setweight(to_tsvector('english', coalesce(title, '')), 'A') ||
+                    setweight(to_tsvector('english', coalesce(content, '')), 'B') ||
+                    setweight(to_tsvector('english', coalesce(array_to_string(tags, ' '), '')), 'C');
+
+CREATE INDEX IF NOT EXISTS idx_posts_search_vector ON posts USING gin (search_vector);
+
+ALTER TABLE comments
+    ADD COLUMN search_vector tsvector GENERATED ALWAYS AS (to_tsvector('english', content)) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING gin (search_vector);
+
+-- Usernames are matched by similarity, not by words
+CREATE INDEX IF NOT EXISTS idx_users_username_trgm ON users USING gin (username gin_trgm_ops);
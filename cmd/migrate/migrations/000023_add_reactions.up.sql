@@ -0,0 +1,22 @@
+CREATE TABLE IF NOT EXISTS reactions
+(
+    id         bigserial PRIMARY KEY,
+    user_id    bigint                      NOT NULL,
+    post_id    bigint,
+    comment_id bigint,
+    kind       varchar(20)                 NOT NULL,
+    created_at timestamp(0) with time zone NOT NULL DEFAULT NOW(),
+
+    -- a reaction is on either a post or a comment
+    CHECK ((post_id IS NULL) <> (comment_id IS NULL)),
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE,
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    FOREIGN KEY (comment_id) REFERENCES comments (id) ON DELETE CASCADE
+);
+
+-- one reaction per user per kind, the unique indexes also serve the counts
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_post_user_kind
+    ON reactions (post_id, user_id, kind) WHERE post_id IS NOT NULL;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_reactions_comment_user_kind
+    ON reactions (comment_id, user_id, kind) WHERE comment_id IS NOT NULL;
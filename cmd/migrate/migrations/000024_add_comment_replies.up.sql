@@ -0,0 +1,9 @@
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS parent_id bigint REFERENCES comments (id) ON DELETE CASCADE;
+
+-- top-level comments and replies are paged on (created_at, id)
+CREATE INDEX IF NOT EXISTS idx_comments_post_created_at_id
+    ON comments (post_id, created_at, id) WHERE parent_id IS NULL;
+
+CREATE INDEX IF NOT EXISTS idx_comments_parent_created_at_id
+    ON comments (parent_id, created_at, id) WHERE parent_id IS NOT NULL;
@@ -0,0 +1,5 @@
+DELETE FROM permissions WHERE name = 'comment.update.any';
+
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS edited_at,
+    DROP COLUMN IF EXISTS version;
@@ -0,0 +1,15 @@
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS version   int NOT NULL DEFAULT 0,
+    -- null until the comment is edited
+    ADD COLUMN IF NOT EXISTS edited_at timestamp(0) with time zone;
+
+INSERT INTO permissions (name, description)
+VALUES ('comment.update.any', 'Edit comments of other users')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         JOIN permissions ON permissions.name = 'comment.update.any'
+WHERE roles.name = 'admin'
+ON CONFLICT DO NOTHING;
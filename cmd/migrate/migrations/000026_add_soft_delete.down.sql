@@ -0,0 +1,20 @@
+DELETE FROM permissions WHERE name IN ('post.restore', 'comment.restore', 'user.delete', 'user.restore');
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS fk_user,
+    ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id);
+
+ALTER TABLE comments
+    DROP CONSTRAINT IF EXISTS fk_comments_user,
+    DROP CONSTRAINT IF EXISTS fk_comments_post;
+
+DROP INDEX IF EXISTS idx_users_deleted_at;
+DROP INDEX IF EXISTS idx_comments_deleted_at;
+DROP INDEX IF EXISTS idx_posts_deleted_at;
+
+ALTER TABLE users
+    DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE comments
+    DROP COLUMN IF EXISTS deleted_at;
+ALTER TABLE posts
+    DROP COLUMN IF EXISTS deleted_at;
@@ -0,0 +1,44 @@
+ALTER TABLE posts
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+ALTER TABLE comments
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+ALTER TABLE users
+    ADD COLUMN IF NOT EXISTS deleted_at timestamp(0) with time zone;
+
+-- the retention job purges deleted rows in order of deletion
+CREATE INDEX IF NOT EXISTS idx_posts_deleted_at ON posts (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_comments_deleted_at ON comments (deleted_at) WHERE deleted_at IS NOT NULL;
+CREATE INDEX IF NOT EXISTS idx_users_deleted_at ON users (deleted_at) WHERE deleted_at IS NOT NULL;
+
+-- purging a user or post takes its posts and comments with it, comments of
+-- posts deleted so far were left behind
+DELETE FROM comments WHERE post_id NOT IN (SELECT id FROM posts) OR user_id NOT IN (SELECT id FROM users);
+
+ALTER TABLE comments
+    ADD CONSTRAINT fk_comments_post FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE,
+    ADD CONSTRAINT fk_comments_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+ALTER TABLE posts
+    DROP CONSTRAINT IF EXISTS fk_user,
+    ADD CONSTRAINT fk_user FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE;
+
+INSERT INTO permissions (name, description)
+VALUES ('post.restore', 'Restore deleted posts'),
+       ('comment.restore', 'Restore deleted comments'),
+       ('user.delete', 'Delete user accounts'),
+       ('user.restore', 'Restore deleted user accounts')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         JOIN permissions ON permissions.name IN ('post.restore', 'comment.restore')
+WHERE roles.name = 'moderator'
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         JOIN permissions ON permissions.name IN ('post.restore', 'comment.restore', 'user.delete', 'user.restore')
+WHERE roles.name = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,14 @@
+-- previous versions of posts, the current version stays in posts
+CREATE TABLE IF NOT EXISTS post_revisions
+(
+    post_id    bigint                      NOT NULL,
+    version    int                         NOT NULL,
+    title      text                        NOT NULL,
+    content    text                        NOT NULL,
+    tags       varchar(100)[],
+    -- when the version was written, i.e. created_at or updated_at of the post
+    created_at timestamp(0) with time zone NOT NULL,
+
+    PRIMARY KEY (post_id, version),
+    FOREIGN KEY (post_id) REFERENCES posts (id) ON DELETE CASCADE
+);
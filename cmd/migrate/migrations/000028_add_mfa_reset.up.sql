@@ -0,0 +1,10 @@
+INSERT INTO permissions (name, description)
+VALUES ('user.mfa.reset', 'Turn off MFA for users who lost their authenticator')
+ON CONFLICT (name) DO NOTHING;
+
+INSERT INTO role_permissions (role_id, permission_id)
+SELECT roles.id, permissions.id
+FROM roles
+         JOIN permissions ON permissions.name = 'user.mfa.reset'
+WHERE roles.name = 'admin'
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,2 @@
+ALTER TABLE user_token_revocations
+    ALTER COLUMN revoked_before TYPE timestamp(0) with time zone;
@@ -0,0 +1,2 @@
+ALTER TABLE user_token_revocations
+    ALTER COLUMN revoked_before TYPE timestamp(6) with time zone;
@@ -0,0 +1,3 @@
+UPDATE roles
+SET require_mfa = true
+WHERE name IN ('moderator', 'admin');
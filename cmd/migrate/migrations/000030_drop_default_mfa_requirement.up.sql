@@ -0,0 +1,5 @@
+-- Requiring MFA on roles whose members have not enrolled yet strips their privileges,
+-- so roles require MFA only once an admin turns it on
+UPDATE roles
+SET require_mfa = false
+WHERE name IN ('moderator', 'admin');
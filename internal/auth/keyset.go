@@ -0,0 +1,290 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// SigningKey is an asymmetric private key identified by the kid header of the
+// tokens it signs. A key with a non-zero RetiredAt is no longer used for
+// signing and only verifies tokens until the grace period has elapsed.
+type SigningKey struct {
+	ID        string
+	Private   crypto.Signer
+	RetiredAt time.Time
+}
+
+// KeySetAuthenticator signs tokens with RS256 or EdDSA, depending on the type
+// of the active key, and verifies tokens signed by any key of the set that is
+// still within its grace period. Verifiers only need the public keys, which
+// are published as a JWK set.
+type KeySetAuthenticator struct {
+	keys   map[string]SigningKey
+	active SigningKey
+	grace  time.Duration
+	iss    string
+	aud    string
+	now    func() time.Time
+}
+
+// JWK is the public part of a signing key as described by RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKSet is the document served at /.well-known/jwks.json.
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyPublisher is implemented by authenticators whose verification keys can
+// be shared with other services.
+type KeyPublisher interface {
+	JWKS() JWKSet
+}
+
+func NewKeySetAuthenticator(keys []SigningKey, activeKID string, grace time.Duration, iss, aud string) (*KeySetAuthenticator, error) {
+	a := &KeySetAuthenticator{
+		keys:  make(map[string]SigningKey, len(keys)),
+		grace: grace,
+		iss:   iss,
+		aud:   aud,
+		now:   time.Now,
+	}
+
+	for _, key := range keys {
+		if _, err := signingMethod(key.Private); err != nil {
+			return nil, fmt.Errorf("key %q: %w", key.ID, err)
+		}
+		if _, exists := a.keys[key.ID]; exists {
+			return nil, fmt.Errorf("duplicate key id %q", key.ID)
+		}
+		a.keys[key.ID] = key
+	}
+
+	active, ok := a.keys[activeKID]
+	if !ok {
+		return nil, fmt.Errorf("active key %q not found", activeKID)
+	}
+	if !active.RetiredAt.IsZero() {
+		return nil, fmt.Errorf("active key %q is retired", activeKID)
+	}
+	a.active = active
+
+	return a, nil
+}
+
+func (a *KeySetAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
+	method, err := signingMethod(a.active.Private)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = a.active.ID
+
+	return token.SignedString(a.active.Private)
+}
+
+func (a *KeySetAuthenticator) ValidateToken(token string) (*jwt.Token, error) {
+	return jwt.Parse(token, func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+
+		key, ok := a.keys[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		if !a.acceptsKey(key) {
+			return nil, fmt.Errorf("signing key %q is no longer accepted", kid)
+		}
+
+		method, err := signingMethod(key.Private)
+		if err != nil {
+			return nil, err
+		}
+		if t.Method.Alg() != method.Alg() {
+			return nil, fmt.Errorf("unexpected signing method %v", t.Header["alg"])
+		}
+
+		return key.Private.Public(), nil
+	},
+		jwt.WithExpirationRequired(),
+		jwt.WithAudience(a.aud),
+		jwt.WithIssuer(a.iss),
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithTimeFunc(a.now),
+	)
+}
+
+// JWKS returns the public keys of the active key and of every retired key
+// that is still within its grace period, ordered by key id.
+func (a *KeySetAuthenticator) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+
+	for _, key := range a.keys {
+		if !a.acceptsKey(key) {
+			continue
+		}
+
+		jwk, err := publicJWK(key)
+		if err != nil {
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set
+}
+
+func (a *KeySetAuthenticator) acceptsKey(key SigningKey) bool {
+	if key.RetiredAt.IsZero() {
+		return true
+	}
+
+	return a.now().Before(key.RetiredAt.Add(a.grace))
+}
+
+// LoadSigningKeys reads every *.pem file of dir as a PKCS#8 or PKCS#1 private
+// key. The file name without extension becomes the key id. Keys listed in
+// retired are marked as retired at the given time.
+func LoadSigningKeys(dir string, retired map[string]time.Time) ([]SigningKey, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no signing keys found in %s", dir)
+	}
+
+	keys := make([]SigningKey, 0, len(paths))
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		private, err := parsePrivateKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+
+		kid := strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		keys = append(keys, SigningKey{
+			ID:        kid,
+			Private:   private,
+			RetiredAt: retired[kid],
+		})
+	}
+
+	return keys, nil
+}
+
+// ParseRetiredKeys parses a comma separated list of kid=RFC3339 pairs, e.g.
+// "2025-01=2025-06-01T00:00:00Z,2025-06=2025-12-01T00:00:00Z".
+func ParseRetiredKeys(s string) (map[string]time.Time, error) {
+	retired := make(map[string]time.Time)
+	if strings.TrimSpace(s) == "" {
+		return retired, nil
+	}
+
+	for _, entry := range strings.Split(s, ",") {
+		kid, at, ok := strings.Cut(strings.TrimSpace(entry), "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid retired key entry %q", entry)
+		}
+
+		retiredAt, err := time.Parse(time.RFC3339, at)
+		if err != nil {
+			return nil, fmt.Errorf("invalid retirement time for key %q: %w", kid, err)
+		}
+		retired[kid] = retiredAt
+	}
+
+	return retired, nil
+}
+
+func parsePrivateKey(data []byte) (crypto.Signer, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		return x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type %T", key)
+		}
+		return signer, nil
+	default:
+		return nil, fmt.Errorf("unsupported PEM block type %q", block.Type)
+	}
+}
+
+func signingMethod(key crypto.Signer) (jwt.SigningMethod, error) {
+	switch key.(type) {
+	case *rsa.PrivateKey:
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PrivateKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported signing key type %T", key)
+	}
+}
+
+func publicJWK(key SigningKey) (JWK, error) {
+	switch pub := key.Private.Public().(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			Kid: key.ID,
+			Use: "sig",
+			Alg: jwt.SigningMethodRS256.Alg(),
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}, nil
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Kid: key.ID,
+			Use: "sig",
+			Alg: jwt.SigningMethodEdDSA.Alg(),
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(pub),
+		}, nil
+	default:
+		return JWK{}, fmt.Errorf("unsupported public key type %T", pub)
+	}
+}
@@ -0,0 +1,158 @@
+package auth
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func newTestKeys(t *testing.T) (SigningKey, SigningKey) {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return SigningKey{ID: "rsa-1", Private: rsaKey}, SigningKey{ID: "ed-1", Private: edKey}
+}
+
+func testClaimsAt(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"sub": int64(1),
+		"iss": "test-iss",
+		"aud": "test-aud",
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+}
+
+func TestKeySetAuthenticator(t *testing.T) {
+	rsaKey, edKey := newTestKeys(t)
+	now := time.Now()
+
+	t.Run("should sign with the active key and set the kid header", func(t *testing.T) {
+		for _, key := range []SigningKey{rsaKey, edKey} {
+			a, err := NewKeySetAuthenticator([]SigningKey{rsaKey, edKey}, key.ID, time.Hour, "test-iss", "test-aud")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := a.GenerateToken(testClaimsAt(now))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			parsed, err := a.ValidateToken(token)
+			if err != nil {
+				t.Fatalf("ValidateToken(%s) error = %v", key.ID, err)
+			}
+			if kid := parsed.Header["kid"]; kid != key.ID {
+				t.Errorf("kid = %v, want %v", kid, key.ID)
+			}
+		}
+	})
+
+	t.Run("should verify tokens of a retired key only during the grace period", func(t *testing.T) {
+		signer, err := NewKeySetAuthenticator([]SigningKey{rsaKey}, rsaKey.ID, time.Hour, "test-iss", "test-aud")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := signer.GenerateToken(testClaimsAt(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		retired := rsaKey
+		retired.RetiredAt = now
+		verifier, err := NewKeySetAuthenticator([]SigningKey{retired, edKey}, edKey.ID, time.Hour, "test-iss", "test-aud")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		verifier.now = func() time.Time { return now.Add(30 * time.Minute) }
+		if _, err := verifier.ValidateToken(token); err != nil {
+			t.Errorf("token of retired key rejected within grace period: %v", err)
+		}
+
+		verifier.now = func() time.Time { return now.Add(61 * time.Minute) }
+		if _, err := verifier.ValidateToken(token); err == nil {
+			t.Error("token of retired key accepted after grace period")
+		}
+	})
+
+	t.Run("should reject a token signed by an unknown key", func(t *testing.T) {
+		other, err := NewKeySetAuthenticator([]SigningKey{edKey}, edKey.ID, time.Hour, "test-iss", "test-aud")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := other.GenerateToken(testClaimsAt(now))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		a, err := NewKeySetAuthenticator([]SigningKey{rsaKey}, rsaKey.ID, time.Hour, "test-iss", "test-aud")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := a.ValidateToken(token); err == nil {
+			t.Error("token signed by an unknown key was accepted")
+		}
+	})
+
+	t.Run("should not allow a retired key to be active", func(t *testing.T) {
+		retired := rsaKey
+		retired.RetiredAt = now
+
+		if _, err := NewKeySetAuthenticator([]SigningKey{retired}, retired.ID, time.Hour, "test-iss", "test-aud"); err == nil {
+			t.Error("expected an error for a retired active key")
+		}
+	})
+
+	t.Run("should publish only keys within their grace period", func(t *testing.T) {
+		retired := rsaKey
+		retired.RetiredAt = now
+
+		a, err := NewKeySetAuthenticator([]SigningKey{retired, edKey}, edKey.ID, time.Hour, "test-iss", "test-aud")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if got := len(a.JWKS().Keys); got != 2 {
+			t.Fatalf("JWKS() returned %d keys, want 2", got)
+		}
+
+		a.now = func() time.Time { return now.Add(2 * time.Hour) }
+		set := a.JWKS()
+		if len(set.Keys) != 1 || set.Keys[0].Kid != edKey.ID || set.Keys[0].Crv != "Ed25519" {
+			t.Fatalf("JWKS() after grace period = %+v, want only %s", set.Keys, edKey.ID)
+		}
+	})
+}
+
+func TestParseRetiredKeys(t *testing.T) {
+	retired, err := ParseRetiredKeys("k1=2025-06-01T00:00:00Z, k2=2025-12-01T00:00:00Z")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(retired) != 2 || retired["k2"].Month() != time.December {
+		t.Fatalf("ParseRetiredKeys returned %v", retired)
+	}
+
+	if _, err := ParseRetiredKeys("k1"); err == nil {
+		t.Error("expected an error for an entry without retirement time")
+	}
+}
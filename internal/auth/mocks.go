@@ -17,8 +17,12 @@ var testClaims = jwt.MapClaims{
 	"exp": time.Now().Add(time.Hour).Unix(),
 }
 
+// GenerateToken signs claims, or the claims of user 1 if claims is nil.
 func (a *TestAuthenticator) GenerateToken(claims jwt.Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims)
+	if claims == nil {
+		claims = testClaims
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 
 	tokenString, _ := token.SignedString([]byte(secret))
 	return tokenString, nil
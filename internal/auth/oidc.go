@@ -0,0 +1,403 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// OIDCConfig describes an external OpenID Connect identity provider.
+type OIDCConfig struct {
+	// Name identifies the provider in URLs, e.g. "google"
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+}
+
+// OIDCIdentity holds the claims of a verified ID token that are needed to
+// link the login to a local user.
+type OIDCIdentity struct {
+	Subject           string
+	Email             string
+	EmailVerified     bool
+	Name              string
+	PreferredUsername string
+}
+
+// oidcKeysRefreshInterval is how long a fetched key set is trusted before a
+// token naming an unknown key id may refetch it.
+const oidcKeysRefreshInterval = time.Minute
+
+// OIDCProvider runs the authorization code flow with PKCE (RFC 7636) against
+// a provider. Endpoints are discovered from the issuer on first use and the
+// signing keys of the provider are refetched when a token names an unknown
+// key id, at most once per oidcKeysRefreshInterval.
+type OIDCProvider struct {
+	cfg    OIDCConfig
+	client *http.Client
+	now    func() time.Time
+
+	mu        sync.Mutex
+	endpoints *oidcEndpoints
+	keys      map[string]crypto.PublicKey
+	keysAt    time.Time
+	// fetch is the fetch of the key set in flight, shared by its callers
+	fetch *keysFetch
+}
+
+type keysFetch struct {
+	done chan struct{}
+	err  error
+}
+
+type oidcEndpoints struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+}
+
+var (
+	ErrOIDCInvalidIDToken = errors.New("invalid id token")
+	ErrOIDCExchange       = errors.New("code exchange failed")
+)
+
+func NewOIDCProvider(cfg OIDCConfig, client *http.Client) *OIDCProvider {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+	if len(cfg.Scopes) == 0 {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	return &OIDCProvider{
+		cfg:    cfg,
+		client: client,
+		now:    time.Now,
+	}
+}
+
+func (p *OIDCProvider) Name() string {
+	return p.cfg.Name
+}
+
+// AuthCodeURL returns the URL of the provider to send the user to. The
+// verifier stays with us; only its S256 challenge is sent.
+func (p *OIDCProvider) AuthCodeURL(ctx context.Context, state, nonce, verifier string) (string, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	params := url.Values{}
+	params.Set("response_type", "code")
+	params.Set("client_id", p.cfg.ClientID)
+	params.Set("redirect_uri", p.cfg.RedirectURL)
+	params.Set("scope", strings.Join(p.cfg.Scopes, " "))
+	params.Set("state", state)
+	params.Set("nonce", nonce)
+	params.Set("code_challenge", PKCEChallenge(verifier))
+	params.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(endpoints.AuthURL, "?") {
+		sep = "&"
+	}
+
+	return endpoints.AuthURL + sep + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the identity of the
+// verified ID token, which must carry nonce.
+func (p *OIDCProvider) Exchange(ctx context.Context, code, verifier, nonce string) (*OIDCIdentity, error) {
+	endpoints, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.cfg.RedirectURL)
+	form.Set("client_id", p.cfg.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.cfg.ClientSecret != "" {
+		form.Set("client_secret", p.cfg.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoints.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(io.LimitReader(res.Body, 512))
+		return nil, fmt.Errorf("%w: %s: %s", ErrOIDCExchange, res.Status, body)
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, fmt.Errorf("%w: no id_token in response", ErrOIDCExchange)
+	}
+
+	return p.verifyIDToken(ctx, endpoints, tokens.IDToken, nonce)
+}
+
+func (p *OIDCProvider) verifyIDToken(ctx context.Context, endpoints *oidcEndpoints, idToken, nonce string) (*OIDCIdentity, error) {
+	var claims struct {
+		jwt.RegisteredClaims
+		Nonce             string `json:"nonce"`
+		Email             string `json:"email"`
+		EmailVerified     any    `json:"email_verified"`
+		Name              string `json:"name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+
+	_, err := jwt.ParseWithClaims(idToken, &claims,
+		func(t *jwt.Token) (any, error) {
+			kid, _ := t.Header["kid"].(string)
+			return p.publicKey(ctx, endpoints, kid)
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodRS256.Alg(), jwt.SigningMethodEdDSA.Alg()}),
+		jwt.WithIssuer(endpoints.Issuer),
+		jwt.WithAudience(p.cfg.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithTimeFunc(p.now),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOIDCInvalidIDToken, err)
+	}
+
+	if nonce == "" || claims.Nonce != nonce {
+		return nil, fmt.Errorf("%w: nonce mismatch", ErrOIDCInvalidIDToken)
+	}
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: missing sub", ErrOIDCInvalidIDToken)
+	}
+
+	// some providers send email_verified as a string
+	verified := false
+	switch v := claims.EmailVerified.(type) {
+	case bool:
+		verified = v
+	case string:
+		verified = v == "true"
+	}
+
+	return &OIDCIdentity{
+		Subject:           claims.Subject,
+		Email:             claims.Email,
+		EmailVerified:     verified,
+		Name:              claims.Name,
+		PreferredUsername: claims.PreferredUsername,
+	}, nil
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oidcEndpoints, error) {
+	p.mu.Lock()
+	endpoints := p.endpoints
+	p.mu.Unlock()
+
+	if endpoints != nil {
+		return endpoints, nil
+	}
+
+	// concurrent first requests may discover twice, which is harmless
+	wellKnown := strings.TrimSuffix(p.cfg.Issuer, "/") + "/.well-known/openid-configuration"
+
+	endpoints = &oidcEndpoints{}
+	if err := p.getJSON(ctx, wellKnown, endpoints); err != nil {
+		return nil, fmt.Errorf("oidc discovery of %s: %w", p.cfg.Name, err)
+	}
+
+	if endpoints.Issuer != p.cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery of %s: issuer %q does not match %q", p.cfg.Name, endpoints.Issuer, p.cfg.Issuer)
+	}
+	if endpoints.AuthURL == "" || endpoints.TokenURL == "" || endpoints.JWKSURL == "" {
+		return nil, fmt.Errorf("oidc discovery of %s: incomplete provider metadata", p.cfg.Name)
+	}
+
+	p.mu.Lock()
+	p.endpoints = endpoints
+	p.mu.Unlock()
+
+	return endpoints, nil
+}
+
+// publicKey returns the provider key with the given id, refetching the key set
+// if the id is unknown, e.g. after the provider rotated its keys. Concurrent
+// callers share one fetch, and unknown ids are rejected without a fetch while
+// the key set is younger than oidcKeysRefreshInterval.
+func (p *OIDCProvider) publicKey(ctx context.Context, endpoints *oidcEndpoints, kid string) (crypto.PublicKey, error) {
+	p.mu.Lock()
+	if key, ok := p.keys[kid]; ok {
+		p.mu.Unlock()
+		return key, nil
+	}
+
+	fetch := p.fetch
+	if fetch == nil {
+		if p.keys != nil && p.now().Sub(p.keysAt) < oidcKeysRefreshInterval {
+			p.mu.Unlock()
+			return nil, fmt.Errorf("unknown signing key %q", kid)
+		}
+
+		fetch = &keysFetch{done: make(chan struct{})}
+		p.fetch = fetch
+
+		// the fetch outlives the caller that started it, bounded by the
+		// timeout of the client, as others may be waiting for it
+		go func(ctx context.Context) {
+			keys, err := p.fetchKeys(ctx, endpoints)
+
+			p.mu.Lock()
+			defer p.mu.Unlock()
+			if err == nil {
+				p.keys, p.keysAt = keys, p.now()
+			}
+			fetch.err = err
+			p.fetch = nil
+			close(fetch.done)
+		}(context.WithoutCancel(ctx))
+	}
+	p.mu.Unlock()
+
+	select {
+	case <-fetch.done:
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+	if fetch.err != nil {
+		return nil, fetch.err
+	}
+
+	p.mu.Lock()
+	key, ok := p.keys[kid]
+	p.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+func (p *OIDCProvider) fetchKeys(ctx context.Context, endpoints *oidcEndpoints) (map[string]crypto.PublicKey, error) {
+	var set JWKSet
+	if err := p.getJSON(ctx, endpoints.JWKSURL, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, jwk := range set.Keys {
+		if jwk.Use != "" && jwk.Use != "sig" {
+			continue
+		}
+		key, err := parsePublicJWK(jwk)
+		if err != nil {
+			// keys of unsupported types are skipped, not fatal
+			continue
+		}
+		keys[jwk.Kid] = key
+	}
+
+	return keys, nil
+}
+
+func (p *OIDCProvider) getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	res, err := p.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s: %s", url, res.Status)
+	}
+
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// parsePublicJWK is the inverse of publicJWK for RSA and Ed25519 keys.
+func parsePublicJWK(jwk JWK) (crypto.PublicKey, error) {
+	switch jwk.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(jwk.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := base64.RawURLEncoding.DecodeString(jwk.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+	case "OKP":
+		if jwk.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", jwk.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(jwk.X)
+		if err != nil {
+			return nil, err
+		}
+		if len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key size")
+		}
+		return ed25519.PublicKey(x), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", jwk.Kty)
+	}
+}
+
+// RandomToken returns n random bytes encoded as unpadded base64url, e.g. for
+// OAuth state and nonce values or PKCE verifiers.
+func RandomToken(n int) (string, error) {
+	raw := make([]byte, n)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(raw), nil
+}
+
+// PKCEChallenge returns the S256 code challenge of a PKCE verifier.
+func PKCEChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// stubIdP is a minimal OpenID provider that issues an ID token for a single
+// authorization code.
+type stubIdP struct {
+	*httptest.Server
+	key   SigningKey
+	code  string
+	nonce string
+	// challenge is the PKCE challenge sent to the authorization endpoint
+	challenge string
+	// keyFetches counts the requests for the key set
+	keyFetches atomic.Int32
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	idp := &stubIdP{key: SigningKey{ID: "idp-1", Private: rsaKey}, code: "test-code"}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		idp.keyFetches.Add(1)
+		jwk, err := publicJWK(idp.key)
+		if err != nil {
+			t.Error(err)
+		}
+		_ = json.NewEncoder(w).Encode(JWKSet{Keys: []JWK{jwk}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if r.PostFormValue("code") != idp.code || PKCEChallenge(r.PostFormValue("code_verifier")) != idp.challenge {
+			http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+			return
+		}
+
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            idp.URL,
+			"aud":            r.PostFormValue("client_id"),
+			"sub":            "external-42",
+			"exp":            time.Now().Add(time.Minute).Unix(),
+			"iat":            time.Now().Unix(),
+			"nonce":          idp.nonce,
+			"email":          "jane@example.com",
+			"email_verified": true,
+		})
+		token.Header["kid"] = idp.key.ID
+
+		idToken, err := token.SignedString(idp.key.Private)
+		if err != nil {
+			t.Error(err)
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"id_token": idToken, "token_type": "Bearer"})
+	})
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+
+	return idp
+}
+
+// authorize plays the user agent: it follows the authorization URL and
+// records what the provider would remember about the request.
+func (idp *stubIdP) authorize(t *testing.T, authURL string) {
+	t.Helper()
+
+	u, err := url.Parse(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		t.Fatalf("code_challenge_method = %q, want S256", q.Get("code_challenge_method"))
+	}
+	idp.challenge = q.Get("code_challenge")
+	idp.nonce = q.Get("nonce")
+}
+
+func TestOIDCProvider(t *testing.T) {
+	idp := newStubIdP(t)
+	ctx := context.Background()
+
+	provider := NewOIDCProvider(OIDCConfig{
+		Name:        "stub",
+		Issuer:      idp.URL,
+		ClientID:    "client-1",
+		RedirectURL: "http://localhost/callback",
+	}, idp.Client())
+
+	start := func(t *testing.T) (verifier, nonce string) {
+		verifier, _ = RandomToken(32)
+		nonce, _ = RandomToken(16)
+
+		authURL, err := provider.AuthCodeURL(ctx, "state", nonce, verifier)
+		if err != nil {
+			t.Fatal(err)
+		}
+		idp.authorize(t, authURL)
+
+		return verifier, nonce
+	}
+
+	t.Run("should exchange a code for a verified identity", func(t *testing.T) {
+		verifier, nonce := start(t)
+
+		identity, err := provider.Exchange(ctx, idp.code, verifier, nonce)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if identity.Subject != "external-42" || identity.Email != "jane@example.com" || !identity.EmailVerified {
+			t.Errorf("unexpected identity %+v", identity)
+		}
+	})
+
+	t.Run("should reject a wrong code verifier", func(t *testing.T) {
+		_, nonce := start(t)
+
+		_, err := provider.Exchange(ctx, idp.code, "not-the-verifier", nonce)
+		if !errors.Is(err, ErrOIDCExchange) {
+			t.Errorf("error = %v, want ErrOIDCExchange", err)
+		}
+	})
+
+	t.Run("should reject an id token for another nonce", func(t *testing.T) {
+		verifier, _ := start(t)
+
+		_, err := provider.Exchange(ctx, idp.code, verifier, "other-nonce")
+		if !errors.Is(err, ErrOIDCInvalidIDToken) {
+			t.Errorf("error = %v, want ErrOIDCInvalidIDToken", err)
+		}
+	})
+
+	t.Run("should reject id tokens not signed by a published key", func(t *testing.T) {
+		verifier, nonce := start(t)
+
+		other, err := rsa.GenerateKey(rand.Reader, 2048)
+		if err != nil {
+			t.Fatal(err)
+		}
+		original := idp.key.Private
+		idp.key.Private = other
+		defer func() { idp.key.Private = original }()
+
+		// the cached key no longer matches the signature
+		_, err = provider.Exchange(ctx, idp.code, verifier, nonce)
+		if !errors.Is(err, ErrOIDCInvalidIDToken) {
+			t.Errorf("error = %v, want ErrOIDCInvalidIDToken", err)
+		}
+	})
+}
+
+func TestOIDCProviderKeyRefresh(t *testing.T) {
+	idp := newStubIdP(t)
+	ctx := context.Background()
+
+	now := time.Now()
+	provider := NewOIDCProvider(OIDCConfig{Name: "stub", Issuer: idp.URL, ClientID: "client-1"}, idp.Client())
+	provider.now = func() time.Time { return now }
+
+	endpoints, err := provider.discover(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should fetch the key set once for concurrent callers", func(t *testing.T) {
+		var wg sync.WaitGroup
+		for range 10 {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := provider.publicKey(ctx, endpoints, "idp-1"); err != nil {
+					t.Error(err)
+				}
+			}()
+		}
+		wg.Wait()
+
+		if n := idp.keyFetches.Load(); n != 1 {
+			t.Errorf("fetched the key set %d times, want 1", n)
+		}
+	})
+
+	t.Run("should not refetch for unknown key ids right away", func(t *testing.T) {
+		for range 3 {
+			if _, err := provider.publicKey(ctx, endpoints, "unknown"); err == nil {
+				t.Fatal("publicKey() found an unknown key")
+			}
+		}
+
+		if n := idp.keyFetches.Load(); n != 1 {
+			t.Errorf("fetched the key set %d times, want 1", n)
+		}
+	})
+
+	t.Run("should pick up rotated keys after the refresh interval", func(t *testing.T) {
+		idp.key.ID = "idp-2"
+		now = now.Add(oidcKeysRefreshInterval)
+
+		if _, err := provider.publicKey(ctx, endpoints, "idp-2"); err != nil {
+			t.Fatal(err)
+		}
+		if n := idp.keyFetches.Load(); n != 2 {
+			t.Errorf("fetched the key set %d times, want 2", n)
+		}
+	})
+}
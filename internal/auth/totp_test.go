@@ -0,0 +1,112 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 test key of RFC 6238, "12345678901234567890".
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	// the RFC lists 8 digit codes, these are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		got, err := TOTPCode(rfc6238Secret, time.Unix(tt.unix, 0))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got != tt.want {
+			t.Errorf("TOTPCode(%d) = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	t.Run("should accept codes of adjacent periods", func(t *testing.T) {
+		for _, offset := range []time.Duration{-TOTPPeriod, 0, TOTPPeriod} {
+			code, err := TOTPCode(rfc6238Secret, now.Add(offset))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			step, ok := ValidateTOTP(rfc6238Secret, code, now)
+			if !ok {
+				t.Fatalf("code of offset %v rejected", offset)
+			}
+			if want := now.Add(offset).Unix() / 30; step != want {
+				t.Errorf("step = %d, want %d", step, want)
+			}
+		}
+	})
+
+	t.Run("should reject codes outside the skew", func(t *testing.T) {
+		code, err := TOTPCode(rfc6238Secret, now.Add(-3*TOTPPeriod))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+			t.Error("stale code accepted")
+		}
+	})
+
+	t.Run("should reject malformed codes", func(t *testing.T) {
+		for _, code := range []string{"", "12345", "1234567", "abcdef"} {
+			if _, ok := ValidateTOTP(rfc6238Secret, code, now); ok {
+				t.Errorf("code %q accepted", code)
+			}
+		}
+	})
+}
+
+func TestGenerateTOTPSecret(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	code, err := TOTPCode(secret, time.Now())
+	if err != nil {
+		t.Fatalf("generated secret cannot be decoded: %v", err)
+	}
+	if _, ok := ValidateTOTP(secret, code, time.Now()); !ok {
+		t.Error("code of generated secret rejected")
+	}
+
+	uri := TOTPURI("GopherSocial", "john@example.com", secret)
+	if !strings.HasPrefix(uri, "otpauth://totp/GopherSocial:john@example.com?") || !strings.Contains(uri, "secret="+secret) {
+		t.Errorf("unexpected otpauth URI %s", uri)
+	}
+}
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]bool)
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("malformed recovery code %q", code)
+		}
+		if seen[code] {
+			t.Errorf("duplicate recovery code %q", code)
+		}
+		seen[code] = true
+	}
+}
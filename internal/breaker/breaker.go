@@ -0,0 +1,145 @@
+// Package breaker stops calling a dependency that keeps failing, so that
+// callers fall back right away instead of waiting for each call to time out.
+package breaker
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// States of a Breaker.
+const (
+	// Closed lets every call through
+	Closed = "closed"
+	// Open rejects every call until the cooldown has passed
+	Open = "open"
+	// HalfOpen lets a single probe through, which closes the breaker if it
+	// succeeds and opens it again otherwise
+	HalfOpen = "half-open"
+)
+
+// ErrOpen is returned for calls rejected by an open breaker.
+var ErrOpen = errors.New("circuit breaker is open")
+
+type Config struct {
+	// Failures is how many consecutive failures open the breaker
+	Failures int
+	// Cooldown is how long the breaker stays open before probing
+	Cooldown time.Duration
+}
+
+// Breaker tracks the failures of calls to a dependency.
+type Breaker struct {
+	mu       sync.Mutex
+	config   Config
+	state    string
+	failures int
+	openedAt time.Time
+	probing  bool
+	onChange func(state string)
+	now      func() time.Time
+}
+
+// New creates a closed breaker. onChange, if not nil, is called with the new
+// state whenever it changes, e.g. to log it. It is called without holding the
+// lock, so it may use the breaker, but concurrent changes may be reported out
+// of order.
+func New(config Config, onChange func(state string)) *Breaker {
+	return &Breaker{
+		config:   config,
+		state:    Closed,
+		onChange: onChange,
+		now:      time.Now,
+	}
+}
+
+// Allow returns ErrOpen if a call must not be made. Every allowed call must
+// be followed by Done.
+func (b *Breaker) Allow() error {
+	b.mu.Lock()
+	before := b.state
+	err := b.allow()
+	after := b.state
+	b.mu.Unlock()
+
+	b.notify(before, after)
+	return err
+}
+
+func (b *Breaker) allow() error {
+	switch b.state {
+	case Open:
+		if b.now().Sub(b.openedAt) < b.config.Cooldown {
+			return ErrOpen
+		}
+		b.state = HalfOpen
+		b.probing = true
+		return nil
+	case HalfOpen:
+		if b.probing {
+			return ErrOpen
+		}
+		b.probing = true
+		return nil
+	default:
+		return nil
+	}
+}
+
+// Done records the outcome of an allowed call.
+func (b *Breaker) Done(failed bool) {
+	b.mu.Lock()
+	before := b.state
+	b.done(failed)
+	after := b.state
+	b.mu.Unlock()
+
+	b.notify(before, after)
+}
+
+func (b *Breaker) done(failed bool) {
+	if b.state == HalfOpen {
+		b.probing = false
+		if failed {
+			b.trip()
+		} else {
+			b.failures = 0
+			b.state = Closed
+		}
+		return
+	}
+
+	if !failed {
+		b.failures = 0
+		return
+	}
+
+	b.failures++
+	if b.state == Closed && b.failures >= b.config.Failures {
+		b.trip()
+	}
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if b.state == Open && b.now().Sub(b.openedAt) >= b.config.Cooldown {
+		return HalfOpen
+	}
+	return b.state
+}
+
+func (b *Breaker) trip() {
+	b.openedAt = b.now()
+	b.state = Open
+}
+
+// notify reports a change of state made while holding the lock.
+func (b *Breaker) notify(before, after string) {
+	if before != after && b.onChange != nil {
+		b.onChange(after)
+	}
+}
@@ -0,0 +1,165 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestBreaker(states *[]string) (*Breaker, *fakeClock) {
+	clock := &fakeClock{t: time.Unix(1700000000, 0)}
+	b := New(Config{Failures: 3, Cooldown: 10 * time.Second}, func(state string) {
+		*states = append(*states, state)
+	})
+	b.now = clock.now
+	return b, clock
+}
+
+func call(b *Breaker, failed bool) error {
+	if err := b.Allow(); err != nil {
+		return err
+	}
+	b.Done(failed)
+	return nil
+}
+
+func TestBreaker(t *testing.T) {
+	t.Run("should open after consecutive failures", func(t *testing.T) {
+		var states []string
+		b, _ := newTestBreaker(&states)
+
+		call(b, true)
+		call(b, true)
+		call(b, false)
+		call(b, true)
+		call(b, true)
+		if b.State() != Closed {
+			t.Fatalf("state %q after interrupted failures, want %q", b.State(), Closed)
+		}
+
+		call(b, true)
+		if b.State() != Open {
+			t.Fatalf("state %q, want %q", b.State(), Open)
+		}
+		if err := b.Allow(); !errors.Is(err, ErrOpen) {
+			t.Errorf("got %v, want ErrOpen", err)
+		}
+	})
+
+	t.Run("should close after a successful probe", func(t *testing.T) {
+		var states []string
+		b, clock := newTestBreaker(&states)
+		for range 3 {
+			call(b, true)
+		}
+
+		clock.t = clock.t.Add(10 * time.Second)
+		if b.State() != HalfOpen {
+			t.Fatalf("state %q after cooldown, want %q", b.State(), HalfOpen)
+		}
+
+		if err := b.Allow(); err != nil {
+			t.Fatalf("probe rejected: %v", err)
+		}
+		if err := b.Allow(); !errors.Is(err, ErrOpen) {
+			t.Errorf("second call during probe got %v, want ErrOpen", err)
+		}
+		b.Done(false)
+
+		if b.State() != Closed {
+			t.Errorf("state %q, want %q", b.State(), Closed)
+		}
+		want := []string{Open, HalfOpen, Closed}
+		if len(states) != len(want) || states[0] != want[0] || states[1] != want[1] || states[2] != want[2] {
+			t.Errorf("got states %v, want %v", states, want)
+		}
+	})
+
+	t.Run("should reopen after a failed probe", func(t *testing.T) {
+		var states []string
+		b, clock := newTestBreaker(&states)
+		for range 3 {
+			call(b, true)
+		}
+
+		clock.t = clock.t.Add(10 * time.Second)
+		call(b, true)
+		if b.State() != Open {
+			t.Fatalf("state %q, want %q", b.State(), Open)
+		}
+
+		clock.t = clock.t.Add(5 * time.Second)
+		if err := b.Allow(); !errors.Is(err, ErrOpen) {
+			t.Errorf("got %v before the new cooldown ended, want ErrOpen", err)
+		}
+	})
+
+	t.Run("should let onChange use the breaker", func(t *testing.T) {
+		var b *Breaker
+		var states []string
+		b = New(Config{Failures: 1, Cooldown: 10 * time.Second}, func(string) {
+			states = append(states, b.State())
+		})
+
+		call(b, true)
+		if len(states) != 1 || states[0] != Open {
+			t.Errorf("got states %v, want [%s]", states, Open)
+		}
+	})
+}
+
+func TestRedisHook(t *testing.T) {
+	ctx := context.Background()
+
+	// nothing listens on the port, so every command fails to connect
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+
+	var states []string
+	b, _ := newTestBreaker(&states)
+	rdb.AddHook(RedisHook(b))
+
+	for range 3 {
+		if err := rdb.Get(ctx, "key").Err(); err == nil || errors.Is(err, ErrOpen) {
+			t.Fatalf("got %v, want a connection error", err)
+		}
+	}
+
+	if err := rdb.Get(ctx, "key").Err(); !errors.Is(err, ErrOpen) {
+		t.Errorf("got %v, want ErrOpen", err)
+	}
+	if _, err := rdb.Pipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.Get(ctx, "key")
+		return nil
+	}); !errors.Is(err, ErrOpen) {
+		t.Errorf("pipeline got %v, want ErrOpen", err)
+	}
+}
+
+func TestUnavailable(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{nil, false},
+		{redis.Nil, false},
+		{context.Canceled, false},
+		{errors.New("dial tcp: connection refused"), true},
+		{context.DeadlineExceeded, true},
+	}
+
+	for _, tt := range tests {
+		if got := unavailable(tt.err); got != tt.want {
+			t.Errorf("unavailable(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package breaker
+
+import (
+	"context"
+	"errors"
+	"net"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisHook guards the commands of a Redis client with b. While b is open,
+// commands fail with ErrOpen without reaching Redis.
+//
+// Only errors telling that Redis is unavailable count as failures; misses
+// and error replies of a working server do not.
+func RedisHook(b *Breaker) redis.Hook {
+	return redisHook{b: b}
+}
+
+type redisHook struct {
+	b *Breaker
+}
+
+func (h redisHook) DialHook(next redis.DialHook) redis.DialHook {
+	return func(ctx context.Context, network, addr string) (net.Conn, error) {
+		return next(ctx, network, addr)
+	}
+}
+
+func (h redisHook) ProcessHook(next redis.ProcessHook) redis.ProcessHook {
+	return func(ctx context.Context, cmd redis.Cmder) error {
+		if err := h.b.Allow(); err != nil {
+			cmd.SetErr(err)
+			return err
+		}
+
+		err := next(ctx, cmd)
+		h.b.Done(unavailable(err))
+		return err
+	}
+}
+
+func (h redisHook) ProcessPipelineHook(next redis.ProcessPipelineHook) redis.ProcessPipelineHook {
+	return func(ctx context.Context, cmds []redis.Cmder) error {
+		if err := h.b.Allow(); err != nil {
+			for _, cmd := range cmds {
+				cmd.SetErr(err)
+			}
+			return err
+		}
+
+		err := next(ctx, cmds)
+		h.b.Done(unavailable(err))
+		return err
+	}
+}
+
+func unavailable(err error) bool {
+	var reply redis.Error
+	switch {
+	case err == nil, errors.Is(err, redis.Nil), errors.Is(err, context.Canceled):
+		return false
+	case errors.As(err, &reply):
+		return false
+	default:
+		return true
+	}
+}
@@ -0,0 +1,149 @@
+// Package diff computes word-level differences between two texts, used to
+// show what changed between revisions of a post.
+package diff
+
+import (
+	"regexp"
+)
+
+// Kinds of diff operations.
+const (
+	Equal  = "equal"
+	Insert = "insert"
+	Delete = "delete"
+)
+
+// maxCells bounds the size of the table of longest common subsequences. Texts
+// with more word pairs are diffed as a whole replacement instead.
+const maxCells = 1 << 20
+
+// words splits text into words and the runs of whitespace between them, so
+// that joining the tokens yields the text again.
+var words = regexp.MustCompile(`\s+|\S+`)
+
+// Op is a run of text that is equal in, inserted into or deleted from the
+// old text to get the new one.
+type Op struct {
+	Type string `json:"type" example:"insert"`
+	Text string `json:"text" example:"new words "`
+}
+
+// Words returns the operations that turn oldText into newText, computed on
+// words. Consecutive operations of the same kind are merged.
+func Words(oldText, newText string) []Op {
+	a := words.FindAllString(oldText, -1)
+	b := words.FindAllString(newText, -1)
+
+	ops := []Op{}
+	add := func(kind, text string) {
+		if n := len(ops); n > 0 && ops[n-1].Type == kind {
+			ops[n-1].Text += text
+			return
+		}
+		ops = append(ops, Op{Type: kind, Text: text})
+	}
+
+	// the common prefix and suffix are equal, only the middle is compared
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		add(Equal, a[prefix])
+		prefix++
+	}
+
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	for _, op := range middle(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix]) {
+		add(op.Type, op.Text)
+	}
+
+	for _, w := range a[len(a)-suffix:] {
+		add(Equal, w)
+	}
+
+	return ops
+}
+
+// middle diffs a and b with a table of the lengths of their longest common
+// subsequences, lcs[i][j] being the length for a[i:] and b[j:].
+func middle(a, b []string) []Op {
+	var ops []Op
+
+	if (len(a)+1)*(len(b)+1) > maxCells {
+		for _, w := range a {
+			ops = append(ops, Op{Type: Delete, Text: w})
+		}
+		for _, w := range b {
+			ops = append(ops, Op{Type: Insert, Text: w})
+		}
+		return ops
+	}
+
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			ops = append(ops, Op{Type: Equal, Text: a[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			ops = append(ops, Op{Type: Delete, Text: a[i]})
+			i++
+		default:
+			ops = append(ops, Op{Type: Insert, Text: b[j]})
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		ops = append(ops, Op{Type: Delete, Text: a[i]})
+	}
+	for ; j < len(b); j++ {
+		ops = append(ops, Op{Type: Insert, Text: b[j]})
+	}
+
+	return ops
+}
+
+// Sets returns the items of newItems missing from oldItems, and the items of
+// oldItems missing from newItems, in their original order.
+func Sets(oldItems, newItems []string) (added, removed []string) {
+	in := func(items []string) map[string]bool {
+		set := make(map[string]bool, len(items))
+		for _, item := range items {
+			set[item] = true
+		}
+		return set
+	}
+
+	oldSet, newSet := in(oldItems), in(newItems)
+
+	added, removed = []string{}, []string{}
+	for _, item := range newItems {
+		if !oldSet[item] {
+			added = append(added, item)
+		}
+	}
+	for _, item := range oldItems {
+		if !newSet[item] {
+			removed = append(removed, item)
+		}
+	}
+
+	return added, removed
+}
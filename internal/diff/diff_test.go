@@ -0,0 +1,60 @@
+package diff
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWords(t *testing.T) {
+	t.Run("should mark changed words", func(t *testing.T) {
+		got := Words("the quick brown fox", "the slow brown dog")
+
+		want := []Op{
+			{Type: Equal, Text: "the "},
+			{Type: Delete, Text: "quick"},
+			{Type: Insert, Text: "slow"},
+			{Type: Equal, Text: " brown "},
+			{Type: Delete, Text: "fox"},
+			{Type: Insert, Text: "dog"},
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("should rebuild both texts", func(t *testing.T) {
+		oldText := "Getting started with Go.\n\nGo is simple and fast."
+		newText := "Getting started with Go 1.24.\n\nGo is simple, fast and fun."
+
+		var rebuiltOld, rebuiltNew strings.Builder
+		for _, op := range Words(oldText, newText) {
+			if op.Type != Insert {
+				rebuiltOld.WriteString(op.Text)
+			}
+			if op.Type != Delete {
+				rebuiltNew.WriteString(op.Text)
+			}
+		}
+
+		if rebuiltOld.String() != oldText || rebuiltNew.String() != newText {
+			t.Errorf("rebuilt %q and %q", rebuiltOld.String(), rebuiltNew.String())
+		}
+	})
+
+	t.Run("should report no changes for equal texts", func(t *testing.T) {
+		got := Words("same text", "same text")
+
+		if len(got) != 1 || got[0].Type != Equal {
+			t.Errorf("got %+v", got)
+		}
+	})
+}
+
+func TestSets(t *testing.T) {
+	added, removed := Sets([]string{"go", "web"}, []string{"go", "api", "rest"})
+
+	if !reflect.DeepEqual(added, []string{"api", "rest"}) || !reflect.DeepEqual(removed, []string{"web"}) {
+		t.Errorf("got added %v, removed %v", added, removed)
+	}
+}
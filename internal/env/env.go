@@ -57,6 +57,27 @@ func GetInt(key string, fallback int) int {
 	return parsed
 }
 
+// GetFloat retrieves a floating point environment variable with fallback support.
+// Returns the fallback value if the variable doesn't exist or parsing fails.
+func GetFloat(key string, fallback float64) float64 {
+	val := strings.TrimSpace(os.Getenv(key))
+	if val == "" {
+		return fallback
+	}
+
+	parsed, err := strconv.ParseFloat(val, 64)
+	if err != nil {
+		slog.Warn("Failed to parse float environment variable",
+			"key", key,
+			"value", val,
+			"error", err,
+			"using_fallback", fallback)
+		return fallback
+	}
+
+	return parsed
+}
+
 // GetPortInt retrieves a port number as an integer from environment variables.
 // Validates the port is within the valid range (1-65535) and returns the
 // fallback value if validation fails.
@@ -39,6 +39,17 @@ func TestGetInt(t *testing.T) {
     }
 }
 
+func TestGetFloat(t *testing.T) {
+    t.Setenv("WEIGHT", "0.25")
+    if got := GetFloat("WEIGHT", 1); got != 0.25 {
+        t.Fatalf("GetFloat valid = %v, want %v", got, 0.25)
+    }
+    t.Setenv("WEIGHT", "heavy")
+    if got := GetFloat("WEIGHT", 1.5); got != 1.5 {
+        t.Fatalf("GetFloat fallback on invalid = %v, want %v", got, 1.5)
+    }
+}
+
 func TestGetBool(t *testing.T) {
     t.Setenv("FEATURE_X", "true")
     if !GetBool("FEATURE_X", false) {
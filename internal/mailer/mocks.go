@@ -0,0 +1,33 @@
+package mailer
+
+import "sync"
+
+// MockMessage is an email sent through a MockMailer.
+type MockMessage struct {
+	Template string
+	Username string
+	Email    string
+	Data     any
+}
+
+// MockMailer records the emails sent through it instead of sending them.
+type MockMailer struct {
+	mu   sync.Mutex
+	sent []MockMessage
+}
+
+func (m *MockMailer) Send(templateFile, username, email string, data any, isSandbox bool) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.sent = append(m.sent, MockMessage{Template: templateFile, Username: username, Email: email, Data: data})
+	return 200, nil
+}
+
+// Sent returns the emails sent so far.
+func (m *MockMailer) Sent() []MockMessage {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return append([]MockMessage(nil), m.sent...)
+}
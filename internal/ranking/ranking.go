@@ -0,0 +1,146 @@
+// Package ranking scores the posts of the ranked "for you" feed. Scoring is
+// deterministic and does not touch the database: callers pass the candidate
+// posts, the signals of the reader and the current time.
+package ranking
+
+import (
+	"Go-Microservice/internal/repo"
+	"math"
+	"sort"
+	"time"
+)
+
+// Weights of the signals in the score of a post. Every signal is normalised to
+// [0, 1] before it is weighted.
+type Weights struct {
+	Recency  float64
+	Comments float64
+	Affinity float64
+	Tags     float64
+	// HalfLife is the age at which the recency of a post has halved
+	HalfLife time.Duration
+}
+
+// Candidate is a post that may be shown in the ranked feed.
+type Candidate struct {
+	PostID    int64
+	AuthorID  int64
+	CreatedAt time.Time
+	Comments  int
+	Tags      []string
+}
+
+// Scored is a candidate together with its score.
+type Scored struct {
+	Candidate
+	Score float64
+}
+
+const (
+	// commentsSaturation is the comment count that scores as much as any higher count
+	commentsSaturation = 100
+	// interactionsSaturation is the number of comments on the posts of an
+	// author after which more comments do not raise the affinity further
+	interactionsSaturation = 10
+)
+
+// Scorer scores and ranks candidates with fixed weights.
+type Scorer struct {
+	weights Weights
+}
+
+// NewScorer creates a Scorer weighting the signals of posts with weights.
+func NewScorer(weights Weights) *Scorer {
+	return &Scorer{weights: weights}
+}
+
+// Score returns the score of a candidate for a reader with the given signals.
+func (s *Scorer) Score(c Candidate, signals *repo.FeedSignals, now time.Time) float64 {
+	return s.weights.Recency*s.recency(c, now) +
+		s.weights.Comments*comments(c) +
+		s.weights.Affinity*affinity(c, signals) +
+		s.weights.Tags*tagOverlap(c, signals)
+}
+
+// Rank returns the candidates ordered by descending score. Ties go to the
+// newer post, so equal inputs always give the same order.
+func (s *Scorer) Rank(candidates []Candidate, signals *repo.FeedSignals, now time.Time) []Scored {
+	scored := make([]Scored, len(candidates))
+	for i, c := range candidates {
+		scored[i] = Scored{Candidate: c, Score: s.Score(c, signals, now)}
+	}
+
+	sort.SliceStable(scored, func(i, j int) bool {
+		a, b := scored[i], scored[j]
+		if a.Score != b.Score {
+			return a.Score > b.Score
+		}
+		if !a.CreatedAt.Equal(b.CreatedAt) {
+			return a.CreatedAt.After(b.CreatedAt)
+		}
+		return a.PostID > b.PostID
+	})
+
+	return scored
+}
+
+// recency decays exponentially with the age of the post.
+func (s *Scorer) recency(c Candidate, now time.Time) float64 {
+	if s.weights.HalfLife <= 0 {
+		return 0
+	}
+
+	age := max(now.Sub(c.CreatedAt), 0)
+	return math.Exp2(-float64(age) / float64(s.weights.HalfLife))
+}
+
+// comments grows logarithmically, so that a few comments count for more than
+// the difference between many.
+func comments(c Candidate) float64 {
+	return math.Min(math.Log1p(float64(c.Comments))/math.Log1p(commentsSaturation), 1)
+}
+
+// affinity is 0.5 for followed authors, plus 0.25 if they follow back and up
+// to 0.25 for the comments of the reader on their posts. The own posts of the
+// reader and posts of authors the reader does not follow score 0.
+func affinity(c Candidate, signals *repo.FeedSignals) float64 {
+	if signals == nil {
+		return 0
+	}
+
+	author, ok := signals.Authors[c.AuthorID]
+	if !ok {
+		return 0
+	}
+
+	score := 0.5
+	if author.Mutual {
+		score += 0.25
+	}
+	interactions := math.Log1p(float64(author.Interactions)) / math.Log1p(interactionsSaturation)
+	score += 0.25 * math.Min(interactions, 1)
+
+	return score
+}
+
+// tagOverlap is the share of the tags of the post that the reader recently
+// posted or commented under.
+func tagOverlap(c Candidate, signals *repo.FeedSignals) float64 {
+	if signals == nil || len(c.Tags) == 0 {
+		return 0
+	}
+
+	seen := make(map[string]bool, len(c.Tags))
+	matches := 0
+	for _, tag := range c.Tags {
+		if seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		if signals.Tags[tag] > 0 {
+			matches++
+		}
+	}
+
+	return float64(matches) / float64(len(seen))
+}
@@ -0,0 +1,106 @@
+package ranking
+
+import (
+	"Go-Microservice/internal/repo"
+	"math"
+	"testing"
+	"time"
+)
+
+var now = time.Date(2024, 1, 15, 12, 0, 0, 0, time.UTC)
+
+func TestScore(t *testing.T) {
+	signals := &repo.FeedSignals{
+		Authors: map[int64]repo.AuthorSignals{
+			2: {AuthorID: 2},
+			3: {AuthorID: 3, Mutual: true, Interactions: interactionsSaturation},
+		},
+		Tags: map[string]int{"go": 4},
+	}
+
+	tests := []struct {
+		name    string
+		weights Weights
+		c       Candidate
+		want    float64
+	}{
+		{
+			name:    "recency halves every half life",
+			weights: Weights{Recency: 1, HalfLife: time.Hour},
+			c:       Candidate{CreatedAt: now.Add(-2 * time.Hour)},
+			want:    0.25,
+		},
+		{
+			name:    "future posts are as recent as new ones",
+			weights: Weights{Recency: 1, HalfLife: time.Hour},
+			c:       Candidate{CreatedAt: now.Add(time.Hour)},
+			want:    1,
+		},
+		{
+			name:    "comments saturate",
+			weights: Weights{Comments: 1},
+			c:       Candidate{Comments: 10 * commentsSaturation},
+			want:    1,
+		},
+		{
+			name:    "followed author",
+			weights: Weights{Affinity: 1},
+			c:       Candidate{AuthorID: 2},
+			want:    0.5,
+		},
+		{
+			name:    "mutual author with interactions",
+			weights: Weights{Affinity: 1},
+			c:       Candidate{AuthorID: 3},
+			want:    1,
+		},
+		{
+			name:    "own posts have no affinity",
+			weights: Weights{Affinity: 1},
+			c:       Candidate{AuthorID: 1},
+			want:    0,
+		},
+		{
+			name:    "share of known tags",
+			weights: Weights{Tags: 1},
+			c:       Candidate{Tags: []string{"go", "rust", "go"}},
+			want:    0.5,
+		},
+		{
+			name:    "signals are weighted",
+			weights: Weights{Recency: 2, Affinity: 3, HalfLife: time.Hour},
+			c:       Candidate{AuthorID: 2, CreatedAt: now},
+			want:    2 + 1.5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := NewScorer(tt.weights).Score(tt.c, signals, now)
+			if math.Abs(got-tt.want) > 1e-9 {
+				t.Errorf("Score() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRank(t *testing.T) {
+	scorer := NewScorer(Weights{Recency: 1, Comments: 1, HalfLife: time.Hour})
+
+	candidates := []Candidate{
+		{PostID: 1, CreatedAt: now.Add(-time.Hour)},
+		{PostID: 2, CreatedAt: now.Add(-time.Hour), Comments: 100},
+		{PostID: 3, CreatedAt: now},
+		{PostID: 4, CreatedAt: now.Add(-time.Hour)},
+	}
+
+	ranked := scorer.Rank(candidates, nil, now)
+
+	// 4 and 1 tie on score and age, the higher id goes first
+	want := []int64{2, 3, 4, 1}
+	for i, s := range ranked {
+		if s.PostID != want[i] {
+			t.Fatalf("rank %d = post %d, want %d (ranked %+v)", i, s.PostID, want[i], ranked)
+		}
+	}
+}
@@ -2,59 +2,63 @@ package ratelimiter
 
 import (
 	"context"
-	"errors"
 	"fmt"
 	"time"
 
 	"github.com/redis/go-redis/v9"
 )
 
+// fixedWindowScript counts a request and returns the count of the window,
+// which expires with the window.
+//
+// KEYS[1] - counter of the current window
+// ARGV    - milliseconds until the window ends
+var fixedWindowScript = redis.NewScript(`
+local count = redis.call('INCR', KEYS[1])
+if count == 1 then
+	redis.call('PEXPIRE', KEYS[1], ARGV[1])
+end
+return count
+`)
+
 type RedisFixedWindowRateLimiter struct {
 	client *redis.Client
 	limit  int
 	window time.Duration
+	// fallback counts the requests of this instance while Redis is
+	// unavailable
+	fallback *FixedWindowRateLimiter
+	now      func() time.Time
 }
 
 func NewRedisFixedWindowLimiter(client *redis.Client, limit int, window time.Duration) *RedisFixedWindowRateLimiter {
 	return &RedisFixedWindowRateLimiter{
-		client: client,
-		limit:  limit,
-		window: window,
+		client:   client,
+		limit:    limit,
+		window:   window,
+		fallback: NewFixedWindowLimiter(limit, window),
+		now:      time.Now,
 	}
 }
 
-func (rl *RedisFixedWindowRateLimiter) Allow(ip string) (bool, time.Duration) {
-	ctx := context.Background()
-	key := fmt.Sprintf("rate_limit:%s", ip)
-
-	// Check current count (equivalent to RLock + read)
-	count, err := rl.client.Get(ctx, key).Int()
-	if err != nil && !errors.Is(err, redis.Nil) {
-		// Fail open - allow request if Redis error
-		return true, 0
-	}
-
-	// If key doesn't exist or count is below limit
-	if err == redis.Nil || count < rl.limit {
-		// Increment count (equivalent to Lock + increment)
-		newCount, err := rl.client.Incr(ctx, key).Result()
-		if err != nil {
-			return true, 0 // Fail open
-		}
+func (rl *RedisFixedWindowRateLimiter) Allow(ip string) Result {
+	now := rl.now()
+	start := now.Truncate(rl.window)
+	left := start.Add(rl.window).Sub(now)
 
-		// Set expiration for new keys (equivalent to resetCount goroutine)
-		if newCount == 1 {
-			rl.client.Expire(ctx, key, rl.window)
-		}
-
-		return true, 0
+	key := fmt.Sprintf("rate_limit:%s:%d", ip, start.UnixMilli())
+	count, err := fixedWindowScript.Run(context.Background(), rl.client, []string{key}, left.Milliseconds()+1).Int()
+	if err != nil {
+		return rl.fallback.Allow(ip)
 	}
 
-	// Get remaining TTL for denied requests
-	ttl, err := rl.client.TTL(ctx, key).Result()
-	if err != nil {
-		ttl = rl.window
+	result := Result{Limit: rl.limit, Reset: left}
+	if count > rl.limit {
+		result.RetryAfter = left
+		return result
 	}
 
-	return false, ttl
-}
\ No newline at end of file
+	result.Allowed = true
+	result.Remaining = rl.limit - count
+	return result
+}
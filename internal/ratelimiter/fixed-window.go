@@ -5,43 +5,59 @@ import (
 	"time"
 )
 
+// FixedWindowRateLimiter counts the requests of each client in windows
+// aligned on multiples of the window length.
 type FixedWindowRateLimiter struct {
-	sync.RWMutex
-	clients map[string]int
+	sync.Mutex
+	clients map[string]*fixedWindow
 	limit   int
 	window  time.Duration
+	janitor janitor
+	now     func() time.Time
+}
+
+type fixedWindow struct {
+	count int
+	end   time.Time
 }
 
 func NewFixedWindowLimiter(limit int, window time.Duration) *FixedWindowRateLimiter {
 	return &FixedWindowRateLimiter{
-		clients: make(map[string]int),
+		clients: make(map[string]*fixedWindow),
 		limit:   limit,
 		window:  window,
+		janitor: janitor{interval: window},
+		now:     time.Now,
 	}
 }
 
-func (rl *FixedWindowRateLimiter) Allow(ip string) (bool, time.Duration) {
-	rl.RLock()
-	count, exists := rl.clients[ip]
-	rl.RUnlock()
-
-	if !exists || count < rl.limit {
-		rl.Lock()
-		if !exists {
-			go rl.resetCount(ip)
+func (rl *FixedWindowRateLimiter) Allow(ip string) Result {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	if rl.janitor.due(now) {
+		for client, w := range rl.clients {
+			if !now.Before(w.end) {
+				delete(rl.clients, client)
+			}
 		}
+	}
 
-		rl.clients[ip]++
-		rl.Unlock()
-		return true, 0
+	w, ok := rl.clients[ip]
+	if !ok || !now.Before(w.end) {
+		w = &fixedWindow{end: now.Truncate(rl.window).Add(rl.window)}
+		rl.clients[ip] = w
 	}
 
-	return false, rl.window
-}
+	result := Result{Limit: rl.limit, Reset: w.end.Sub(now)}
+	if w.count >= rl.limit {
+		result.RetryAfter = result.Reset
+		return result
+	}
 
-func (rl *FixedWindowRateLimiter) resetCount(ip string) {
-	time.Sleep(rl.window)
-	rl.Lock()
-	delete(rl.clients, ip)
-	rl.Unlock()
-}
\ No newline at end of file
+	w.count++
+	result.Allowed = true
+	result.Remaining = rl.limit - w.count
+	return result
+}
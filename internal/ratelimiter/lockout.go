@@ -0,0 +1,307 @@
+package ratelimiter
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// LockoutConfig controls how failed logins of a single account are throttled.
+//
+// The first FreeAttempts failures are not penalised. Every further failure
+// blocks the account for BaseDelay, doubling with each failure, until
+// MaxAttempts is reached and the account is locked for LockoutDuration.
+// Failures are forgotten after Window without a new failure.
+type LockoutConfig struct {
+	FreeAttempts    int
+	BaseDelay       time.Duration
+	MaxAttempts     int
+	LockoutDuration time.Duration
+	Window          time.Duration
+	// MaxKeys caps the accounts an InMemoryLoginTracker remembers, 0 for no cap
+	MaxKeys int
+	Enabled bool
+}
+
+// LockoutStatus describes the state of an account after a check or a failure.
+type LockoutStatus struct {
+	// Failures is the number of consecutive failed attempts
+	Failures int
+	// Locked is true once MaxAttempts has been reached
+	Locked bool
+	// RetryAfter is how long attempts are blocked; zero if they are allowed
+	RetryAfter time.Duration
+}
+
+// Blocked reports whether login attempts must be rejected right now.
+func (s LockoutStatus) Blocked() bool {
+	return s.RetryAfter > 0
+}
+
+// LoginTracker tracks failed login attempts per account key (e.g. the email).
+type LoginTracker interface {
+	Check(ctx context.Context, key string) (LockoutStatus, error)
+	RecordFailure(ctx context.Context, key string) (LockoutStatus, error)
+	Reset(ctx context.Context, key string) error
+}
+
+// blockedFor returns how long an account with the given number of failures is
+// blocked after its latest failure, and whether it is locked.
+func (c LockoutConfig) blockedFor(failures int) (time.Duration, bool) {
+	if c.MaxAttempts > 0 && failures >= c.MaxAttempts {
+		return c.LockoutDuration, true
+	}
+
+	if failures <= c.FreeAttempts {
+		return 0, false
+	}
+
+	delay := c.BaseDelay << (failures - c.FreeAttempts - 1)
+	if delay <= 0 || delay > c.LockoutDuration {
+		delay = c.LockoutDuration
+	}
+
+	return delay, false
+}
+
+type loginAttempts struct {
+	key          string
+	failures     int
+	blockedUntil time.Time
+	lastFailure  time.Time
+}
+
+// InMemoryLoginTracker keeps failed attempts in process memory. It is used
+// when Redis is disabled and is only accurate for a single instance.
+//
+// Attempts are kept in the order of their latest failure. Once MaxKeys
+// accounts are tracked, the account that failed least recently is forgotten
+// to make room, so that logins with random emails can't exhaust the memory.
+type InMemoryLoginTracker struct {
+	sync.Mutex
+	config   LockoutConfig
+	attempts map[string]*list.Element
+	order    *list.List
+	now      func() time.Time
+}
+
+func NewInMemoryLoginTracker(config LockoutConfig) *InMemoryLoginTracker {
+	return &InMemoryLoginTracker{
+		config:   config,
+		attempts: make(map[string]*list.Element),
+		order:    list.New(),
+		now:      time.Now,
+	}
+}
+
+func (t *InMemoryLoginTracker) Check(ctx context.Context, key string) (LockoutStatus, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	return t.status(t.current(key)), nil
+}
+
+func (t *InMemoryLoginTracker) RecordFailure(ctx context.Context, key string) (LockoutStatus, error) {
+	t.Lock()
+	defer t.Unlock()
+
+	now := t.now()
+
+	a := t.current(key)
+	if a == nil {
+		t.evict()
+		a = &loginAttempts{key: key}
+		t.attempts[key] = t.order.PushBack(a)
+	} else {
+		t.order.MoveToBack(t.attempts[key])
+	}
+
+	// a lockout that ran out starts a new series of attempts
+	if t.config.MaxAttempts > 0 && a.failures >= t.config.MaxAttempts && !now.Before(a.blockedUntil) {
+		a.failures = 0
+	}
+
+	a.failures++
+	a.lastFailure = now
+
+	delay, _ := t.config.blockedFor(a.failures)
+	a.blockedUntil = now.Add(delay)
+
+	return t.status(a), nil
+}
+
+func (t *InMemoryLoginTracker) Reset(ctx context.Context, key string) error {
+	t.Lock()
+	defer t.Unlock()
+
+	t.remove(key)
+	return nil
+}
+
+// current returns the attempts of key, discarding them once they have expired.
+func (t *InMemoryLoginTracker) current(key string) *loginAttempts {
+	e, ok := t.attempts[key]
+	if !ok {
+		return nil
+	}
+
+	a := e.Value.(*loginAttempts)
+	if t.expired(a) {
+		t.remove(key)
+		return nil
+	}
+
+	return a
+}
+
+// evict makes room for an account: it discards the expired attempts that
+// failed least recently, and the least recent ones beyond MaxKeys.
+func (t *InMemoryLoginTracker) evict() {
+	for e := t.order.Front(); e != nil; e = t.order.Front() {
+		a := e.Value.(*loginAttempts)
+		if !t.expired(a) && (t.config.MaxKeys <= 0 || t.order.Len() < t.config.MaxKeys) {
+			return
+		}
+		t.remove(a.key)
+	}
+}
+
+func (t *InMemoryLoginTracker) expired(a *loginAttempts) bool {
+	now := t.now()
+	return now.After(a.lastFailure.Add(t.config.Window)) && !now.Before(a.blockedUntil)
+}
+
+func (t *InMemoryLoginTracker) remove(key string) {
+	if e, ok := t.attempts[key]; ok {
+		t.order.Remove(e)
+		delete(t.attempts, key)
+	}
+}
+
+func (t *InMemoryLoginTracker) status(a *loginAttempts) LockoutStatus {
+	if a == nil {
+		return LockoutStatus{}
+	}
+
+	status := LockoutStatus{Failures: a.failures}
+	if retryAfter := a.blockedUntil.Sub(t.now()); retryAfter > 0 {
+		status.RetryAfter = retryAfter
+		_, status.Locked = t.config.blockedFor(a.failures)
+	}
+
+	return status
+}
+
+// recordFailureScript atomically increments the failure counter of an account
+// and stores until when it is blocked, mirroring LockoutConfig.blockedFor.
+//
+// KEYS[1] - attempts hash
+// ARGV    - now, free attempts, base delay, max attempts, lockout duration and
+// window, all times in milliseconds
+//
+// Returns the new failure count and the block end in milliseconds.
+var recordFailureScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local free_attempts = tonumber(ARGV[2])
+local base_delay = tonumber(ARGV[3])
+local max_attempts = tonumber(ARGV[4])
+local lockout = tonumber(ARGV[5])
+local window = tonumber(ARGV[6])
+
+local failures = tonumber(redis.call('HGET', KEYS[1], 'failures') or '0')
+local blocked_until = tonumber(redis.call('HGET', KEYS[1], 'blocked_until') or '0')
+
+-- a lockout that ran out starts a new series of attempts
+if max_attempts > 0 and failures >= max_attempts and now >= blocked_until then
+	failures = 0
+end
+failures = failures + 1
+
+local delay = 0
+if max_attempts > 0 and failures >= max_attempts then
+	delay = lockout
+elseif failures > free_attempts then
+	delay = math.floor(math.min(base_delay * 2 ^ (failures - free_attempts - 1), lockout))
+end
+blocked_until = now + delay
+
+redis.call('HSET', KEYS[1], 'failures', failures, 'blocked_until', blocked_until)
+redis.call('PEXPIRE', KEYS[1], math.max(window, delay))
+
+return {failures, blocked_until}
+`)
+
+// RedisLoginTracker keeps failed attempts in Redis so that every instance of
+// the service sees the same counters.
+type RedisLoginTracker struct {
+	client *redis.Client
+	config LockoutConfig
+	now    func() time.Time
+}
+
+func NewRedisLoginTracker(client *redis.Client, config LockoutConfig) *RedisLoginTracker {
+	return &RedisLoginTracker{
+		client: client,
+		config: config,
+		now:    time.Now,
+	}
+}
+
+func (t *RedisLoginTracker) Check(ctx context.Context, key string) (LockoutStatus, error) {
+	values, err := t.client.HMGet(ctx, t.key(key), "failures", "blocked_until").Result()
+	if err != nil {
+		return LockoutStatus{}, err
+	}
+
+	var failures int
+	var blockedUntil int64
+	if values[0] != nil {
+		fmt.Sscan(values[0].(string), &failures)
+	}
+	if values[1] != nil {
+		fmt.Sscan(values[1].(string), &blockedUntil)
+	}
+
+	return t.status(failures, time.UnixMilli(blockedUntil)), nil
+}
+
+func (t *RedisLoginTracker) RecordFailure(ctx context.Context, key string) (LockoutStatus, error) {
+	result, err := recordFailureScript.Run(
+		ctx,
+		t.client,
+		[]string{t.key(key)},
+		t.now().UnixMilli(),
+		t.config.FreeAttempts,
+		t.config.BaseDelay.Milliseconds(),
+		t.config.MaxAttempts,
+		t.config.LockoutDuration.Milliseconds(),
+		t.config.Window.Milliseconds(),
+	).Int64Slice()
+	if err != nil {
+		return LockoutStatus{}, err
+	}
+
+	return t.status(int(result[0]), time.UnixMilli(result[1])), nil
+}
+
+func (t *RedisLoginTracker) Reset(ctx context.Context, key string) error {
+	return t.client.Del(ctx, t.key(key)).Err()
+}
+
+func (t *RedisLoginTracker) status(failures int, blockedUntil time.Time) LockoutStatus {
+	status := LockoutStatus{Failures: failures}
+	if retryAfter := blockedUntil.Sub(t.now()); retryAfter > 0 {
+		status.RetryAfter = retryAfter
+		_, status.Locked = t.config.blockedFor(failures)
+	}
+
+	return status
+}
+
+func (t *RedisLoginTracker) key(key string) string {
+	return fmt.Sprintf("login_attempts:%s", key)
+}
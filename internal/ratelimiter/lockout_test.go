@@ -0,0 +1,199 @@
+package ratelimiter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type newLoginTracker func(config LockoutConfig, now func() time.Time) LoginTracker
+
+// loginTrackers returns every login tracker by name. The Redis one is only
+// tested against the server at REDIS_TEST_ADDR, if set.
+func loginTrackers(t *testing.T) map[string]newLoginTracker {
+	trackers := map[string]newLoginTracker{
+		"in-memory": func(config LockoutConfig, now func() time.Time) LoginTracker {
+			tracker := NewInMemoryLoginTracker(config)
+			tracker.now = now
+			return tracker
+		},
+	}
+
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		return trackers
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("failed to connect to redis at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	trackers["redis"] = func(config LockoutConfig, now func() time.Time) LoginTracker {
+		tracker := NewRedisLoginTracker(client, config)
+		tracker.now = now
+		return tracker
+	}
+
+	return trackers
+}
+
+func TestLoginTracker(t *testing.T) {
+	ctx := context.Background()
+
+	config := LockoutConfig{
+		FreeAttempts:    2,
+		BaseDelay:       time.Second,
+		MaxAttempts:     5,
+		LockoutDuration: time.Minute,
+		Window:          time.Hour,
+	}
+
+	for name, newTracker := range loginTrackers(t) {
+		t.Run(name, func(t *testing.T) {
+			now := time.Now()
+			tracker := newTracker(config, func() time.Time { return now })
+			// keys outlive the test in Redis
+			key := fmt.Sprintf("alice-%d@example.com", now.UnixNano())
+
+			record := func(t *testing.T) LockoutStatus {
+				t.Helper()
+				status, err := tracker.RecordFailure(ctx, key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				return status
+			}
+
+			t.Run("should not penalise the free attempts", func(t *testing.T) {
+				for i := 0; i < config.FreeAttempts; i++ {
+					if status := record(t); status.Blocked() {
+						t.Fatalf("attempt %d blocked: %+v", i+1, status)
+					}
+				}
+			})
+
+			t.Run("should back off exponentially after the free attempts", func(t *testing.T) {
+				for _, want := range []time.Duration{time.Second, 2 * time.Second} {
+					status := record(t)
+					if status.RetryAfter != want || status.Locked {
+						t.Fatalf("RecordFailure() = %+v, want RetryAfter %v", status, want)
+					}
+					now = now.Add(want)
+				}
+			})
+
+			t.Run("should lock the account after max attempts", func(t *testing.T) {
+				status := record(t)
+				if !status.Locked || status.RetryAfter != config.LockoutDuration {
+					t.Fatalf("RecordFailure() = %+v, want locked for %v", status, config.LockoutDuration)
+				}
+
+				now = now.Add(30 * time.Second)
+				status, _ = tracker.Check(ctx, key)
+				if !status.Locked || !status.Blocked() {
+					t.Fatalf("Check() during lockout = %+v", status)
+				}
+			})
+
+			t.Run("should start over once the lockout ran out", func(t *testing.T) {
+				now = now.Add(config.LockoutDuration)
+				if status, _ := tracker.Check(ctx, key); status.Blocked() {
+					t.Fatalf("Check() after lockout = %+v", status)
+				}
+
+				if status := record(t); status.Failures != 1 || status.Blocked() {
+					t.Fatalf("RecordFailure() after lockout = %+v", status)
+				}
+			})
+
+			t.Run("should forget failures on reset", func(t *testing.T) {
+				if err := tracker.Reset(ctx, key); err != nil {
+					t.Fatal(err)
+				}
+
+				if status, _ := tracker.Check(ctx, key); status.Failures != 0 {
+					t.Fatalf("Check() after reset = %+v", status)
+				}
+			})
+		})
+	}
+}
+
+func TestInMemoryLoginTrackerEviction(t *testing.T) {
+	ctx := context.Background()
+
+	now := time.Now()
+	tracker := NewInMemoryLoginTracker(LockoutConfig{
+		FreeAttempts:    1,
+		BaseDelay:       time.Second,
+		MaxAttempts:     3,
+		LockoutDuration: time.Minute,
+		Window:          time.Hour,
+		MaxKeys:         3,
+	})
+	tracker.now = func() time.Time { return now }
+
+	t.Run("should forget the accounts that failed least recently beyond MaxKeys", func(t *testing.T) {
+		for _, key := range []string{"a", "b", "c", "a", "d"} {
+			tracker.RecordFailure(ctx, key)
+			now = now.Add(time.Second)
+		}
+
+		if n := tracker.order.Len(); n != 3 {
+			t.Fatalf("tracking %d accounts, want 3", n)
+		}
+		if status, _ := tracker.Check(ctx, "b"); status.Failures != 0 {
+			t.Errorf("Check(b) = %+v, want forgotten", status)
+		}
+		if status, _ := tracker.Check(ctx, "a"); status.Failures != 2 {
+			t.Errorf("Check(a) = %+v, want 2 failures", status)
+		}
+	})
+
+	t.Run("should drop expired accounts first", func(t *testing.T) {
+		now = now.Add(2 * time.Hour)
+		tracker.RecordFailure(ctx, "e")
+
+		if n := tracker.order.Len(); n != 1 {
+			t.Fatalf("tracking %d accounts, want 1", n)
+		}
+	})
+}
+
+func TestRedisLoginTrackerUnavailable(t *testing.T) {
+	// nothing listens on the port, so every command fails to connect
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+
+	tracker := NewRedisLoginTracker(client, LockoutConfig{MaxAttempts: 3, LockoutDuration: time.Minute, Window: time.Hour})
+
+	t.Run("should report Redis failures", func(t *testing.T) {
+		ctx := context.Background()
+
+		if _, err := tracker.Check(ctx, "alice@example.com"); err == nil {
+			t.Error("Check() succeeded without Redis")
+		}
+		if _, err := tracker.RecordFailure(ctx, "alice@example.com"); err == nil {
+			t.Error("RecordFailure() succeeded without Redis")
+		}
+		if err := tracker.Reset(ctx, "alice@example.com"); err == nil {
+			t.Error("Reset() succeeded without Redis")
+		}
+	})
+
+	t.Run("should stop with the context of the request", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+
+		if _, err := tracker.RecordFailure(ctx, "alice@example.com"); !errors.Is(err, context.Canceled) {
+			t.Errorf("RecordFailure() = %v, want context.Canceled", err)
+		}
+	})
+}
@@ -0,0 +1,243 @@
+package ratelimiter
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// What a policy counts requests by. Requests without an API key are counted
+// by user, and anonymous requests by IP.
+const (
+	KeyIP     = "ip"
+	KeyUser   = "user"
+	KeyAPIKey = "api_key"
+)
+
+// Policy is the rate limit of a group of routes.
+type Policy struct {
+	// Name identifies the policy in the configuration and in Redis keys
+	Name string
+	// Key is one of KeyIP, KeyUser and KeyAPIKey
+	Key    string
+	Limit  int
+	Window time.Duration
+	// Tiers replace Limit for users of higher role levels
+	Tiers []Tier
+}
+
+// Tier is the limit of a policy for users whose role level is at least Level.
+type Tier struct {
+	Level int `json:"level"`
+	Limit int `json:"limit"`
+}
+
+// Subject is who a request is made by.
+type Subject struct {
+	IP string
+	// UserID is 0 for anonymous requests
+	UserID int64
+	// APIKeyID is 0 unless the request is authenticated with an API key
+	APIKeyID int64
+	// Level is the role level of the user
+	Level int
+}
+
+func (p Policy) validate() error {
+	if !slices.Contains([]string{KeyIP, KeyUser, KeyAPIKey}, p.Key) {
+		return fmt.Errorf("policy %q: unknown key %q", p.Name, p.Key)
+	}
+	if p.Limit <= 0 || p.Window <= 0 {
+		return fmt.Errorf("policy %q: invalid limit of %d requests per %v", p.Name, p.Limit, p.Window)
+	}
+	for _, tier := range p.Tiers {
+		if tier.Limit <= 0 {
+			return fmt.Errorf("policy %q: invalid limit %d for level %d", p.Name, tier.Limit, tier.Level)
+		}
+	}
+	return nil
+}
+
+// validateOverride checks the fields set in an override, which leaves the
+// others to the policy it is merged with.
+func (p Policy) validateOverride() error {
+	if p.Key != "" && !slices.Contains([]string{KeyIP, KeyUser, KeyAPIKey}, p.Key) {
+		return fmt.Errorf("policy %q: unknown key %q", p.Name, p.Key)
+	}
+	if p.Limit < 0 {
+		return fmt.Errorf("policy %q: invalid limit %d", p.Name, p.Limit)
+	}
+	if p.Window < 0 {
+		return fmt.Errorf("policy %q: invalid window %v", p.Name, p.Window)
+	}
+	for _, tier := range p.Tiers {
+		if tier.Limit <= 0 {
+			return fmt.Errorf("policy %q: invalid limit %d for level %d", p.Name, tier.Limit, tier.Level)
+		}
+	}
+	return nil
+}
+
+// merge returns p with the fields set in override.
+func (p Policy) merge(override Policy) Policy {
+	if override.Key != "" {
+		p.Key = override.Key
+	}
+	if override.Limit != 0 {
+		p.Limit = override.Limit
+	}
+	if override.Window != 0 {
+		p.Window = override.Window
+	}
+	if override.Tiers != nil {
+		p.Tiers = override.Tiers
+	}
+	return p
+}
+
+// subjectKey returns what the requests of s are counted by.
+func (p Policy) subjectKey(s Subject) string {
+	switch {
+	case p.Key == KeyAPIKey && s.APIKeyID != 0:
+		return fmt.Sprintf("api_key:%d", s.APIKeyID)
+	case p.Key != KeyIP && s.UserID != 0:
+		return fmt.Sprintf("user:%d", s.UserID)
+	default:
+		return "ip:" + s.IP
+	}
+}
+
+// ParsePolicies parses policies from JSON objects keyed by policy name, with
+// windows written as Go durations:
+//
+//	{"feed": {"key": "user", "limit": 60, "window": "1m", "tiers": [{"level": 3, "limit": 600}]}}
+//
+// Fields left out keep the values declared by the routes. Overrides of
+// policies not in names, or with invalid fields, are rejected.
+func ParsePolicies(data []byte, names []string) (map[string]Policy, error) {
+	var raw map[string]struct {
+		Key    string `json:"key"`
+		Limit  int    `json:"limit"`
+		Window string `json:"window"`
+		Tiers  []Tier `json:"tiers"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("failed to parse rate limit policies: %w", err)
+	}
+
+	policies := make(map[string]Policy, len(raw))
+	for name, r := range raw {
+		if !slices.Contains(names, name) {
+			return nil, fmt.Errorf("unknown rate limit policy %q", name)
+		}
+
+		p := Policy{Name: name, Key: r.Key, Limit: r.Limit, Tiers: r.Tiers}
+		if r.Window != "" {
+			window, err := time.ParseDuration(r.Window)
+			if err != nil {
+				return nil, fmt.Errorf("policy %q: invalid window: %w", name, err)
+			}
+			p.Window = window
+		}
+		if err := p.validateOverride(); err != nil {
+			return nil, err
+		}
+		policies[name] = p
+	}
+
+	return policies, nil
+}
+
+// Engine enforces policies, each with a limiter per tier.
+type Engine struct {
+	sync.RWMutex
+	config   Config
+	client   *redis.Client
+	policies map[string]*enforcedPolicy
+}
+
+type enforcedPolicy struct {
+	Policy
+	// limiters[0] enforces Limit, limiters[i+1] Tiers[i]
+	limiters []Limiter
+}
+
+// NewEngine creates an engine using config.Algorithm, in Redis unless client
+// is nil. config.Policies override the policies registered later.
+func NewEngine(config Config, client *redis.Client) *Engine {
+	return &Engine{
+		config:   config,
+		client:   client,
+		policies: make(map[string]*enforcedPolicy),
+	}
+}
+
+// Register starts enforcing a policy, merged with the configured override of
+// the same name. Registering a name again keeps the first policy.
+func (e *Engine) Register(p Policy) error {
+	e.Lock()
+	defer e.Unlock()
+
+	if _, ok := e.policies[p.Name]; ok {
+		return nil
+	}
+
+	if override, ok := e.config.Policies[p.Name]; ok {
+		p = p.merge(override)
+	}
+	if err := p.validate(); err != nil {
+		return err
+	}
+
+	// the highest tier a user reaches applies
+	p.Tiers = slices.Clone(p.Tiers)
+	slices.SortFunc(p.Tiers, func(a, b Tier) int { return b.Level - a.Level })
+
+	enforced := &enforcedPolicy{Policy: p}
+	for _, limit := range append([]int{p.Limit}, tierLimits(p.Tiers)...) {
+		limiter, err := New(Config{RequestsPerTimeFrame: limit, TimeFrame: p.Window, Algorithm: e.config.Algorithm}, e.client)
+		if err != nil {
+			return fmt.Errorf("policy %q: %w", p.Name, err)
+		}
+		enforced.limiters = append(enforced.limiters, limiter)
+	}
+
+	e.policies[p.Name] = enforced
+	return nil
+}
+
+// Allow counts a request of s against the named policy. Requests to policies
+// that were not registered are allowed.
+func (e *Engine) Allow(policy string, s Subject) Result {
+	e.RLock()
+	p, ok := e.policies[policy]
+	e.RUnlock()
+	if !ok {
+		return Result{Allowed: true}
+	}
+
+	tier := 0
+	if s.UserID != 0 {
+		for i, t := range p.Tiers {
+			if s.Level >= t.Level {
+				tier = i + 1
+				break
+			}
+		}
+	}
+
+	key := fmt.Sprintf("%s:%d:%s", p.Name, tier, p.subjectKey(s))
+	return p.limiters[tier].Allow(key)
+}
+
+func tierLimits(tiers []Tier) []int {
+	limits := make([]int, len(tiers))
+	for i, t := range tiers {
+		limits[i] = t.Limit
+	}
+	return limits
+}
@@ -0,0 +1,102 @@
+package ratelimiter
+
+import (
+	"testing"
+	"time"
+)
+
+func TestEngine(t *testing.T) {
+	overrides, err := ParsePolicies([]byte(`{"feed": {"limit": 2, "tiers": [{"level": 2, "limit": 3}]}}`), []string{"feed", "login", "api"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	engine := NewEngine(Config{Algorithm: SlidingWindow, Policies: overrides}, nil)
+	policies := []Policy{
+		{Name: "feed", Key: KeyUser, Limit: 60, Window: time.Minute},
+		{Name: "login", Key: KeyIP, Limit: 1, Window: time.Minute},
+		{Name: "api", Key: KeyAPIKey, Limit: 1, Window: time.Minute},
+	}
+	for _, p := range policies {
+		if err := engine.Register(p); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	allowed := func(policy string, s Subject) int {
+		n := 0
+		for i := 0; i < 5; i++ {
+			if engine.Allow(policy, s).Allowed {
+				n++
+			}
+		}
+		return n
+	}
+
+	t.Run("should apply the overridden limit of the tier", func(t *testing.T) {
+		if n := allowed("feed", Subject{IP: "10.0.0.1", UserID: 1, Level: 1}); n != 2 {
+			t.Errorf("user allowed %d requests, want 2", n)
+		}
+		if n := allowed("feed", Subject{IP: "10.0.0.1", UserID: 2, Level: 3}); n != 3 {
+			t.Errorf("admin allowed %d requests, want 3", n)
+		}
+	})
+
+	t.Run("should count users behind one IP separately", func(t *testing.T) {
+		if n := allowed("feed", Subject{IP: "10.0.0.1", UserID: 3, Level: 1}); n != 2 {
+			t.Errorf("user allowed %d requests, want 2", n)
+		}
+	})
+
+	t.Run("should count by IP", func(t *testing.T) {
+		if n := allowed("login", Subject{IP: "10.0.0.2", UserID: 1}) + allowed("login", Subject{IP: "10.0.0.2", UserID: 2}); n != 1 {
+			t.Errorf("IP allowed %d requests, want 1", n)
+		}
+	})
+
+	t.Run("should count API keys separately from their user", func(t *testing.T) {
+		n := allowed("api", Subject{UserID: 1}) +
+			allowed("api", Subject{UserID: 1, APIKeyID: 1}) +
+			allowed("api", Subject{UserID: 1, APIKeyID: 2})
+		if n != 3 {
+			t.Errorf("allowed %d requests, want 3", n)
+		}
+	})
+
+	t.Run("should reject invalid policies", func(t *testing.T) {
+		if err := engine.Register(Policy{Name: "bad", Key: "session", Limit: 1, Window: time.Minute}); err == nil {
+			t.Error("Register() accepted an unknown key")
+		}
+	})
+}
+
+func TestParsePolicies(t *testing.T) {
+	names := []string{"feed", "auth"}
+
+	t.Run("should parse overrides of known policies", func(t *testing.T) {
+		policies, err := ParsePolicies([]byte(`{"auth": {"key": "ip", "window": "30s"}}`), names)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if p := policies["auth"]; p.Key != KeyIP || p.Window != 30*time.Second || p.Limit != 0 {
+			t.Errorf("got %+v", p)
+		}
+	})
+
+	invalid := map[string]string{
+		"unknown policy":  `{"fed": {"limit": 10}}`,
+		"unknown key":     `{"feed": {"key": "email"}}`,
+		"negative limit":  `{"feed": {"limit": -1}}`,
+		"bad window":      `{"feed": {"window": "1 minute"}}`,
+		"negative window": `{"feed": {"window": "-1m"}}`,
+		"tier limit":      `{"feed": {"tiers": [{"level": 2}]}}`,
+		"malformed":       `{"feed": 10}`,
+	}
+	for name, data := range invalid {
+		t.Run("should reject an "+name, func(t *testing.T) {
+			if _, err := ParsePolicies([]byte(data), names); err == nil {
+				t.Errorf("ParsePolicies(%s) succeeded", data)
+			}
+		})
+	}
+}
@@ -1,13 +1,94 @@
 package ratelimiter
 
-import "time"
+import (
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// Algorithms a Limiter can use.
+const (
+	// FixedWindow counts requests in consecutive windows, which lets up to
+	// twice the limit through around the edge of two windows.
+	FixedWindow = "fixed-window"
+	// SlidingWindow remembers the time of each allowed request, so that no
+	// window of the configured length ever holds more than the limit.
+	SlidingWindow = "sliding-window"
+	// TokenBucket allows bursts of up to the limit, refilled evenly over the
+	// time frame.
+	TokenBucket = "token-bucket"
+)
 
 type Limiter interface {
-	Allow(ip string) (bool, time.Duration)
+	// Allow counts a request of the client identified by key.
+	Allow(key string) Result
+}
+
+// Result is the outcome of counting a request, with the quota left to the
+// client.
+type Result struct {
+	Allowed bool
+	Limit   int
+	// Remaining is how many more requests are allowed right now
+	Remaining int
+	// Reset is how long until the full limit is available again
+	Reset time.Duration
+	// RetryAfter is how long until a request is allowed again, zero if this
+	// one was allowed
+	RetryAfter time.Duration
 }
 
 type Config struct {
 	RequestsPerTimeFrame int
 	TimeFrame            time.Duration
 	Enabled              bool
+	// Algorithm is one of FixedWindow, SlidingWindow and TokenBucket
+	Algorithm string
+	// Policies override the policies routes declare, by name
+	Policies map[string]Policy
+}
+
+// New creates a limiter using config.Algorithm. The limiter keeps its state in
+// Redis, shared by every instance of the service, unless client is nil.
+func New(config Config, client *redis.Client) (Limiter, error) {
+	limit, window := config.RequestsPerTimeFrame, config.TimeFrame
+	if limit <= 0 || window <= 0 {
+		return nil, fmt.Errorf("invalid rate limit of %d requests per %v", limit, window)
+	}
+
+	switch config.Algorithm {
+	case FixedWindow, "":
+		if client == nil {
+			return NewFixedWindowLimiter(limit, window), nil
+		}
+		return NewRedisFixedWindowLimiter(client, limit, window), nil
+	case SlidingWindow:
+		if client == nil {
+			return NewSlidingWindowLimiter(limit, window), nil
+		}
+		return NewRedisSlidingWindowLimiter(client, limit, window), nil
+	case TokenBucket:
+		if client == nil {
+			return NewTokenBucketLimiter(limit, window), nil
+		}
+		return NewRedisTokenBucketLimiter(client, limit, window), nil
+	default:
+		return nil, fmt.Errorf("unknown rate limiting algorithm %q", config.Algorithm)
+	}
+}
+
+// janitor tells in-memory limiters when to drop the state of idle clients,
+// at most once per interval, so that their maps do not grow unbounded.
+type janitor struct {
+	interval time.Duration
+	last     time.Time
+}
+
+func (j *janitor) due(now time.Time) bool {
+	if now.Sub(j.last) < j.interval {
+		return false
+	}
+	j.last = now
+	return true
 }
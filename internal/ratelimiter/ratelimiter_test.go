@@ -0,0 +1,221 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+type fakeClock struct {
+	now time.Time
+}
+
+func (c *fakeClock) Now() time.Time {
+	return c.now
+}
+
+func (c *fakeClock) Advance(d time.Duration) {
+	c.now = c.now.Add(d)
+}
+
+type newLimiter func(limit int, window time.Duration, now func() time.Time) Limiter
+
+// implementations returns every limiter by name. The Redis ones are only
+// tested against the server at REDIS_TEST_ADDR, if set.
+func implementations(t *testing.T) map[string]newLimiter {
+	impls := map[string]newLimiter{
+		"fixed-window": func(limit int, window time.Duration, now func() time.Time) Limiter {
+			rl := NewFixedWindowLimiter(limit, window)
+			rl.now = now
+			return rl
+		},
+		"sliding-window": func(limit int, window time.Duration, now func() time.Time) Limiter {
+			rl := NewSlidingWindowLimiter(limit, window)
+			rl.now = now
+			return rl
+		},
+		"token-bucket": func(limit int, window time.Duration, now func() time.Time) Limiter {
+			rl := NewTokenBucketLimiter(limit, window)
+			rl.now = now
+			return rl
+		},
+	}
+
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		return impls
+	}
+
+	client := redis.NewClient(&redis.Options{Addr: addr})
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		t.Fatalf("failed to connect to redis at %s: %v", addr, err)
+	}
+	t.Cleanup(func() { client.Close() })
+
+	impls["redis-fixed-window"] = func(limit int, window time.Duration, now func() time.Time) Limiter {
+		rl := NewRedisFixedWindowLimiter(client, limit, window)
+		rl.now = now
+		return rl
+	}
+	impls["redis-sliding-window"] = func(limit int, window time.Duration, now func() time.Time) Limiter {
+		rl := NewRedisSlidingWindowLimiter(client, limit, window)
+		rl.now = now
+		return rl
+	}
+	impls["redis-token-bucket"] = func(limit int, window time.Duration, now func() time.Time) Limiter {
+		rl := NewRedisTokenBucketLimiter(client, limit, window)
+		rl.now = now
+		return rl
+	}
+
+	return impls
+}
+
+func TestLimiterConformance(t *testing.T) {
+	const limit = 3
+	const window = time.Minute
+
+	for name, newLimiter := range implementations(t) {
+		t.Run(name, func(t *testing.T) {
+			clock := &fakeClock{now: time.Now()}
+			rl := newLimiter(limit, window, clock.Now)
+
+			// keys are unique per run, as Redis outlives the test
+			key := func(client string) string {
+				return fmt.Sprintf("%s-%s-%d", name, client, clock.now.UnixNano())
+			}
+			alice, bob := key("alice"), key("bob")
+
+			t.Run("should allow up to the limit", func(t *testing.T) {
+				for i := 0; i < limit; i++ {
+					result := rl.Allow(alice)
+					if !result.Allowed {
+						t.Fatalf("request %d denied", i+1)
+					}
+					if result.Limit != limit || result.Remaining != limit-i-1 {
+						t.Fatalf("request %d: %+v, want %d remaining", i+1, result, limit-i-1)
+					}
+					if result.Reset <= 0 || result.Reset > window {
+						t.Fatalf("request %d: reset in %v, want within (0, %v]", i+1, result.Reset, window)
+					}
+				}
+
+				result := rl.Allow(alice)
+				if result.Allowed || result.Remaining != 0 {
+					t.Fatalf("request over the limit: %+v", result)
+				}
+				if result.RetryAfter <= 0 || result.RetryAfter > result.Reset {
+					t.Fatalf("retry after %v, want within (0, %v]", result.RetryAfter, result.Reset)
+				}
+			})
+
+			t.Run("should limit clients separately", func(t *testing.T) {
+				if !rl.Allow(bob).Allowed {
+					t.Fatal("request of another client denied")
+				}
+			})
+
+			t.Run("should allow again after the retry delay", func(t *testing.T) {
+				retryAfter := rl.Allow(alice).RetryAfter
+				clock.Advance(retryAfter)
+
+				if !rl.Allow(alice).Allowed {
+					t.Fatalf("request denied after waiting %v", retryAfter)
+				}
+			})
+
+			t.Run("should restore the limit after an idle window", func(t *testing.T) {
+				clock.Advance(window)
+
+				for i := 0; i < limit; i++ {
+					if !rl.Allow(alice).Allowed {
+						t.Fatalf("request %d denied", i+1)
+					}
+				}
+			})
+		})
+	}
+}
+
+func TestSlidingWindowRateLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Date(2024, 1, 15, 14, 0, 0, 0, time.UTC)}
+	rl := NewSlidingWindowLimiter(2, time.Minute)
+	rl.now = clock.Now
+
+	// a fixed window would start over at 14:01
+	clock.Advance(59 * time.Second)
+	rl.Allow("alice")
+	rl.Allow("alice")
+	clock.Advance(2 * time.Second)
+
+	result := rl.Allow("alice")
+	if result.Allowed || result.RetryAfter != 58*time.Second || result.Reset != time.Minute-2*time.Second {
+		t.Fatalf("Allow() = %+v; want denied for 58s, reset in 58s", result)
+	}
+}
+
+func TestTokenBucketRateLimiter(t *testing.T) {
+	clock := &fakeClock{now: time.Now()}
+	rl := NewTokenBucketLimiter(4, time.Minute)
+	rl.now = clock.Now
+
+	for i := 0; i < 4; i++ {
+		rl.Allow("alice")
+	}
+
+	// a token is refilled every 15s
+	result := rl.Allow("alice")
+	if result.Allowed || result.RetryAfter != 15*time.Second || result.Reset != time.Minute {
+		t.Fatalf("Allow() = %+v; want denied for 15s, reset in 1m", result)
+	}
+
+	clock.Advance(30 * time.Second)
+	for i := 0; i < 2; i++ {
+		if !rl.Allow("alice").Allowed {
+			t.Fatalf("refilled token %d denied", i+1)
+		}
+	}
+	if rl.Allow("alice").Allowed {
+		t.Fatal("request over the refilled tokens allowed")
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, algorithm := range []string{"", FixedWindow, SlidingWindow, TokenBucket} {
+		if _, err := New(Config{RequestsPerTimeFrame: 5, TimeFrame: time.Minute, Algorithm: algorithm}, nil); err != nil {
+			t.Errorf("New(%q) failed: %v", algorithm, err)
+		}
+	}
+
+	if _, err := New(Config{RequestsPerTimeFrame: 5, TimeFrame: time.Minute, Algorithm: "leaky-bucket"}, nil); err == nil {
+		t.Error("New() accepted an unknown algorithm")
+	}
+}
+
+func TestRedisFallback(t *testing.T) {
+	// nothing listens on the port, so every script fails to run
+	client := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer client.Close()
+
+	for _, algorithm := range []string{FixedWindow, SlidingWindow, TokenBucket} {
+		t.Run(algorithm, func(t *testing.T) {
+			rl, err := New(Config{RequestsPerTimeFrame: 2, TimeFrame: time.Minute, Algorithm: algorithm}, client)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i := 0; i < 2; i++ {
+				if !rl.Allow("alice").Allowed {
+					t.Fatalf("request %d denied", i+1)
+				}
+			}
+			if rl.Allow("alice").Allowed {
+				t.Error("request over the limit allowed while Redis is unavailable")
+			}
+		})
+	}
+}
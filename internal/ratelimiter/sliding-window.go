@@ -0,0 +1,147 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// SlidingWindowRateLimiter keeps a log of the times of the requests allowed
+// within the last window of each client.
+type SlidingWindowRateLimiter struct {
+	sync.Mutex
+	clients map[string][]time.Time
+	limit   int
+	window  time.Duration
+	janitor janitor
+	now     func() time.Time
+}
+
+func NewSlidingWindowLimiter(limit int, window time.Duration) *SlidingWindowRateLimiter {
+	return &SlidingWindowRateLimiter{
+		clients: make(map[string][]time.Time),
+		limit:   limit,
+		window:  window,
+		janitor: janitor{interval: window},
+		now:     time.Now,
+	}
+}
+
+func (rl *SlidingWindowRateLimiter) Allow(ip string) Result {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	since := now.Add(-rl.window)
+
+	if rl.janitor.due(now) {
+		for client, log := range rl.clients {
+			if !log[len(log)-1].After(since) {
+				delete(rl.clients, client)
+			}
+		}
+	}
+
+	log := rl.clients[ip]
+	for len(log) > 0 && !log[0].After(since) {
+		log = log[1:]
+	}
+
+	result := Result{Limit: rl.limit}
+	if len(log) >= rl.limit {
+		result.RetryAfter = log[0].Sub(since)
+	} else {
+		log = append(log, now)
+		result.Allowed = true
+		result.Remaining = rl.limit - len(log)
+	}
+	rl.clients[ip] = log
+
+	// the limit is restored once the newest request leaves the window
+	result.Reset = log[len(log)-1].Sub(since)
+	return result
+}
+
+// slidingWindowScript drops the requests that left the window from the log,
+// and adds the request to it if the log holds less than the limit.
+//
+// KEYS[1] - sorted set of allowed requests, scored by their time
+// ARGV    - now and window in milliseconds, limit, unique member of the request
+//
+// Returns whether the request is allowed (1 or 0), the size of the log and
+// the times of its oldest and newest requests.
+var slidingWindowScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+
+redis.call('ZREMRANGEBYSCORE', KEYS[1], '-inf', now - window)
+
+local allowed = 0
+if redis.call('ZCARD', KEYS[1]) < tonumber(ARGV[3]) then
+	redis.call('ZADD', KEYS[1], now, ARGV[4])
+	redis.call('PEXPIRE', KEYS[1], window)
+	allowed = 1
+end
+
+local oldest = redis.call('ZRANGE', KEYS[1], 0, 0, 'WITHSCORES')
+local newest = redis.call('ZRANGE', KEYS[1], -1, -1, 'WITHSCORES')
+return {allowed, redis.call('ZCARD', KEYS[1]), tonumber(oldest[2]), tonumber(newest[2])}
+`)
+
+// RedisSlidingWindowRateLimiter keeps the log of SlidingWindowRateLimiter in
+// Redis.
+type RedisSlidingWindowRateLimiter struct {
+	client *redis.Client
+	limit  int
+	window time.Duration
+	// fallback counts the requests of this instance while Redis is
+	// unavailable
+	fallback *FixedWindowRateLimiter
+	now      func() time.Time
+}
+
+func NewRedisSlidingWindowLimiter(client *redis.Client, limit int, window time.Duration) *RedisSlidingWindowRateLimiter {
+	return &RedisSlidingWindowRateLimiter{
+		client:   client,
+		limit:    limit,
+		window:   window,
+		fallback: NewFixedWindowLimiter(limit, window),
+		now:      time.Now,
+	}
+}
+
+func (rl *RedisSlidingWindowRateLimiter) Allow(ip string) Result {
+	now := rl.now().UnixMilli()
+	member := fmt.Sprintf("%d-%d", now, rand.Uint64())
+
+	values, err := slidingWindowScript.Run(
+		context.Background(),
+		rl.client,
+		[]string{fmt.Sprintf("rate_limit_log:%s", ip)},
+		now,
+		rl.window.Milliseconds(),
+		rl.limit,
+		member,
+	).Int64Slice()
+	if err != nil {
+		return rl.fallback.Allow(ip)
+	}
+
+	allowed, count, oldest, newest := values[0] == 1, values[1], values[2], values[3]
+	since := now - rl.window.Milliseconds()
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     rl.limit,
+		Remaining: max(0, rl.limit-int(count)),
+		Reset:     time.Duration(newest-since) * time.Millisecond,
+	}
+	if !allowed {
+		result.RetryAfter = time.Duration(oldest-since) * time.Millisecond
+	}
+	return result
+}
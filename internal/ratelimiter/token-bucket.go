@@ -0,0 +1,172 @@
+package ratelimiter
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// TokenBucketRateLimiter gives each client a bucket of limit tokens, refilled
+// at limit tokens per window. Each request takes a token.
+//
+// To keep refills exact, the level of a bucket is counted in 1/window
+// fractions of a token: a token is window units, and the bucket gains limit
+// units per nanosecond.
+type TokenBucketRateLimiter struct {
+	sync.Mutex
+	clients map[string]*bucket
+	limit   int
+	window  time.Duration
+	janitor janitor
+	now     func() time.Time
+}
+
+type bucket struct {
+	level   int64
+	updated time.Time
+}
+
+func NewTokenBucketLimiter(limit int, window time.Duration) *TokenBucketRateLimiter {
+	return &TokenBucketRateLimiter{
+		clients: make(map[string]*bucket),
+		limit:   limit,
+		window:  window,
+		janitor: janitor{interval: window},
+		now:     time.Now,
+	}
+}
+
+func (rl *TokenBucketRateLimiter) Allow(ip string) Result {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	token, capacity := int64(rl.window), int64(rl.limit)*int64(rl.window)
+
+	// buckets untouched for a window are full again
+	if rl.janitor.due(now) {
+		for client, b := range rl.clients {
+			if now.Sub(b.updated) >= rl.window {
+				delete(rl.clients, client)
+			}
+		}
+	}
+
+	b, ok := rl.clients[ip]
+	if !ok {
+		b = &bucket{level: capacity, updated: now}
+		rl.clients[ip] = b
+	}
+
+	if elapsed := now.Sub(b.updated); elapsed > 0 {
+		b.level = min(capacity, b.level+int64(min(elapsed, rl.window))*int64(rl.limit))
+		b.updated = now
+	}
+
+	result := Result{Limit: rl.limit}
+	if b.level < token {
+		result.RetryAfter = rl.refillTime(token - b.level)
+	} else {
+		b.level -= token
+		result.Allowed = true
+	}
+
+	result.Remaining = int(b.level / token)
+	result.Reset = rl.refillTime(capacity - b.level)
+	return result
+}
+
+// refillTime returns how long the bucket takes to gain units.
+func (rl *TokenBucketRateLimiter) refillTime(units int64) time.Duration {
+	return time.Duration((units + int64(rl.limit) - 1) / int64(rl.limit))
+}
+
+// tokenBucketScript refills a bucket and takes a token from it, counting
+// the level like TokenBucketRateLimiter, in milliseconds.
+//
+// KEYS[1] - hash with the level of the bucket and when it was updated
+// ARGV    - now and window in milliseconds, limit
+//
+// Returns whether the request is allowed (1 or 0) and the level left.
+var tokenBucketScript = redis.NewScript(`
+local now = tonumber(ARGV[1])
+local window = tonumber(ARGV[2])
+local limit = tonumber(ARGV[3])
+local capacity = limit * window
+
+local state = redis.call('HMGET', KEYS[1], 'level', 'updated')
+local level = tonumber(state[1]) or capacity
+local updated = tonumber(state[2]) or now
+
+if now > updated then
+	level = math.min(capacity, level + math.min(now - updated, window) * limit)
+	updated = now
+end
+
+local allowed = 0
+if level >= window then
+	level = level - window
+	allowed = 1
+end
+
+redis.call('HSET', KEYS[1], 'level', level, 'updated', updated)
+redis.call('PEXPIRE', KEYS[1], window)
+return {allowed, level}
+`)
+
+// RedisTokenBucketRateLimiter keeps the buckets of TokenBucketRateLimiter in
+// Redis.
+type RedisTokenBucketRateLimiter struct {
+	client *redis.Client
+	limit  int
+	window time.Duration
+	// fallback counts the requests of this instance while Redis is
+	// unavailable
+	fallback *FixedWindowRateLimiter
+	now      func() time.Time
+}
+
+func NewRedisTokenBucketLimiter(client *redis.Client, limit int, window time.Duration) *RedisTokenBucketRateLimiter {
+	return &RedisTokenBucketRateLimiter{
+		client:   client,
+		limit:    limit,
+		window:   window,
+		fallback: NewFixedWindowLimiter(limit, window),
+		now:      time.Now,
+	}
+}
+
+func (rl *RedisTokenBucketRateLimiter) Allow(ip string) Result {
+	window, limit := rl.window.Milliseconds(), int64(rl.limit)
+
+	values, err := tokenBucketScript.Run(
+		context.Background(),
+		rl.client,
+		[]string{fmt.Sprintf("rate_limit_bucket:%s", ip)},
+		rl.now().UnixMilli(),
+		window,
+		limit,
+	).Int64Slice()
+	if err != nil {
+		return rl.fallback.Allow(ip)
+	}
+
+	allowed, level := values[0] == 1, values[1]
+	refillTime := func(units int64) time.Duration {
+		return time.Duration((units+limit-1)/limit) * time.Millisecond
+	}
+
+	result := Result{
+		Allowed:   allowed,
+		Limit:     rl.limit,
+		Remaining: int(level / window),
+		Reset:     refillTime(limit*window - level),
+	}
+	if !allowed {
+		result.RetryAfter = refillTime(window - level)
+	}
+	return result
+}
@@ -0,0 +1,156 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// APIKey is a long-lived credential a user creates for scripts and bots. It
+// acts on behalf of the user but only within its Scopes.
+type APIKey struct {
+	ID int64 `json:"id" example:"1"`
+
+	// Key is the SHA-256 hash of the key handed to the client
+	Key string `json:"-"`
+
+	// First characters of the key, to tell keys apart
+	Prefix string `json:"prefix" example:"gms_3kT9"`
+
+	Name      string     `json:"name" example:"deploy bot"`
+	Scopes    []string   `json:"scopes" example:"posts:write,feed:read"`
+	UserID    int64      `json:"user_id" example:"1"`
+	Expiry    *time.Time `json:"expiry,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	LastUsed  *time.Time `json:"last_used_at,omitempty"`
+}
+
+type APIKeyStore struct {
+	db *sql.DB
+}
+
+func (s *APIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	query := `
+		INSERT INTO api_keys (key, prefix, name, scopes, user_id, expiry)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	return s.db.QueryRowContext(
+		ctx,
+		query,
+		key.Key,
+		key.Prefix,
+		key.Name,
+		pq.Array(key.Scopes),
+		key.UserID,
+		key.Expiry,
+	).Scan(
+		&key.ID,
+		&key.CreatedAt,
+	)
+}
+
+// GetByUserID returns the active keys of a user, newest first.
+func (s *APIKeyStore) GetByUserID(ctx context.Context, userID int64) ([]APIKey, error) {
+	query := `
+		SELECT id, prefix, name, scopes, user_id, expiry, created_at, last_used_at
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL AND (expiry IS NULL OR expiry > NOW())
+		ORDER BY created_at DESC, id DESC
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		var k APIKey
+		if err := rows.Scan(
+			&k.ID,
+			&k.Prefix,
+			&k.Name,
+			pq.Array(&k.Scopes),
+			&k.UserID,
+			&k.Expiry,
+			&k.CreatedAt,
+			&k.LastUsed,
+		); err != nil {
+			return nil, err
+		}
+		keys = append(keys, k)
+	}
+
+	return keys, rows.Err()
+}
+
+// Authenticate looks up an active key by its hash and records that it was
+// used. Unknown, revoked or expired keys yield ErrNotFound.
+func (s *APIKeyStore) Authenticate(ctx context.Context, hashKey string) (*APIKey, error) {
+	query := `
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE key = $1 AND revoked_at IS NULL AND (expiry IS NULL OR expiry > NOW())
+		RETURNING id, prefix, name, scopes, user_id, expiry, created_at, last_used_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	key := &APIKey{Key: hashKey}
+	err := s.db.QueryRowContext(ctx, query, hashKey).Scan(
+		&key.ID,
+		&key.Prefix,
+		&key.Name,
+		pq.Array(&key.Scopes),
+		&key.UserID,
+		&key.Expiry,
+		&key.CreatedAt,
+		&key.LastUsed,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return key, nil
+}
+
+// Revoke revokes a key of a user. It returns ErrNotFound if the user has no
+// active key with that id.
+func (s *APIKeyStore) Revoke(ctx context.Context, userID, keyID int64) error {
+	query := `UPDATE api_keys SET revoked_at = NOW() WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, keyID, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
@@ -3,12 +3,21 @@ package cache
 import (
 	"Go-Microservice/internal/repo"
 	"context"
+	"time"
+
 	"github.com/stretchr/testify/mock"
 )
 
 func NewMockStore() Storage {
+	revocations := &MockRevocationStore{}
+	revocations.On("IsRevoked", mock.Anything, mock.Anything, mock.Anything).Return(false, nil)
+
 	return Storage{
-		Users: &MockUserStore{},
+		Users:            &MockUserStore{},
+		Revocations:      revocations,
+		Timelines:        &MockTimelineStore{},
+		Reactions:        &MockReactionStore{},
+		CommentReactions: &MockReactionStore{},
 	}
 }
 
@@ -28,4 +37,86 @@ func (m *MockUserStore) Set(ctx context.Context, user *repo.User) error {
 
 func (m *MockUserStore) Delete(ctx context.Context, userID int64) {
 	m.Called(userID)
-}
\ No newline at end of file
+}
+
+type MockRevocationStore struct {
+	mock.Mock
+}
+
+func (m *MockRevocationStore) Revoke(ctx context.Context, jti string, exp time.Time) error {
+	args := m.Called(jti, exp)
+	return args.Error(0)
+}
+
+func (m *MockRevocationStore) RevokeAllForUser(ctx context.Context, userID int64, exp time.Time) error {
+	args := m.Called(userID, exp)
+	return args.Error(0)
+}
+
+func (m *MockRevocationStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	args := m.Called(jti, userID, issuedAt)
+	return args.Bool(0), args.Error(1)
+}
+
+func (m *MockRevocationStore) Import(ctx context.Context, revocations []repo.Revocation) error {
+	args := m.Called(revocations)
+	return args.Error(0)
+}
+
+type MockTimelineStore struct {
+	mock.Mock
+}
+
+func (m *MockTimelineStore) Page(ctx context.Context, userID int64, fq repo.PaginatedFeedQuery) ([]int64, bool, error) {
+	args := m.Called(userID, fq)
+	ids, _ := args.Get(0).([]int64)
+	return ids, args.Bool(1), args.Error(2)
+}
+
+func (m *MockTimelineStore) Set(ctx context.Context, userID int64, entries []repo.TimelineEntry) error {
+	args := m.Called(userID, entries)
+	return args.Error(0)
+}
+
+func (m *MockTimelineStore) Push(ctx context.Context, entry repo.TimelineEntry, userIDs []int64) error {
+	args := m.Called(entry, userIDs)
+	return args.Error(0)
+}
+
+func (m *MockTimelineStore) Backfill(ctx context.Context, userID int64, entries []repo.TimelineEntry) error {
+	args := m.Called(userID, entries)
+	return args.Error(0)
+}
+
+func (m *MockTimelineStore) Remove(ctx context.Context, userID int64, postIDs []int64) error {
+	args := m.Called(userID, postIDs)
+	return args.Error(0)
+}
+
+func (m *MockTimelineStore) MaxLen() int {
+	return 800
+}
+
+type MockReactionStore struct {
+	mock.Mock
+}
+
+func (m *MockReactionStore) Get(ctx context.Context, ids []int64) (map[int64]repo.ReactionCounts, error) {
+	args := m.Called(ids)
+	counts, _ := args.Get(0).(map[int64]repo.ReactionCounts)
+	return counts, args.Error(1)
+}
+
+func (m *MockReactionStore) Set(ctx context.Context, counts map[int64]repo.ReactionCounts) error {
+	args := m.Called(counts)
+	return args.Error(0)
+}
+
+func (m *MockReactionStore) Incr(ctx context.Context, id int64, kind string, delta int) error {
+	args := m.Called(id, kind, delta)
+	return args.Error(0)
+}
+
+func (m *MockReactionStore) Delete(ctx context.Context, id int64) {
+	m.Called(id)
+}
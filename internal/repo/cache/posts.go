@@ -0,0 +1,223 @@
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// FeedPageKey identifies a page of the feed of a user.
+type FeedPageKey struct {
+	UserID int64
+	Query  repo.PaginatedFeedQuery
+}
+
+// String hashes the query, which may hold a long search term.
+func (k FeedPageKey) String() string {
+	data, _ := json.Marshal(struct {
+		repo.PaginatedFeedQuery
+		Cursor *repo.FeedCursor
+	}{k.Query, k.Query.Cursor})
+
+	sum := sha256.Sum256(data)
+	return fmt.Sprintf("%d:%s", k.UserID, hex.EncodeToString(sum[:8]))
+}
+
+// cachedPost keeps the version of a post, which is not part of its JSON.
+type cachedPost struct {
+	*repo.Post
+	Version int32 `json:"version"`
+}
+
+// PostStore caches the posts and feed pages of a PostsRepository, and drops
+// them as posts are written through it. Feed pages of followers also hold the
+// comment counts of posts, which may lag for up to the TTL of the pages.
+type PostStore struct {
+	repo.PostsRepository
+	followers repo.FollowersRepository
+	posts     *Store[int64, *repo.Post]
+	feeds     *Store[FeedPageKey, *repo.FeedPage]
+	onError   func(err error)
+}
+
+// NewPostStore creates a new PostStore in front of posts.
+//
+// Parameters:
+//   - rdb: Redis client instance
+//   - posts: Repository the posts are read from and written to
+//   - followers: Repository of the followers whose feeds show the posts
+//   - ttl: Time-to-live for cached posts and missing posts
+//   - feedTTL: Time-to-live for cached feed pages
+//   - onError: Told about Redis failures, may be nil
+//
+// Returns:
+//   - *PostStore: Configured post store instance
+func NewPostStore(rdb *redis.Client, posts repo.PostsRepository, followers repo.FollowersRepository, ttl, feedTTL time.Duration, onError func(err error)) *PostStore {
+	if onError == nil {
+		onError = func(error) {}
+	}
+
+	return &PostStore{
+		PostsRepository: posts,
+		followers:       followers,
+		posts: NewStore(rdb, StoreConfig[int64, *repo.Post]{
+			Name:        "post",
+			TTL:         ttl,
+			NotFoundTTL: ttl,
+			Encode: func(post *repo.Post) ([]byte, error) {
+				return json.Marshal(cachedPost{Post: post, Version: post.Version})
+			},
+			Decode: func(data []byte) (*repo.Post, error) {
+				cached := cachedPost{Post: &repo.Post{}}
+				if err := json.Unmarshal(data, &cached); err != nil {
+					return nil, err
+				}
+				cached.Post.Version = cached.Version
+				return cached.Post, nil
+			},
+			OnError: onError,
+		}, func(ctx context.Context, id int64) (*repo.Post, error) {
+			return posts.GetByID(ctx, id)
+		}),
+		feeds: NewStore(rdb, StoreConfig[FeedPageKey, *repo.FeedPage]{
+			Name:    "feed",
+			TTL:     feedTTL,
+			Scope:   func(key FeedPageKey) string { return fmt.Sprint(key.UserID) },
+			OnError: onError,
+		}, func(ctx context.Context, key FeedPageKey) (*repo.FeedPage, error) {
+			return posts.GetUserFeed(ctx, key.UserID, key.Query)
+		}),
+		onError: onError,
+	}
+}
+
+func (s *PostStore) GetByID(ctx context.Context, id int64) (*repo.Post, error) {
+	if id <= 0 {
+		return nil, fmt.Errorf("%w: invalid post ID", repo.ErrInvalidPostData)
+	}
+	return s.posts.Get(ctx, id)
+}
+
+func (s *PostStore) GetUserFeed(ctx context.Context, userID int64, fq repo.PaginatedFeedQuery) (*repo.FeedPage, error) {
+	return s.feeds.Get(ctx, FeedPageKey{UserID: userID, Query: fq})
+}
+
+func (s *PostStore) Create(ctx context.Context, post *repo.Post) error {
+	if err := s.PostsRepository.Create(ctx, post); err != nil {
+		return err
+	}
+
+	// the id may have been requested, and cached as missing, before
+	s.invalidate(ctx, post.ID, post.UserID)
+	return nil
+}
+
+// Update also drops the cached post on ErrEditConflict, which may come from
+// the cached post being stale.
+func (s *PostStore) Update(ctx context.Context, post *repo.Post) error {
+	err := s.PostsRepository.Update(ctx, post)
+	if err == nil || errors.Is(err, repo.ErrEditConflict) {
+		s.invalidate(ctx, post.ID, post.UserID)
+	}
+	return err
+}
+
+// Delete also drops the cached post on ErrEditConflict, which may come from
+// the cached post being stale.
+func (s *PostStore) Delete(ctx context.Context, post *repo.Post) error {
+	err := s.PostsRepository.Delete(ctx, post)
+	if err == nil || errors.Is(err, repo.ErrEditConflict) {
+		s.invalidate(ctx, post.ID, post.UserID)
+	}
+	return err
+}
+
+func (s *PostStore) Restore(ctx context.Context, id int64) error {
+	if err := s.PostsRepository.Restore(ctx, id); err != nil {
+		return err
+	}
+
+	post, err := s.PostsRepository.GetByID(ctx, id)
+	if err != nil {
+		s.onError(fmt.Errorf("failed to get restored post %d: %w", id, err))
+		s.invalidate(ctx, id, 0)
+		return nil
+	}
+
+	s.invalidate(ctx, id, post.UserID)
+	return nil
+}
+
+// Flush drops every cached post and feed page, after writes that change which
+// posts are shown without going through the store, such as the deletion of
+// their author, or after invalidations were missed while Redis was
+// unavailable.
+func (s *PostStore) Flush(ctx context.Context) error {
+	return errors.Join(s.posts.Flush(ctx), s.feeds.Flush(ctx))
+}
+
+// invalidate drops a post and the feed pages showing it, those of its author
+// and of the followers of its author. Failures are reported only, the write
+// succeeded either way.
+func (s *PostStore) invalidate(ctx context.Context, postID, authorID int64) {
+	s.posts.Invalidate(ctx, postID)
+
+	if authorID == 0 {
+		return
+	}
+
+	followerIDs, err := s.followers.GetFollowerIDs(ctx, authorID)
+	if err != nil {
+		s.onError(fmt.Errorf("failed to invalidate feeds of the followers of user %d: %w", authorID, err))
+	}
+
+	scopes := []string{fmt.Sprint(authorID)}
+	for _, id := range followerIDs {
+		scopes = append(scopes, fmt.Sprint(id))
+	}
+	s.feeds.InvalidateScopes(ctx, scopes...)
+}
+
+// FollowerStore drops the cached feed pages of a user as they follow or
+// unfollow someone, whose posts enter or leave their feed.
+type FollowerStore struct {
+	repo.FollowersRepository
+	posts *PostStore
+}
+
+// NewFollowerStore creates a new FollowerStore in front of followers.
+//
+// Parameters:
+//   - followers: Repository the followers are read from and written to
+//   - posts: Post store caching the feed pages of the followers
+//
+// Returns:
+//   - *FollowerStore: Configured follower store instance
+func NewFollowerStore(followers repo.FollowersRepository, posts *PostStore) *FollowerStore {
+	return &FollowerStore{FollowersRepository: followers, posts: posts}
+}
+
+func (s *FollowerStore) Follow(ctx context.Context, followerID, userID int64) error {
+	if err := s.FollowersRepository.Follow(ctx, followerID, userID); err != nil {
+		return err
+	}
+
+	s.posts.feeds.InvalidateScopes(ctx, fmt.Sprint(followerID))
+	return nil
+}
+
+func (s *FollowerStore) Unfollow(ctx context.Context, followerID, userID int64) error {
+	if err := s.FollowersRepository.Unfollow(ctx, followerID, userID); err != nil {
+		return err
+	}
+
+	s.posts.feeds.InvalidateScopes(ctx, fmt.Sprint(followerID))
+	return nil
+}
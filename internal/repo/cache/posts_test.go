@@ -0,0 +1,102 @@
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// followers keeps who follows whom in memory.
+type followers map[int64][]int64
+
+func (f followers) Follow(ctx context.Context, followerID, userID int64) error {
+	f[userID] = append(f[userID], followerID)
+	return nil
+}
+
+func (f followers) Unfollow(ctx context.Context, followerID, userID int64) error {
+	ids := f[userID][:0]
+	for _, id := range f[userID] {
+		if id != followerID {
+			ids = append(ids, id)
+		}
+	}
+	f[userID] = ids
+	return nil
+}
+
+func (f followers) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	return f[userID], nil
+}
+
+func TestPostStore(t *testing.T) {
+	ctx := context.Background()
+
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+
+	posts := &repo.MockPostStore{}
+	follows := followers{}
+	store := NewPostStore(rdb, posts, follows, time.Minute, time.Minute, func(err error) {
+		t.Errorf("unexpected cache failure: %v", err)
+	})
+	followStore := NewFollowerStore(follows, store)
+
+	// the names of the stores are shared with earlier runs
+	if err := store.Flush(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	query := repo.PaginatedFeedQuery{Limit: 10, Sort: "desc"}
+
+	// reads returns how often reading the feed of user 1 hit the repository
+	reads := func(t *testing.T) int {
+		t.Helper()
+		before := posts.FeedReads
+		if _, err := store.GetUserFeed(ctx, 1, query); err != nil {
+			t.Fatal(err)
+		}
+		return posts.FeedReads - before
+	}
+
+	t.Run("should cache feed pages", func(t *testing.T) {
+		reads(t)
+		if n := reads(t); n != 0 {
+			t.Errorf("read the feed %d times, want it cached", n)
+		}
+	})
+
+	t.Run("should drop the feed of a user who follows or unfollows someone", func(t *testing.T) {
+		if err := followStore.Follow(ctx, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if n := reads(t); n != 1 {
+			t.Errorf("read the feed %d times after following, want 1", n)
+		}
+
+		if err := followStore.Unfollow(ctx, 1, 2); err != nil {
+			t.Fatal(err)
+		}
+		if n := reads(t); n != 1 {
+			t.Errorf("read the feed %d times after unfollowing, want 1", n)
+		}
+	})
+
+	t.Run("should drop every feed on flush", func(t *testing.T) {
+		reads(t)
+		if err := store.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		if n := reads(t); n != 1 {
+			t.Errorf("read the feed %d times after a flush, want 1", n)
+		}
+	})
+}
@@ -0,0 +1,190 @@
+// Package cache provides Redis-based storage for reaction counters.
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// reactionsMarker is stored in every cached hash, so that posts without
+// reactions are cached too.
+const reactionsMarker = "_"
+
+// reactionsChangedTTL is how long counts aggregated before a change are kept
+// out of the cache. It exceeds the time an aggregation may take.
+var reactionsChangedTTL = repo.QueryTimeout + 5*time.Second
+
+// reactionIncrScript adjusts a cached counter, but only if the counts of the
+// post or comment are cached; otherwise they are aggregated on the next read
+// anyway, and the change is marked so that counts aggregated before it are not
+// cached.
+//
+// KEYS[1] - counts
+// KEYS[2] - change marker
+// ARGV    - kind, delta, ttl of the marker in milliseconds
+var reactionIncrScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	redis.call('SET', KEYS[2], 1, 'PX', ARGV[3])
+	return 0
+end
+if redis.call('HINCRBY', KEYS[1], ARGV[1], ARGV[2]) <= 0 then
+	redis.call('HDEL', KEYS[1], ARGV[1])
+end
+return 1
+`)
+
+// reactionSetScript caches aggregated counts, unless they are cached already,
+// and may have been adjusted since, or changed while they were aggregated.
+//
+// KEYS[1] - counts
+// KEYS[2] - change marker
+// ARGV    - ttl in milliseconds, kinds and counts
+var reactionSetScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 1 or redis.call('EXISTS', KEYS[2]) == 1 then
+	return 0
+end
+redis.call('HSET', KEYS[1], unpack(ARGV, 2))
+redis.call('PEXPIRE', KEYS[1], ARGV[1])
+return 1
+`)
+
+// ReactionStore caches the reaction counts of posts, or of comments, as one
+// hash per post or comment. The counters are adjusted as reactions change and
+// expire after ttl, which bounds the drift of counters that missed an update.
+type ReactionStore struct {
+	rdb    *redis.Client
+	target string
+	ttl    time.Duration
+}
+
+// NewReactionStore creates a new ReactionStore with the specified Redis client and TTL.
+//
+// Parameters:
+//   - rdb: Redis client instance
+//   - target: What the counted reactions are on, "post" or "comment"
+//   - ttl: Time-to-live for cached counts
+//
+// Returns:
+//   - *ReactionStore: Configured reaction store instance
+func NewReactionStore(rdb *redis.Client, target string, ttl time.Duration) *ReactionStore {
+	return &ReactionStore{rdb: rdb, target: target, ttl: ttl}
+}
+
+// Get returns the cached counts of the given posts or comments. Those whose
+// counts are not cached are left out of the result.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - ids: Posts or comments to get the counts of
+//
+// Returns:
+//   - map[int64]repo.ReactionCounts: Cached counts by ID
+//   - error: Error if operation fails
+func (s *ReactionStore) Get(ctx context.Context, ids []int64) (map[int64]repo.ReactionCounts, error) {
+	pipe := s.rdb.Pipeline()
+	cmds := make([]*redis.MapStringStringCmd, len(ids))
+	for i, id := range ids {
+		cmds[i] = pipe.HGetAll(ctx, s.key(id))
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return nil, fmt.Errorf("failed to get reaction counts from cache: %w", err)
+	}
+
+	counts := make(map[int64]repo.ReactionCounts, len(ids))
+	for i, cmd := range cmds {
+		fields := cmd.Val()
+		if len(fields) == 0 {
+			continue
+		}
+
+		c := repo.ReactionCounts{}
+		for kind, v := range fields {
+			if kind == reactionsMarker {
+				continue
+			}
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse reaction count %q: %w", v, err)
+			}
+			c[kind] = n
+		}
+		counts[ids[i]] = c
+	}
+
+	return counts, nil
+}
+
+// Set caches the counts of posts or comments with the configured TTL. Counts
+// cached meanwhile, or changed since less than the time an aggregation takes,
+// are left alone: the counts passed may predate them.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - counts: Counts by ID
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *ReactionStore) Set(ctx context.Context, counts map[int64]repo.ReactionCounts) error {
+	pipe := s.rdb.Pipeline()
+	for id, c := range counts {
+		args := make([]any, 0, 2*len(c)+3)
+		args = append(args, s.ttl.Milliseconds(), reactionsMarker, 0)
+		for kind, n := range c {
+			args = append(args, kind, n)
+		}
+
+		reactionSetScript.Eval(ctx, pipe, []string{s.key(id), s.changedKey(id)}, args...)
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set reaction counts in cache: %w", err)
+	}
+
+	return nil
+}
+
+// Incr adds delta to the cached count of a reaction kind on a post or
+// comment.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - id: Post or comment the reaction was left on
+//   - kind: Reaction kind
+//   - delta: 1 for an added reaction, -1 for a removed one
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *ReactionStore) Incr(ctx context.Context, id int64, kind string, delta int) error {
+	keys := []string{s.key(id), s.changedKey(id)}
+	if err := reactionIncrScript.Run(ctx, s.rdb, keys, kind, delta, reactionsChangedTTL.Milliseconds()).Err(); err != nil {
+		return fmt.Errorf("failed to update reaction count in cache: %w", err)
+	}
+
+	return nil
+}
+
+// Delete removes the cached counts of a post or comment, and marks them
+// changed, so that counts aggregated before are not cached.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - id: Post or comment to remove the counts of
+func (s *ReactionStore) Delete(ctx context.Context, id int64) {
+	pipe := s.rdb.TxPipeline()
+	pipe.Set(ctx, s.changedKey(id), 1, reactionsChangedTTL)
+	pipe.Del(ctx, s.key(id))
+	pipe.Exec(ctx)
+}
+
+func (s *ReactionStore) key(id int64) string {
+	return fmt.Sprintf("reactions-%s-%d", s.target, id)
+}
+
+func (s *ReactionStore) changedKey(id int64) string {
+	return fmt.Sprintf("reactions-%s-%d-changed", s.target, id)
+}
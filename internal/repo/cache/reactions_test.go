@@ -0,0 +1,81 @@
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+func TestReactionStore(t *testing.T) {
+	ctx := context.Background()
+
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+
+	newStore := func() *ReactionStore {
+		return NewReactionStore(rdb, fmt.Sprintf("test-%d", time.Now().UnixNano()), time.Minute)
+	}
+
+	t.Run("should count reactions on cached counts", func(t *testing.T) {
+		s := newStore()
+
+		if err := s.Set(ctx, map[int64]repo.ReactionCounts{1: {"like": 1}}); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Incr(ctx, 1, "love", 1); err != nil {
+			t.Fatal(err)
+		}
+
+		counts, err := s.Get(ctx, []int64{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if c := counts[1]; c["like"] != 1 || c["love"] != 1 {
+			t.Errorf("got %v", c)
+		}
+	})
+
+	t.Run("should not overwrite counts cached meanwhile", func(t *testing.T) {
+		s := newStore()
+
+		s.Set(ctx, map[int64]repo.ReactionCounts{1: {"like": 1}})
+		s.Incr(ctx, 1, "like", 1)
+		// aggregated before the reaction above
+		s.Set(ctx, map[int64]repo.ReactionCounts{1: {"like": 1}})
+
+		counts, err := s.Get(ctx, []int64{1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n := counts[1]["like"]; n != 2 {
+			t.Errorf("got %d likes, want 2", n)
+		}
+	})
+
+	t.Run("should not cache counts aggregated before a change", func(t *testing.T) {
+		s := newStore()
+
+		// the reaction is added while the counts are aggregated
+		s.Incr(ctx, 1, "like", 1)
+		s.Set(ctx, map[int64]repo.ReactionCounts{1: {}})
+		s.Delete(ctx, 2)
+		s.Set(ctx, map[int64]repo.ReactionCounts{2: {}})
+
+		counts, err := s.Get(ctx, []int64{1, 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(counts) != 0 {
+			t.Errorf("cached %v", counts)
+		}
+	})
+}
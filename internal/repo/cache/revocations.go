@@ -0,0 +1,162 @@
+// Package cache provides Redis-based storage for revoked access tokens.
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// revokeUserScript records a "log out all sessions" of a user, unless a later
+// one is recorded already.
+//
+// KEYS[1] - revocation of the user
+// ARGV    - unix time tokens are revoked up to, ttl in milliseconds
+var revokeUserScript = redis.NewScript(`
+if tonumber(ARGV[1]) > tonumber(redis.call('GET', KEYS[1]) or '0') then
+	redis.call('SET', KEYS[1], ARGV[1], 'PX', ARGV[2])
+end
+return 1
+`)
+
+// RevocationStore keeps the access token revocation list in Redis. Every entry
+// expires together with the tokens it revokes, so the list never outgrows the
+// set of tokens that are still valid.
+type RevocationStore struct {
+	rdb *redis.Client
+}
+
+// NewRevocationStore creates a new RevocationStore with the specified Redis client.
+//
+// Parameters:
+//   - rdb: Redis client instance
+//
+// Returns:
+//   - *RevocationStore: Configured revocation store instance
+func NewRevocationStore(rdb *redis.Client) *RevocationStore {
+	return &RevocationStore{rdb: rdb}
+}
+
+// Revoke adds a single access token to the revocation list.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - jti: Unique identifier (jti claim) of the token
+//   - exp: Expiration time of the token
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, exp time.Time) error {
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := s.rdb.Set(ctx, s.tokenKey(jti), 1, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeAllForUser revokes every access token issued to the user before the
+// current second.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - userID: User whose tokens are revoked
+//   - exp: Time after which none of the revoked tokens is valid anymore
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *RevocationStore) RevokeAllForUser(ctx context.Context, userID int64, exp time.Time) error {
+	ttl := time.Until(exp)
+	if ttl <= 0 {
+		return nil
+	}
+
+	revokedBefore := time.Now().Unix()
+	if err := s.rdb.Set(ctx, s.userKey(userID), revokedBefore, ttl).Err(); err != nil {
+		return fmt.Errorf("failed to revoke user tokens: %w", err)
+	}
+
+	return nil
+}
+
+// IsRevoked reports whether a token has been revoked individually or by a
+// "log out all sessions" of its user. Both entries are read in a single round trip.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - jti: Unique identifier (jti claim) of the token
+//   - userID: Subject of the token
+//   - issuedAt: Issue time (iat claim) of the token
+//
+// Returns:
+//   - bool: True if the token must be rejected
+//   - error: Error if operation fails
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	values, err := s.rdb.MGet(ctx, s.tokenKey(jti), s.userKey(userID)).Result()
+	if err != nil {
+		return false, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	if jti != "" && values[0] != nil {
+		return true, nil
+	}
+
+	if values[1] != nil {
+		revokedBefore, err := strconv.ParseInt(values[1].(string), 10, 64)
+		if err != nil {
+			return false, fmt.Errorf("failed to parse user revocation: %w", err)
+		}
+		// iat has a precision of seconds, tokens issued in the same second as
+		// the revocation are kept, as they may be the login that followed it
+		return issuedAt.Unix() < revokedBefore, nil
+	}
+
+	return false, nil
+}
+
+// Import copies entries of the Postgres revocation list, e.g. those only
+// written there while Redis was unavailable.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - revocations: Entries to copy
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *RevocationStore) Import(ctx context.Context, revocations []repo.Revocation) error {
+	pipe := s.rdb.Pipeline()
+	for _, r := range revocations {
+		ttl := time.Until(r.Expiry)
+		if ttl <= 0 {
+			continue
+		}
+
+		if r.JTI != "" {
+			pipe.Set(ctx, s.tokenKey(r.JTI), 1, ttl)
+			continue
+		}
+		revokeUserScript.Eval(ctx, pipe, []string{s.userKey(r.UserID)}, r.RevokedBefore.Unix(), ttl.Milliseconds())
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to import revocations: %w", err)
+	}
+
+	return nil
+}
+
+func (s *RevocationStore) tokenKey(jti string) string {
+	return fmt.Sprintf("revoked-token-%s", jti)
+}
+
+func (s *RevocationStore) userKey(userID int64) string {
+	return fmt.Sprintf("revoked-user-%d", userID)
+}
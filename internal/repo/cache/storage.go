@@ -16,9 +16,38 @@ type UserCache interface {
 	Delete(ctx context.Context, userID int64)
 }
 
+type RevocationCache interface {
+	Revoke(ctx context.Context, jti string, exp time.Time) error
+	RevokeAllForUser(ctx context.Context, userID int64, exp time.Time) error
+	IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+	Import(ctx context.Context, revocations []repo.Revocation) error
+}
+
+type TimelineCache interface {
+	Page(ctx context.Context, userID int64, fq repo.PaginatedFeedQuery) ([]int64, bool, error)
+	Set(ctx context.Context, userID int64, entries []repo.TimelineEntry) error
+	Push(ctx context.Context, entry repo.TimelineEntry, userIDs []int64) error
+	Backfill(ctx context.Context, userID int64, entries []repo.TimelineEntry) error
+	Remove(ctx context.Context, userID int64, postIDs []int64) error
+	MaxLen() int
+}
+
+type ReactionCache interface {
+	Get(ctx context.Context, ids []int64) (map[int64]repo.ReactionCounts, error)
+	Set(ctx context.Context, counts map[int64]repo.ReactionCounts) error
+	Incr(ctx context.Context, id int64, kind string, delta int) error
+	Delete(ctx context.Context, id int64)
+}
+
 type Storage struct {
-	Users UserCache
-	rdb   *redis.Client
+	Users       UserCache
+	Revocations RevocationCache
+	Timelines   TimelineCache
+	// Reactions and CommentReactions count the reactions on posts and on
+	// comments
+	Reactions        ReactionCache
+	CommentReactions ReactionCache
+	rdb              *redis.Client
 }
 
 // NewRedisStorage creates and returns a new Redis-based cache storage instance.
@@ -26,6 +55,8 @@ type Storage struct {
 //
 // Parameters:
 //   - rdb: Redis client instance for cache operations
+//   - timelineMaxLen: Maximum number of posts kept per feed timeline
+//   - timelineTTL: Time after which a feed timeline that is not read expires
 //
 // Returns:
 //   - Storage: Configured cache storage with initialized entity stores
@@ -37,11 +68,16 @@ type Storage struct {
 //	    log.Fatal("Failed to create Redis client:", err)
 //	}
 //
-//	cacheStorage := NewRedisStorage(redisClient)
+//	cacheStorage := NewRedisStorage(redisClient, 800, 7*24*time.Hour)
 //	user, err := cacheStorage.Users.Get(ctx, userID)
-func NewRedisStorage(rdb *redis.Client) Storage {
+func NewRedisStorage(rdb *redis.Client, timelineMaxLen int, timelineTTL time.Duration) Storage {
 	return Storage{
-		Users: NewUserStore(rdb, time.Hour),
+		Users:            NewUserStore(rdb, time.Hour),
+		Revocations:      NewRevocationStore(rdb),
+		Timelines:        NewTimelineStore(rdb, timelineMaxLen, timelineTTL),
+		Reactions:        NewReactionStore(rdb, "post", time.Hour),
+		CommentReactions: NewReactionStore(rdb, "comment", time.Hour),
+		rdb:              rdb,
 	}
 }
 
@@ -0,0 +1,266 @@
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// notFound is cached for keys the loader reported missing.
+const notFound = "!"
+
+// storeGetScript reads the version of the scope of a key, prefixed by the
+// generation of the store, and the entry cached for the key at that version.
+//
+// KEYS[1] - version of the scope
+// KEYS[2] - generation of the store
+// ARGV    - prefix of the entries of the scope, key
+var storeGetScript = redis.NewScript(`
+local version = (redis.call('GET', KEYS[2]) or '0') .. '.' .. (redis.call('GET', KEYS[1]) or '0')
+return {version, redis.call('GET', ARGV[1] .. version .. ':' .. ARGV[2])}
+`)
+
+// storeSetScript caches an entry, unless the scope was invalidated or the
+// store flushed since the entry was loaded. The version outlives the entries
+// written at it, so that it never restarts from 0 while they are cached; the
+// generation never expires.
+//
+// KEYS[1] - version of the scope
+// KEYS[2] - entry
+// KEYS[3] - generation of the store
+// ARGV    - version the entry was loaded at, value, ttls of the entry and of
+// the version in milliseconds
+var storeSetScript = redis.NewScript(`
+local scope = redis.call('GET', KEYS[1])
+local version = (redis.call('GET', KEYS[3]) or '0') .. '.' .. (scope or '0')
+if version ~= ARGV[1] then
+	return 0
+end
+if scope then
+	redis.call('PEXPIRE', KEYS[1], ARGV[4])
+end
+redis.call('SET', KEYS[2], ARGV[2], 'PX', ARGV[3])
+return 1
+`)
+
+// storeInvalidateScript bumps the version of scopes.
+//
+// KEYS - versions of the scopes
+// ARGV - ttl of the versions in milliseconds
+var storeInvalidateScript = redis.NewScript(`
+for _, key in ipairs(KEYS) do
+	redis.call('INCR', key)
+	redis.call('PEXPIRE', key, ARGV[1])
+end
+return #KEYS
+`)
+
+// Loader reads the value of a key from the source of truth.
+type Loader[K, V any] func(ctx context.Context, key K) (V, error)
+
+type StoreConfig[K, V any] struct {
+	// Name prefixes the keys of the store
+	Name string
+	// TTL is how long loaded values are cached
+	TTL time.Duration
+	// NotFoundTTL is how long keys the loader reports as repo.ErrNotFound are
+	// cached as missing; 0 disables negative caching
+	NotFoundTTL time.Duration
+	// Scope groups keys invalidated together, the key itself if nil
+	Scope func(key K) string
+	// Encode and Decode serialize values, as JSON if nil
+	Encode func(value V) ([]byte, error)
+	Decode func(data []byte) (V, error)
+	// OnError, if not nil, is told about the failures of Redis, which are
+	// otherwise ignored in favor of the loader
+	OnError func(err error)
+}
+
+// Store is a read-through cache of the values of a Loader.
+//
+// Entries are keyed by the version of their scope, which Invalidate bumps:
+// the entries of the previous version are never read again and expire, and
+// values loaded before the invalidation are not cached anymore. Flush does
+// the same for every scope at once.
+type Store[K, V any] struct {
+	rdb    *redis.Client
+	config StoreConfig[K, V]
+	load   Loader[K, V]
+}
+
+// NewStore creates a Store caching the values of load in Redis.
+//
+// Parameters:
+//   - rdb: Redis client instance
+//   - config: Naming, expiry and serialization of the entries
+//   - load: Reads the values missing from the cache
+//
+// Returns:
+//   - *Store[K, V]: Configured store instance
+func NewStore[K, V any](rdb *redis.Client, config StoreConfig[K, V], load Loader[K, V]) *Store[K, V] {
+	if config.Scope == nil {
+		config.Scope = func(key K) string { return fmt.Sprint(key) }
+	}
+	if config.Encode == nil {
+		config.Encode = func(value V) ([]byte, error) { return json.Marshal(value) }
+	}
+	if config.Decode == nil {
+		config.Decode = func(data []byte) (V, error) {
+			var value V
+			err := json.Unmarshal(data, &value)
+			return value, err
+		}
+	}
+
+	return &Store[K, V]{rdb: rdb, config: config, load: load}
+}
+
+// Get returns the cached value of key, and loads and caches it on a miss.
+// Keys cached as missing yield repo.ErrNotFound. When Redis fails, the value
+// is loaded without being cached.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - key: Key of the value
+//
+// Returns:
+//   - V: Cached or loaded value
+//   - error: Error of the loader
+func (s *Store[K, V]) Get(ctx context.Context, key K) (V, error) {
+	scope, id := s.config.Scope(key), fmt.Sprint(key)
+
+	entry, err := storeGetScript.Run(ctx, s.rdb, []string{s.versionKey(scope), s.generationKey()}, s.entryPrefix(scope), id).Slice()
+	if err != nil {
+		s.fail(fmt.Errorf("failed to get %s %s from cache: %w", s.config.Name, id, err))
+		return s.load(ctx, key)
+	}
+
+	version, _ := entry[0].(string)
+	if data, ok := entry[1].(string); ok {
+		if data == notFound {
+			var zero V
+			return zero, fmt.Errorf("%w: %s %s", repo.ErrNotFound, s.config.Name, id)
+		}
+
+		value, err := s.config.Decode([]byte(data))
+		if err == nil {
+			return value, nil
+		}
+		s.fail(fmt.Errorf("failed to decode cached %s %s: %w", s.config.Name, id, err))
+	}
+
+	value, err := s.load(ctx, key)
+	switch {
+	case err == nil:
+		data, err := s.config.Encode(value)
+		if err != nil {
+			s.fail(fmt.Errorf("failed to encode %s %s: %w", s.config.Name, id, err))
+			break
+		}
+		s.set(ctx, scope, version, id, string(data), s.config.TTL)
+	case errors.Is(err, repo.ErrNotFound) && s.config.NotFoundTTL > 0:
+		s.set(ctx, scope, version, id, notFound, s.config.NotFoundTTL)
+	}
+
+	return value, err
+}
+
+// Invalidate drops the cached values of the scopes of keys, after their
+// source changed.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - keys: Keys whose scopes to invalidate
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *Store[K, V]) Invalidate(ctx context.Context, keys ...K) error {
+	scopes := make([]string, len(keys))
+	for i, key := range keys {
+		scopes[i] = s.config.Scope(key)
+	}
+
+	return s.InvalidateScopes(ctx, scopes...)
+}
+
+// InvalidateScopes drops the cached values of scopes.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - scopes: Scopes to invalidate
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *Store[K, V]) InvalidateScopes(ctx context.Context, scopes ...string) error {
+	if len(scopes) == 0 {
+		return nil
+	}
+
+	keys := make([]string, len(scopes))
+	for i, scope := range scopes {
+		keys[i] = s.versionKey(scope)
+	}
+
+	if err := storeInvalidateScript.Run(ctx, s.rdb, keys, s.versionTTL().Milliseconds()).Err(); err != nil {
+		err = fmt.Errorf("failed to invalidate cached %s: %w", s.config.Name, err)
+		s.fail(err)
+		return err
+	}
+
+	return nil
+}
+
+// Flush drops every cached value, e.g. after invalidations may have been
+// missed while Redis was unavailable.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *Store[K, V]) Flush(ctx context.Context) error {
+	if err := s.rdb.Incr(ctx, s.generationKey()).Err(); err != nil {
+		err = fmt.Errorf("failed to flush cached %s: %w", s.config.Name, err)
+		s.fail(err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *Store[K, V]) set(ctx context.Context, scope, version, id, data string, ttl time.Duration) {
+	keys := []string{s.versionKey(scope), s.entryPrefix(scope) + version + ":" + id, s.generationKey()}
+	args := []any{version, data, ttl.Milliseconds(), s.versionTTL().Milliseconds()}
+
+	if err := storeSetScript.Run(ctx, s.rdb, keys, args...).Err(); err != nil {
+		s.fail(fmt.Errorf("failed to set %s %s in cache: %w", s.config.Name, id, err))
+	}
+}
+
+// versionTTL keeps versions for twice the lifetime of any entry.
+func (s *Store[K, V]) versionTTL() time.Duration {
+	return 2 * max(s.config.TTL, s.config.NotFoundTTL)
+}
+
+func (s *Store[K, V]) versionKey(scope string) string {
+	return fmt.Sprintf("cache:%s:%s:version", s.config.Name, scope)
+}
+
+func (s *Store[K, V]) generationKey() string {
+	return fmt.Sprintf("cache:%s:generation", s.config.Name)
+}
+
+func (s *Store[K, V]) entryPrefix(scope string) string {
+	return fmt.Sprintf("cache:%s:%s:", s.config.Name, scope)
+}
+
+func (s *Store[K, V]) fail(err error) {
+	if s.config.OnError != nil {
+		s.config.OnError(err)
+	}
+}
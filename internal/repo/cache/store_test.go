@@ -0,0 +1,215 @@
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// testStore caches the names of even keys, odd keys are missing.
+func testStore(rdb *redis.Client, loads *int, onError func(error)) *Store[int64, string] {
+	return NewStore(rdb, StoreConfig[int64, string]{
+		Name:        fmt.Sprintf("test-%d", time.Now().UnixNano()),
+		TTL:         time.Minute,
+		NotFoundTTL: time.Minute,
+		OnError:     onError,
+	}, func(ctx context.Context, key int64) (string, error) {
+		*loads++
+		if key%2 == 1 {
+			return "", fmt.Errorf("%w: key %d", repo.ErrNotFound, key)
+		}
+		return fmt.Sprintf("name-%d", key), nil
+	})
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+
+	addr := os.Getenv("REDIS_TEST_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_TEST_ADDR not set")
+	}
+	rdb := redis.NewClient(&redis.Options{Addr: addr})
+	defer rdb.Close()
+
+	failOnError := func(err error) { t.Errorf("unexpected cache failure: %v", err) }
+
+	t.Run("should load each key once", func(t *testing.T) {
+		var loads int
+		s := testStore(rdb, &loads, failOnError)
+
+		for range 3 {
+			if name, err := s.Get(ctx, 2); err != nil || name != "name-2" {
+				t.Fatalf("Get() = %q, %v", name, err)
+			}
+		}
+		if loads != 1 {
+			t.Errorf("loaded %d times, want 1", loads)
+		}
+	})
+
+	t.Run("should cache missing keys", func(t *testing.T) {
+		var loads int
+		s := testStore(rdb, &loads, failOnError)
+
+		for range 3 {
+			if _, err := s.Get(ctx, 3); !errors.Is(err, repo.ErrNotFound) {
+				t.Fatalf("got %v, want ErrNotFound", err)
+			}
+		}
+		if loads != 1 {
+			t.Errorf("loaded %d times, want 1", loads)
+		}
+	})
+
+	t.Run("should reload invalidated keys", func(t *testing.T) {
+		var loads int
+		s := testStore(rdb, &loads, failOnError)
+
+		s.Get(ctx, 2)
+		s.Get(ctx, 4)
+		if err := s.Invalidate(ctx, 2); err != nil {
+			t.Fatal(err)
+		}
+		s.Get(ctx, 2)
+		s.Get(ctx, 4)
+
+		if loads != 3 {
+			t.Errorf("loaded %d times, want 3", loads)
+		}
+	})
+
+	t.Run("should not cache values loaded before an invalidation", func(t *testing.T) {
+		var s *Store[int64, string]
+		loads := 0
+		s = NewStore(rdb, StoreConfig[int64, string]{
+			Name: fmt.Sprintf("test-%d", time.Now().UnixNano()),
+			TTL:  time.Minute,
+		}, func(ctx context.Context, key int64) (string, error) {
+			loads++
+			if loads == 1 {
+				// the source changes while the first value is loaded
+				s.Invalidate(ctx, key)
+				return "stale", nil
+			}
+			return "fresh", nil
+		})
+
+		s.Get(ctx, 1)
+		if name, _ := s.Get(ctx, 1); name != "fresh" {
+			t.Errorf("got %q, want the value loaded after the invalidation", name)
+		}
+	})
+
+	t.Run("should invalidate the keys of a scope together", func(t *testing.T) {
+		var loads int
+		s := NewStore(rdb, StoreConfig[int64, int64]{
+			Name:  fmt.Sprintf("test-%d", time.Now().UnixNano()),
+			TTL:   time.Minute,
+			Scope: func(key int64) string { return fmt.Sprint(key / 10) },
+		}, func(ctx context.Context, key int64) (int64, error) {
+			loads++
+			return key, nil
+		})
+
+		for _, key := range []int64{11, 12, 21} {
+			s.Get(ctx, key)
+		}
+		if err := s.InvalidateScopes(ctx, "1"); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []int64{11, 12, 21} {
+			s.Get(ctx, key)
+		}
+
+		if loads != 5 {
+			t.Errorf("loaded %d times, want 5", loads)
+		}
+	})
+
+	t.Run("should reload every key after a flush", func(t *testing.T) {
+		var loads int
+		s := NewStore(rdb, StoreConfig[int64, int64]{
+			Name:  fmt.Sprintf("test-%d", time.Now().UnixNano()),
+			TTL:   time.Minute,
+			Scope: func(key int64) string { return fmt.Sprint(key / 10) },
+		}, func(ctx context.Context, key int64) (int64, error) {
+			loads++
+			return key, nil
+		})
+
+		for _, key := range []int64{11, 21} {
+			s.Get(ctx, key)
+		}
+		if err := s.Flush(ctx); err != nil {
+			t.Fatal(err)
+		}
+		for _, key := range []int64{11, 21} {
+			s.Get(ctx, key)
+		}
+
+		if loads != 4 {
+			t.Errorf("loaded %d times, want 4", loads)
+		}
+	})
+
+	t.Run("should not cache values loaded before a flush", func(t *testing.T) {
+		var s *Store[int64, string]
+		loads := 0
+		s = NewStore(rdb, StoreConfig[int64, string]{
+			Name: fmt.Sprintf("test-%d", time.Now().UnixNano()),
+			TTL:  time.Minute,
+		}, func(ctx context.Context, key int64) (string, error) {
+			loads++
+			if loads == 1 {
+				s.Flush(ctx)
+				return "stale", nil
+			}
+			return "fresh", nil
+		})
+
+		s.Get(ctx, 1)
+		if name, _ := s.Get(ctx, 1); name != "fresh" {
+			t.Errorf("got %q, want the value loaded after the flush", name)
+		}
+	})
+}
+
+func TestStoreRedisUnavailable(t *testing.T) {
+	ctx := context.Background()
+
+	// nothing listens on the port, so every command fails to connect
+	rdb := redis.NewClient(&redis.Options{Addr: "127.0.0.1:1", MaxRetries: -1})
+	defer rdb.Close()
+
+	var loads, failures int
+	s := testStore(rdb, &loads, func(error) { failures++ })
+
+	for range 2 {
+		if name, err := s.Get(ctx, 2); err != nil || name != "name-2" {
+			t.Fatalf("Get() = %q, %v", name, err)
+		}
+	}
+	if _, err := s.Get(ctx, 3); !errors.Is(err, repo.ErrNotFound) {
+		t.Errorf("got %v, want ErrNotFound", err)
+	}
+
+	if loads != 3 {
+		t.Errorf("loaded %d times, want 3", loads)
+	}
+	if failures != 3 {
+		t.Errorf("reported %d failures, want 3", failures)
+	}
+	if err := s.Invalidate(ctx, 2); err == nil {
+		t.Error("Invalidate() succeeded without Redis")
+	}
+	if err := s.Flush(ctx); err == nil {
+		t.Error("Flush() succeeded without Redis")
+	}
+}
@@ -0,0 +1,286 @@
+// Package cache provides Redis-based storage for the feed timelines.
+package cache
+
+import (
+	"Go-Microservice/internal/repo"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var (
+	// ErrTimelineMiss is returned when a page of the feed cannot be served from
+	// the cached timeline, e.g. because the page reaches past the capped
+	// timeline. The feed has to be read from the database instead.
+	ErrTimelineMiss = errors.New("timeline miss")
+	// ErrTimelineCold is returned for users without a cached timeline.
+	ErrTimelineCold = fmt.Errorf("%w: no timeline", ErrTimelineMiss)
+)
+
+// timelineSentinel is kept in every cached timeline with the lowest possible
+// score, so that an empty timeline still exists and is told apart from a
+// timeline that was never built.
+const timelineSentinel = "0"
+
+// timelineAddScript adds posts to a timeline that already exists and trims it
+// to the newest ARGV[1] posts, keeping the sentinel at rank 0.
+var timelineAddScript = redis.NewScript(`
+if redis.call('EXISTS', KEYS[1]) == 0 then
+	return 0
+end
+for i = 2, #ARGV, 2 do
+	redis.call('ZADD', KEYS[1], ARGV[i], ARGV[i + 1])
+end
+redis.call('ZREMRANGEBYRANK', KEYS[1], 1, -(tonumber(ARGV[1]) + 1))
+return 1
+`)
+
+// TimelineStore keeps the feed of each user as a sorted set of post IDs scored
+// by creation time. New posts are pushed to the timelines of the followers of
+// their author when they are created (fan-out on write). Timelines are capped
+// at maxLen posts and expire when they have not been read for ttl.
+type TimelineStore struct {
+	rdb    *redis.Client
+	maxLen int
+	ttl    time.Duration
+}
+
+// NewTimelineStore creates a new TimelineStore with the specified Redis client.
+//
+// Parameters:
+//   - rdb: Redis client instance
+//   - maxLen: Maximum number of posts kept per timeline
+//   - ttl: Time after which a timeline that is not read expires
+//
+// Returns:
+//   - *TimelineStore: Configured timeline store instance
+func NewTimelineStore(rdb *redis.Client, maxLen int, ttl time.Duration) *TimelineStore {
+	return &TimelineStore{rdb: rdb, maxLen: maxLen, ttl: ttl}
+}
+
+// MaxLen returns the maximum number of posts kept per timeline.
+func (s *TimelineStore) MaxLen() int {
+	return s.maxLen
+}
+
+// Page returns the IDs of the posts on a page of the feed, newest first, and
+// whether there are more posts past the page in its reading direction. Only
+// the plain newest first feed is cached; for other queries and for cursors
+// that are no longer in the timeline ErrTimelineMiss is returned, and
+// ErrTimelineCold for users without a timeline.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - userID: Owner of the feed
+//   - fq: Page of the feed to read
+//
+// Returns:
+//   - []int64: IDs of the posts of the page
+//   - bool: True if there are more posts past the page
+//   - error: ErrTimelineMiss, ErrTimelineCold, or error if operation fails
+func (s *TimelineStore) Page(ctx context.Context, userID int64, fq repo.PaginatedFeedQuery) ([]int64, bool, error) {
+	if fq.Sort != "desc" || fq.Search != "" || len(fq.Tags) > 0 || fq.Since != "" || fq.Until != "" {
+		return nil, false, ErrTimelineMiss
+	}
+
+	key := s.key(userID)
+
+	pipe := s.rdb.Pipeline()
+	card := pipe.ZCard(ctx, key)
+	var rank *redis.IntCmd
+	if fq.Cursor != nil {
+		rank = pipe.ZRevRank(ctx, key, s.member(fq.Cursor.ID))
+	}
+	pipe.Expire(ctx, key, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return nil, false, fmt.Errorf("failed to read timeline: %w", err)
+	}
+
+	// every timeline holds the sentinel, an empty set is a timeline never built
+	size := card.Val() - 1
+	if size < 0 {
+		return nil, false, ErrTimelineCold
+	}
+
+	limit := int64(fq.Limit)
+	start := int64(fq.Offset)
+	if fq.Cursor != nil {
+		if errors.Is(rank.Err(), redis.Nil) {
+			return nil, false, ErrTimelineMiss
+		}
+
+		start = rank.Val() + 1
+		if fq.Cursor.Before {
+			start = max(rank.Val()-limit, 0)
+			limit = rank.Val() - start
+		}
+	}
+
+	// a capped timeline misses the older posts of the feed
+	if start+limit >= size && size >= int64(s.maxLen) {
+		return nil, false, ErrTimelineMiss
+	}
+
+	hasMore := start+limit < size
+	if fq.Cursor != nil && fq.Cursor.Before {
+		hasMore = start > 0
+	}
+
+	if limit == 0 {
+		return []int64{}, hasMore, nil
+	}
+
+	members, err := s.rdb.ZRevRange(ctx, key, start, start+limit-1).Result()
+	if err != nil {
+		return nil, false, fmt.Errorf("failed to read timeline: %w", err)
+	}
+
+	ids := make([]int64, 0, len(members))
+	for _, m := range members {
+		if m == timelineSentinel {
+			continue
+		}
+		id, err := strconv.ParseInt(m, 10, 64)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to parse timeline entry %q: %w", m, err)
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, hasMore, nil
+}
+
+// Set replaces the timeline of a user with the given posts.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - userID: Owner of the timeline
+//   - entries: Newest posts of the feed of the user
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *TimelineStore) Set(ctx context.Context, userID int64, entries []repo.TimelineEntry) error {
+	key := s.key(userID)
+
+	members := make([]redis.Z, 0, len(entries)+1)
+	members = append(members, redis.Z{Score: math.Inf(-1), Member: timelineSentinel})
+	for _, e := range entries {
+		members = append(members, redis.Z{Score: float64(e.CreatedAt.Unix()), Member: s.member(e.PostID)})
+	}
+
+	pipe := s.rdb.TxPipeline()
+	pipe.Del(ctx, key)
+	pipe.ZAdd(ctx, key, members...)
+	pipe.ZRemRangeByRank(ctx, key, 1, -int64(s.maxLen)-1)
+	pipe.Expire(ctx, key, s.ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to set timeline: %w", err)
+	}
+
+	return nil
+}
+
+// Push adds a new post to the timelines of the given users. Users without a
+// timeline are skipped, their timeline is built from the database on read.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - entry: The new post
+//   - userIDs: Users whose feed shows the post
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *TimelineStore) Push(ctx context.Context, entry repo.TimelineEntry, userIDs []int64) error {
+	pipe := s.rdb.Pipeline()
+	for _, userID := range userIDs {
+		timelineAddScript.Eval(ctx, pipe, []string{s.key(userID)}, s.maxLen, entry.CreatedAt.Unix(), s.member(entry.PostID))
+	}
+
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("failed to push to timelines: %w", err)
+	}
+
+	return nil
+}
+
+// Backfill adds the posts of a newly followed user to the timeline of a user,
+// if the user has a timeline.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - userID: Owner of the timeline
+//   - entries: Posts of the followed user
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *TimelineStore) Backfill(ctx context.Context, userID int64, entries []repo.TimelineEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, 2*len(entries)+1)
+	args = append(args, s.maxLen)
+	for _, e := range entries {
+		args = append(args, e.CreatedAt.Unix(), s.member(e.PostID))
+	}
+
+	if err := timelineAddScript.Run(ctx, s.rdb, []string{s.key(userID)}, args...).Err(); err != nil {
+		return fmt.Errorf("failed to backfill timeline: %w", err)
+	}
+
+	return nil
+}
+
+// Remove removes posts from the timeline of a user, e.g. the posts of a user
+// that was unfollowed. A full timeline is dropped instead, as the posts taking
+// the place of the removed ones are not cached.
+//
+// Parameters:
+//   - ctx: Context for the operation
+//   - userID: Owner of the timeline
+//   - postIDs: Posts to remove
+//
+// Returns:
+//   - error: Error if operation fails
+func (s *TimelineStore) Remove(ctx context.Context, userID int64, postIDs []int64) error {
+	if len(postIDs) == 0 {
+		return nil
+	}
+
+	key := s.key(userID)
+
+	card, err := s.rdb.ZCard(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("failed to remove from timeline: %w", err)
+	}
+
+	if card-1 >= int64(s.maxLen) {
+		err = s.rdb.Del(ctx, key).Err()
+	} else {
+		members := make([]any, len(postIDs))
+		for i, id := range postIDs {
+			members[i] = s.member(id)
+		}
+		err = s.rdb.ZRem(ctx, key, members...).Err()
+	}
+	if err != nil {
+		return fmt.Errorf("failed to remove from timeline: %w", err)
+	}
+
+	return nil
+}
+
+func (s *TimelineStore) key(userID int64) string {
+	return fmt.Sprintf("timeline-%d", userID)
+}
+
+// member zero-pads post IDs, so that posts created in the same second are
+// ordered by ID like in the database.
+func (s *TimelineStore) member(postID int64) string {
+	return fmt.Sprintf("%019d", postID)
+}
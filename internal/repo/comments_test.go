@@ -0,0 +1,28 @@
+package repo
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCommentCursor(t *testing.T) {
+	t.Run("should round trip", func(t *testing.T) {
+		want := CommentCursor{CreatedAt: time.Date(2024, 1, 15, 11, 30, 0, 0, time.UTC), ID: 42}
+
+		got, err := DecodeCommentCursor(want.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("should reject tampered cursors", func(t *testing.T) {
+		for _, cursor := range []string{"not base64!", "MjAyNA", "MjAyNCwx"} {
+			if _, err := DecodeCommentCursor(cursor); err == nil {
+				t.Errorf("cursor %q accepted", cursor)
+			}
+		}
+	})
+}
@@ -3,6 +3,14 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
 )
 
 // Comment represents a comment on a post
@@ -21,6 +29,10 @@ type Comment struct {
 	//	@example	1
 	PostID int64 `json:"post_id" example:"1"`
 
+	// ID of the comment this is a reply to, null for top-level comments
+	//	@example	3
+	ParentID *int64 `json:"parent_id" example:"3"`
+
 	// ID of the user who created the comment
 	//	@example	2
 	UserID int64 `json:"user_id" example:"2"`
@@ -29,22 +41,241 @@ type Comment struct {
 	//	@example	2024-01-15T11:30:00Z
 	CreatedAt string `json:"created_at" example:"2024-01-15T11:30:00Z"`
 
+	// Whether the content was changed after the comment was created
+	//	@example	true
+	Edited bool `json:"edited" example:"true"`
+
+	// Timestamp of the last edit, omitted for unedited comments
+	//	@example	2024-01-15T12:00:00Z
+	EditedAt string `json:"edited_at,omitempty" example:"2024-01-15T12:00:00Z"`
+
+	// Version of the comment, which edits and deletes can be conditioned on
+	// with If-Match
+	//	@example	1
+	Version int32 `json:"version" example:"1"`
+
+	// Number of reactions per kind
+	Reactions ReactionCounts `json:"reactions"`
+
 	User User `json:"user"`
+
+	// Number of direct replies, which may exceed the embedded replies
+	//	@example	4
+	ReplyCount int `json:"reply_count" example:"4"`
+
+	// Replies up to the requested depth, oldest first
+	Replies []Comment `json:"replies,omitempty"`
+}
+
+// RepliesPerComment caps the replies embedded in each comment of a thread.
+// The rest are paged with the comment as parent.
+const RepliesPerComment = 10
+
+// CommentQuery selects a page of the comments of a post with the given
+// parent, together with their replies down to Depth levels.
+type CommentQuery struct {
+	// ParentID is 0 for the top-level comments, which are ordered newest
+	// first. Replies are ordered oldest first.
+	ParentID int64          `json:"parent_id" validate:"gte=0"`
+	Limit    int            `json:"limit" validate:"gte=1,lte=100"`
+	Depth    int            `json:"depth" validate:"gte=1,lte=5"`
+	Cursor   *CommentCursor `json:"-"`
+}
+
+// CommentCursor points at the last comment of a page.
+type CommentCursor struct {
+	CreatedAt time.Time
+	ID        int64
+}
+
+// Encode returns the opaque form of the cursor handed to clients.
+func (c CommentCursor) Encode() string {
+	raw := c.CreatedAt.UTC().Format(time.RFC3339Nano) + "," + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeCommentCursor parses a cursor created by CommentCursor.Encode.
+func DecodeCommentCursor(s string) (*CommentCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	createdAtStr, idStr, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, createdAtStr)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &CommentCursor{CreatedAt: createdAt, ID: id}, nil
+}
+
+// CommentPage is a page of comments with the cursor of the next page, which
+// is empty on the last page.
+type CommentPage struct {
+	Comments   []Comment
+	NextCursor string
 }
 
+var (
+	// ErrParentNotFound is returned when replying to a comment that is not on the post.
+	ErrParentNotFound = errors.New("parent comment not found")
+	// ErrEditConflict is returned when a post or comment was changed since it was read.
+	ErrEditConflict = errors.New("changed concurrently, retry")
+)
+
 type CommentRepo struct {
 	db *sql.DB
 }
 
-func (commentRepo *CommentRepo) GetByPostID(ctx context.Context, postID int64) ([]Comment, error) {
+// visibleComment is the condition that neither the comment with the given ID
+// nor any of its ancestors is deleted, and that none of their authors is:
+// deleting a comment or a user hides the replies below it, until a restore
+// brings them back.
+func visibleComment(id string) string {
+	return `NOT EXISTS (
+		WITH RECURSIVE ancestors AS (
+			SELECT id, parent_id, user_id, deleted_at FROM comments WHERE id = ` + id + `
+			UNION ALL
+			SELECT a.id, a.parent_id, a.user_id, a.deleted_at
+			FROM comments a JOIN ancestors d ON a.id = d.parent_id
+		)
+		SELECT 1 FROM ancestors JOIN users au ON au.id = ancestors.user_id
+		WHERE ancestors.deleted_at IS NOT NULL OR au.deleted_at IS NOT NULL
+	)`
+}
+
+// commentColumns are read by (*CommentRepo).query, c are the comments and u their authors.
+const commentColumns = `
+	c.id, c.post_id, c.parent_id, c.user_id, c.content, c.created_at, c.edited_at, c.version, u.username, u.id,
+	(SELECT COUNT(*) FROM comments r JOIN users ru ON ru.id = r.user_id
+		WHERE r.parent_id = c.id AND r.deleted_at IS NULL AND ru.deleted_at IS NULL)
+`
+
+// GetThread returns a page of the comments of a post with the parent of the
+// query, each with up to RepliesPerComment replies per level below it.
+func (commentRepo *CommentRepo) GetThread(ctx context.Context, postID int64, q CommentQuery) (*CommentPage, error) {
+	args := []any{postID, q.Limit + 1}
+
+	parent, order, seek := "c.parent_id IS NULL", "DESC", "<"
+	if q.ParentID != 0 {
+		args = append(args, q.ParentID)
+		parent, order, seek = "c.parent_id = $3 AND "+visibleComment("$3"), "ASC", ">"
+	}
+
+	keyset := ""
+	if q.Cursor != nil {
+		args = append(args, q.Cursor.CreatedAt, q.Cursor.ID)
+		keyset = fmt.Sprintf(" AND (c.created_at, c.id) %s ($%d, $%d)", seek, len(args)-1, len(args))
+	}
+
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.post_id = $1 AND c.deleted_at IS NULL AND u.deleted_at IS NULL AND ` + parent + keyset + `
+		ORDER BY c.created_at ` + order + `, c.id ` + order + `
+		LIMIT $2
+	`
+
+	comments, err := commentRepo.query(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	page := &CommentPage{Comments: comments}
+	if len(comments) > q.Limit {
+		page.Comments = comments[:q.Limit]
+		last := page.Comments[q.Limit-1]
+
+		createdAt, err := time.Parse(time.RFC3339Nano, last.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("failed to build comment cursor: %w", err)
+		}
+		page.NextCursor = CommentCursor{CreatedAt: createdAt, ID: last.ID}.Encode()
+	}
+
+	if q.Depth > 1 && len(page.Comments) > 0 {
+		if err := commentRepo.attachReplies(ctx, page.Comments, q.Depth-1); err != nil {
+			return nil, err
+		}
+	}
+
+	return page, nil
+}
+
+// attachReplies fills in the replies of comments down to depth levels, the
+// oldest RepliesPerComment of each comment.
+func (commentRepo *CommentRepo) attachReplies(ctx context.Context, comments []Comment, depth int) error {
+	ids := make([]int64, len(comments))
+	for i, c := range comments {
+		ids[i] = c.ID
+	}
+
 	query := `
-		SELECT c.id, c.post_id, c.user_id, c.content, c.created_at, users.username, users.id  FROM comments c
-		JOIN users on users.id = c.user_id
-		WHERE c.post_id = $1
-		ORDER BY c.created_at DESC;
+		WITH RECURSIVE tree AS (
+			SELECT r.id, 1 AS depth
+			FROM unnest($1::bigint[]) p(id)
+			CROSS JOIN LATERAL (
+				SELECT r.id FROM comments r JOIN users ru ON ru.id = r.user_id
+				WHERE r.parent_id = p.id AND r.deleted_at IS NULL AND ru.deleted_at IS NULL
+				ORDER BY r.created_at, r.id LIMIT $3
+			) r
+			UNION ALL
+			SELECT r.id, t.depth + 1
+			FROM tree t
+			CROSS JOIN LATERAL (
+				SELECT r.id FROM comments r JOIN users ru ON ru.id = r.user_id
+				WHERE r.parent_id = t.id AND r.deleted_at IS NULL AND ru.deleted_at IS NULL
+				ORDER BY r.created_at, r.id LIMIT $3
+			) r
+			WHERE t.depth < $2
+		)
+		SELECT ` + commentColumns + `
+		FROM tree t
+		JOIN comments c ON c.id = t.id
+		JOIN users u ON u.id = c.user_id
+		ORDER BY c.created_at, c.id
 	`
 
-	rows, err := commentRepo.db.QueryContext(ctx, query, postID)
+	replies, err := commentRepo.query(ctx, query, pq.Array(ids), depth, RepliesPerComment)
+	if err != nil {
+		return err
+	}
+
+	children := make(map[int64][]Comment)
+	for _, r := range replies {
+		children[*r.ParentID] = append(children[*r.ParentID], r)
+	}
+
+	var attach func(c *Comment)
+	attach = func(c *Comment) {
+		c.Replies = children[c.ID]
+		for i := range c.Replies {
+			attach(&c.Replies[i])
+		}
+	}
+	for i := range comments {
+		attach(&comments[i])
+	}
+
+	return nil
+}
+
+func (commentRepo *CommentRepo) query(ctx context.Context, query string, args ...any) ([]Comment, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := commentRepo.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
@@ -52,22 +283,36 @@ func (commentRepo *CommentRepo) GetByPostID(ctx context.Context, postID int64) (
 
 	comments := []Comment{}
 	for rows.Next() {
-		var c Comment
-		c.User = User{}
-		err := rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Content, &c.CreatedAt, &c.User.Username, &c.User.ID)
+		var (
+			c        Comment
+			parentID sql.NullInt64
+			editedAt sql.NullString
+		)
+		err := rows.Scan(
+			&c.ID, &c.PostID, &parentID, &c.UserID, &c.Content, &c.CreatedAt, &editedAt, &c.Version,
+			&c.User.Username, &c.User.ID, &c.ReplyCount,
+		)
 		if err != nil {
 			return nil, err
 		}
+		if parentID.Valid {
+			c.ParentID = &parentID.Int64
+		}
+		c.Edited, c.EditedAt = editedAt.Valid, editedAt.String
 		comments = append(comments, c)
 	}
 
-	return comments, nil
+	return comments, rows.Err()
 }
 
+// Create adds a comment, or a reply if ParentID is set. Returns
+// ErrParentNotFound if the parent is not a comment on the same post.
 func (commentRepo *CommentRepo) Create(ctx context.Context, comment *Comment) error {
 	query := `
-		INSERT INTO comments (post_id, user_id, content)
-		VALUES ($1, $2, $3)
+		INSERT INTO comments (post_id, user_id, content, parent_id)
+		SELECT $1, $2, $3, $4
+		WHERE $4::bigint IS NULL
+		   OR (EXISTS (SELECT 1 FROM comments WHERE id = $4 AND post_id = $1) AND ` + visibleComment("$4") + `)
 		RETURNING id, created_at
 	`
 
@@ -80,12 +325,92 @@ func (commentRepo *CommentRepo) Create(ctx context.Context, comment *Comment) er
 		comment.PostID,
 		comment.UserID,
 		comment.Content,
+		comment.ParentID,
 	).Scan(
 		&comment.ID,
 		&comment.CreatedAt,
 	)
 	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrParentNotFound
+		}
 		return err
 	}
 	return nil
 }
+
+func (commentRepo *CommentRepo) GetByID(ctx context.Context, id int64) (*Comment, error) {
+	query := `
+		SELECT ` + commentColumns + `
+		FROM comments c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.id = $1 AND ` + visibleComment("c.id") + `
+	`
+
+	comments, err := commentRepo.query(ctx, query, id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get comment: %w", err)
+	}
+	if len(comments) == 0 {
+		return nil, fmt.Errorf("%w: comment with ID %d", ErrNotFound, id)
+	}
+
+	return &comments[0], nil
+}
+
+// Update changes the content of a comment at comment.Version and marks it as
+// edited. Returns ErrEditConflict if the comment was changed since it was read.
+func (commentRepo *CommentRepo) Update(ctx context.Context, comment *Comment) error {
+	query := `
+		UPDATE comments
+		SET content = $1, edited_at = NOW(), version = version + 1
+		WHERE id = $2 AND version = $3 AND deleted_at IS NULL
+		RETURNING version, edited_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	err := commentRepo.db.QueryRowContext(
+		ctx,
+		query,
+		comment.Content,
+		comment.ID,
+		comment.Version,
+	).Scan(&comment.Version, &comment.EditedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return missingOrConflict(ctx, commentRepo.db, "comment", comment.ID)
+		}
+		return fmt.Errorf("failed to update comment: %w", err)
+	}
+
+	comment.Edited = true
+	return nil
+}
+
+// Delete soft deletes a comment at comment.Version, which hides it and its
+// replies until it is restored or purged. Returns ErrEditConflict if the
+// comment was changed since it was read.
+func (commentRepo *CommentRepo) Delete(ctx context.Context, comment *Comment) error {
+	query := `UPDATE comments SET deleted_at = NOW() WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result, err := commentRepo.db.ExecContext(ctx, query, comment.ID, comment.Version)
+	if err != nil {
+		return fmt.Errorf("failed to delete comment: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return missingOrConflict(ctx, commentRepo.db, "comment", comment.ID)
+	}
+
+	return nil
+}
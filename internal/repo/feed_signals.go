@@ -0,0 +1,95 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AuthorSignals describe the relation of a reader to an author they follow.
+type AuthorSignals struct {
+	AuthorID int64
+	// Mutual is set if the author follows the reader back
+	Mutual bool
+	// Interactions is the number of recent comments of the reader on posts of the author
+	Interactions int
+}
+
+// FeedSignals describe the recent activity of a reader, used to rank the feed.
+type FeedSignals struct {
+	// Authors holds the signals of every author the reader follows
+	Authors map[int64]AuthorSignals
+	// Tags counts the tags of the posts the reader recently wrote or commented on
+	Tags map[string]int
+}
+
+type FeedSignalsStore struct {
+	db *sql.DB
+}
+
+// Get returns the signals of a reader from the activity since the given time.
+func (s *FeedSignalsStore) Get(ctx context.Context, userID int64, since time.Time) (*FeedSignals, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	signals := &FeedSignals{
+		Authors: make(map[int64]AuthorSignals),
+		Tags:    make(map[string]int),
+	}
+
+	authorsQuery := `
+		SELECT
+			f.user_id,
+			EXISTS (SELECT 1 FROM followers b WHERE b.user_id = $1 AND b.follower_id = f.user_id),
+			(SELECT COUNT(*) FROM comments c JOIN posts p ON p.id = c.post_id
+				WHERE c.user_id = $1 AND p.user_id = f.user_id AND c.created_at >= $2
+				  AND c.deleted_at IS NULL AND p.deleted_at IS NULL)
+		FROM followers f
+		WHERE f.follower_id = $1
+	`
+
+	rows, err := s.db.QueryContext(ctx, authorsQuery, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var a AuthorSignals
+		if err := rows.Scan(&a.AuthorID, &a.Mutual, &a.Interactions); err != nil {
+			return nil, err
+		}
+		signals.Authors[a.AuthorID] = a
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	tagsQuery := `
+		SELECT tag, COUNT(*) FROM (
+			SELECT unnest(p.tags) AS tag FROM posts p
+			WHERE p.user_id = $1 AND p.created_at >= $2 AND p.deleted_at IS NULL
+			UNION ALL
+			SELECT unnest(p.tags) FROM comments c JOIN posts p ON p.id = c.post_id
+			WHERE c.user_id = $1 AND c.created_at >= $2 AND c.deleted_at IS NULL AND p.deleted_at IS NULL
+		) t
+		GROUP BY tag
+	`
+
+	tagRows, err := s.db.QueryContext(ctx, tagsQuery, userID, since)
+	if err != nil {
+		return nil, err
+	}
+	defer tagRows.Close()
+
+	for tagRows.Next() {
+		var tag string
+		var count int
+		if err := tagRows.Scan(&tag, &count); err != nil {
+			return nil, err
+		}
+		signals.Tags[tag] = count
+	}
+
+	return signals, tagRows.Err()
+}
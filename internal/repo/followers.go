@@ -46,3 +46,32 @@ func (s *FollowerRepo) Unfollow(ctx context.Context, followerID, userID int64) e
 	_, err := s.db.ExecContext(ctx, query, userID, followerID)
 	return err
 }
+
+// GetFollowerIDs returns the IDs of the users following userID.
+func (s *FollowerRepo) GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error) {
+	query := `
+		SELECT f.follower_id FROM followers f
+		JOIN users u ON u.id = f.follower_id
+		WHERE f.user_id = $1 AND u.deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
@@ -0,0 +1,105 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// Identity links an account at an external identity provider, identified by
+// the sub claim of its ID tokens, to a user.
+type Identity struct {
+	ID        int64
+	Provider  string
+	Subject   string
+	UserID    int64
+	Email     string
+	CreatedAt time.Time
+}
+
+type IdentityStore struct {
+	db *sql.DB
+}
+
+// GetUserID returns the user linked to the external account, or ErrNotFound
+// if the account was never used to sign in.
+func (s *IdentityStore) GetUserID(ctx context.Context, provider, subject string) (int64, error) {
+	query := `
+		SELECT users.id FROM user_identities
+		JOIN users ON users.id = user_identities.user_id
+		WHERE provider = $1 AND subject = $2 AND users.is_active = true AND users.deleted_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var userID int64
+	err := s.db.QueryRowContext(ctx, query, provider, subject).Scan(&userID)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return 0, ErrNotFound
+		default:
+			return 0, err
+		}
+	}
+
+	return userID, nil
+}
+
+// Link links the external account to an existing user. It returns
+// ErrConflict if the account is already linked.
+func (s *IdentityStore) Link(ctx context.Context, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, identity)
+	})
+}
+
+// CreateUser creates an already activated user for the external account, as
+// the provider has vouched for the email address.
+func (s *IdentityStore) CreateUser(ctx context.Context, user *User, identity *Identity) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		users := &UserStore{s.db}
+		if err := users.Create(ctx, tx, user); err != nil {
+			return err
+		}
+
+		user.IsActive = true
+		if err := users.update(ctx, tx, user); err != nil {
+			return err
+		}
+
+		identity.UserID = user.ID
+		return s.create(ctx, tx, identity)
+	})
+}
+
+func (s *IdentityStore) create(ctx context.Context, tx *sql.Tx, identity *Identity) error {
+	query := `
+		INSERT INTO user_identities (provider, subject, user_id, email)
+		VALUES ($1, $2, $3, NULLIF($4, ''))
+		ON CONFLICT (provider, subject) DO NOTHING
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	err := tx.QueryRowContext(
+		ctx,
+		query,
+		identity.Provider,
+		identity.Subject,
+		identity.UserID,
+		identity.Email,
+	).Scan(
+		&identity.ID,
+		&identity.CreatedAt,
+	)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrConflict
+	}
+
+	return err
+}
@@ -0,0 +1,193 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrTOTPCodeReused = errors.New("totp code has already been used")
+)
+
+// MFASettings holds the TOTP enrollment of a user. A secret that is stored
+// but not yet enabled belongs to an enrollment awaiting its first code.
+type MFASettings struct {
+	UserID  int64
+	Secret  string
+	Enabled bool
+}
+
+type MFAStore struct {
+	db *sql.DB
+}
+
+// Get returns the MFA settings of a user, or ErrNotFound if the user never
+// started an enrollment.
+func (s *MFAStore) Get(ctx context.Context, userID int64) (*MFASettings, error) {
+	query := `SELECT mfa_secret, mfa_enabled FROM users WHERE id = $1 AND mfa_secret IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	settings := &MFASettings{UserID: userID}
+	err := s.db.QueryRowContext(ctx, query, userID).Scan(&settings.Secret, &settings.Enabled)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return settings, nil
+}
+
+// SetSecret starts a new enrollment by storing secret for a user that has
+// not enabled MFA yet, replacing a previous pending secret. It returns
+// ErrConflict if MFA is already enabled.
+func (s *MFAStore) SetSecret(ctx context.Context, userID int64, secret string) error {
+	query := `UPDATE users SET mfa_secret = $1, mfa_last_step = NULL WHERE id = $2 AND mfa_enabled = false`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, secret, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrConflict
+	}
+
+	return nil
+}
+
+// Enable turns on MFA for a user with a pending secret and replaces the
+// recovery codes of the user with the given hashed codes.
+func (s *MFAStore) Enable(ctx context.Context, userID int64, recoveryCodes []string) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `UPDATE users SET mfa_enabled = true WHERE id = $1 AND mfa_secret IS NOT NULL`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		if _, err := tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID); err != nil {
+			return err
+		}
+
+		for _, code := range recoveryCodes {
+			query := `INSERT INTO mfa_recovery_codes (code, user_id) VALUES ($1, $2)`
+			if _, err := tx.ExecContext(ctx, query, code, userID); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+// UseTOTPStep records that the code of the given time step was used. It
+// returns ErrTOTPCodeReused if a code of this or a later step was already
+// accepted, which stops a code from being replayed within its validity.
+func (s *MFAStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	query := `
+		UPDATE users SET mfa_last_step = $1
+		WHERE id = $2 AND (mfa_last_step IS NULL OR mfa_last_step < $1)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, step, userID)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrTOTPCodeReused
+	}
+
+	return nil
+}
+
+// UseRecoveryCode consumes the hashed recovery code of a user. It returns
+// ErrNotFound if the code is unknown or has already been used.
+func (s *MFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	query := `
+		UPDATE mfa_recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code = $2 AND used_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, userID, code)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// Disable turns off MFA for a user and drops the secret, pending or enabled,
+// together with the recovery codes of the user. It returns ErrNotFound if the
+// user never started an enrollment.
+func (s *MFAStore) Disable(ctx context.Context, userID int64) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			UPDATE users SET mfa_secret = NULL, mfa_enabled = false, mfa_last_step = NULL
+			WHERE id = $1 AND mfa_secret IS NOT NULL
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+		defer cancel()
+
+		res, err := tx.ExecContext(ctx, query, userID)
+		if err != nil {
+			return err
+		}
+
+		rows, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if rows == 0 {
+			return ErrNotFound
+		}
+
+		_, err = tx.ExecContext(ctx, `DELETE FROM mfa_recovery_codes WHERE user_id = $1`, userID)
+		return err
+	})
+}
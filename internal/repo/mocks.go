@@ -3,12 +3,22 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"sync"
 	"time"
 )
 
 func NewMockStore() Repository {
 	return Repository{
-		Users: &MockUserStore{},
+		Posts:         &MockPostStore{},
+		Comments:      &MockCommentStore{},
+		Users:         &MockUserStore{},
+		RefreshTokens: &MockRefreshTokenStore{},
+		RevokedTokens: &MockRevocationStore{},
+		MFA:           &MockMFAStore{},
+		APIKeys:       &MockAPIKeyStore{},
+		FeedSignals:   &MockFeedSignalsStore{},
+		Search:        &MockSearchStore{},
+		Reactions:     &MockReactionStore{},
 	}
 }
 
@@ -34,6 +44,342 @@ func (m *MockUserStore) Activate(ctx context.Context, t string) error {
 	return nil
 }
 
+func (m *MockUserStore) RotateInvitation(ctx context.Context, email string, token string, exp time.Duration) (*User, error) {
+	return &User{ID: 1, Email: email}, nil
+}
+
+func (m *MockUserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) DeleteUnactivated(ctx context.Context, maxAge time.Duration) (int64, error) {
+	return 0, nil
+}
+
 func (m *MockUserStore) Delete(ctx context.Context, id int64) error {
 	return nil
 }
+
+func (m *MockUserStore) Purge(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockUserStore) Restore(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockUserStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockUserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return nil
+}
+
+func (m *MockUserStore) ResetPassword(ctx context.Context, token string, newPassword string) (int64, error) {
+	return 1, nil
+}
+
+type MockRefreshTokenStore struct{}
+
+func (m *MockRefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	return nil
+}
+
+func (m *MockRefreshTokenStore) Rotate(ctx context.Context, hashToken string, next *RefreshToken) error {
+	next.UserID = 1
+	return nil
+}
+
+func (m *MockRefreshTokenStore) RevokeFamily(ctx context.Context, hashToken string) error {
+	return nil
+}
+
+func (m *MockRefreshTokenStore) RevokeAllForUser(ctx context.Context, userID int64) error {
+	return nil
+}
+
+// MockRevocationStore remembers the tokens revoked individually and the time
+// of the last "log out all sessions" of each user.
+type MockRevocationStore struct {
+	sync.Mutex
+	jtis  map[string]time.Time
+	users map[int64]time.Time
+}
+
+func (m *MockRevocationStore) Revoke(ctx context.Context, jti string, exp time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.jtis == nil {
+		m.jtis = make(map[string]time.Time)
+	}
+	m.jtis[jti] = exp
+	return nil
+}
+
+func (m *MockRevocationStore) RevokeAllForUser(ctx context.Context, userID int64, exp time.Time) error {
+	m.Lock()
+	defer m.Unlock()
+
+	if m.users == nil {
+		m.users = make(map[int64]time.Time)
+	}
+	m.users[userID] = time.Now()
+	return nil
+}
+
+func (m *MockRevocationStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	if _, ok := m.jtis[jti]; ok {
+		return true, nil
+	}
+	revokedBefore, ok := m.users[userID]
+	return ok && issuedAt.Unix() < revokedBefore.Unix(), nil
+}
+
+func (m *MockRevocationStore) List(ctx context.Context) ([]Revocation, error) {
+	m.Lock()
+	defer m.Unlock()
+
+	var revocations []Revocation
+	for jti, exp := range m.jtis {
+		revocations = append(revocations, Revocation{JTI: jti, Expiry: exp})
+	}
+	return revocations, nil
+}
+
+// MockMFAStore reports every user as enrolled with Secret, or as not enrolled
+// if Secret is empty.
+type MockMFAStore struct {
+	Secret string
+}
+
+func (m *MockMFAStore) Get(ctx context.Context, userID int64) (*MFASettings, error) {
+	if m.Secret == "" {
+		return nil, ErrNotFound
+	}
+	return &MFASettings{UserID: userID, Secret: m.Secret, Enabled: true}, nil
+}
+
+func (m *MockMFAStore) SetSecret(ctx context.Context, userID int64, secret string) error {
+	return nil
+}
+
+func (m *MockMFAStore) Enable(ctx context.Context, userID int64, recoveryCodes []string) error {
+	return nil
+}
+
+func (m *MockMFAStore) UseTOTPStep(ctx context.Context, userID int64, step int64) error {
+	return nil
+}
+
+func (m *MockMFAStore) UseRecoveryCode(ctx context.Context, userID int64, code string) error {
+	return nil
+}
+
+func (m *MockMFAStore) Disable(ctx context.Context, userID int64) error {
+	if m.Secret == "" {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// MockAPIKeyStore authenticates every key as a key of user 1 with Scopes.
+type MockAPIKeyStore struct {
+	Scopes []string
+}
+
+func (m *MockAPIKeyStore) Create(ctx context.Context, key *APIKey) error {
+	key.ID = 1
+	key.CreatedAt = time.Now()
+	return nil
+}
+
+func (m *MockAPIKeyStore) GetByUserID(ctx context.Context, userID int64) ([]APIKey, error) {
+	return []APIKey{}, nil
+}
+
+func (m *MockAPIKeyStore) Authenticate(ctx context.Context, hashKey string) (*APIKey, error) {
+	return &APIKey{ID: 1, Key: hashKey, UserID: 1, Scopes: m.Scopes}, nil
+}
+
+func (m *MockAPIKeyStore) Revoke(ctx context.Context, userID, keyID int64) error {
+	return nil
+}
+
+// MockPostStore serves the feed from Feed and counts how often the feed was
+// read from the database.
+type MockPostStore struct {
+	Feed      []PostWithMetadata
+	FeedReads int
+}
+
+func (m *MockPostStore) Create(ctx context.Context, post *Post) error {
+	post.ID = 1
+	post.CreatedAt = time.Now().Format(time.RFC3339Nano)
+	return nil
+}
+
+func (m *MockPostStore) GetByID(ctx context.Context, id int64) (*Post, error) {
+	return &Post{ID: id, UserID: 1}, nil
+}
+
+func (m *MockPostStore) Delete(ctx context.Context, post *Post) error {
+	return nil
+}
+
+func (m *MockPostStore) Update(ctx context.Context, post *Post) error {
+	post.Version++
+	return nil
+}
+
+// GetRevisions returns the two versions of every post, 1 being current.
+func (m *MockPostStore) GetRevisions(ctx context.Context, postID int64) ([]PostRevision, error) {
+	return []PostRevision{
+		{Version: 1, Title: "Hello Go", Content: "Go is simple and fast", Current: true},
+		{Version: 0, Title: "Hello Go", Content: "Go is simple"},
+	}, nil
+}
+
+func (m *MockPostStore) GetRevision(ctx context.Context, postID int64, version int32) (*PostRevision, error) {
+	revisions, _ := m.GetRevisions(ctx, postID)
+	for _, rev := range revisions {
+		if rev.Version == version {
+			return &rev, nil
+		}
+	}
+	return nil, ErrNotFound
+}
+
+func (m *MockPostStore) Restore(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockPostStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
+
+func (m *MockPostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) (*FeedPage, error) {
+	m.FeedReads++
+	return NewFeedPage(m.Feed, fq, false)
+}
+
+func (m *MockPostStore) GetByIDs(ctx context.Context, ids []int64) ([]PostWithMetadata, error) {
+	posts := []PostWithMetadata{}
+	for _, id := range ids {
+		for _, p := range m.Feed {
+			if p.ID == id {
+				posts = append(posts, p)
+			}
+		}
+	}
+	return posts, nil
+}
+
+func (m *MockPostStore) GetTimelineEntries(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error) {
+	return []TimelineEntry{}, nil
+}
+
+func (m *MockPostStore) GetAuthorTimelineEntries(ctx context.Context, authorID int64, limit int) ([]TimelineEntry, error) {
+	return []TimelineEntry{}, nil
+}
+
+// MockFeedSignalsStore returns Signals, or no signals if it is nil.
+type MockFeedSignalsStore struct {
+	Signals *FeedSignals
+}
+
+func (m *MockFeedSignalsStore) Get(ctx context.Context, userID int64, since time.Time) (*FeedSignals, error) {
+	if m.Signals == nil {
+		return &FeedSignals{Authors: map[int64]AuthorSignals{}, Tags: map[string]int{}}, nil
+	}
+	return m.Signals, nil
+}
+
+// MockSearchStore returns a single result of the searched type.
+type MockSearchStore struct{}
+
+func (m *MockSearchStore) Posts(ctx context.Context, q SearchQuery) (*SearchPage, error) {
+	return &SearchPage{Results: []SearchResult{{Type: SearchTypePosts, ID: 1}}}, nil
+}
+
+func (m *MockSearchStore) Comments(ctx context.Context, q SearchQuery) (*SearchPage, error) {
+	return &SearchPage{Results: []SearchResult{{Type: SearchTypeComments, ID: 1}}}, nil
+}
+
+func (m *MockSearchStore) Users(ctx context.Context, q SearchQuery) (*SearchPage, error) {
+	return &SearchPage{Results: []SearchResult{{Type: SearchTypeUsers, ID: 1}}}, nil
+}
+
+// MockReactionStore reports every reaction as new and counts one like per post.
+type MockReactionStore struct{}
+
+func (m *MockReactionStore) Add(ctx context.Context, userID int64, target ReactionTarget, kind string) (bool, error) {
+	return true, nil
+}
+
+func (m *MockReactionStore) Remove(ctx context.Context, userID int64, target ReactionTarget, kind string) (bool, error) {
+	return true, nil
+}
+
+func (m *MockReactionStore) PostCounts(ctx context.Context, postIDs []int64) (map[int64]ReactionCounts, error) {
+	counts := make(map[int64]ReactionCounts, len(postIDs))
+	for _, id := range postIDs {
+		counts[id] = ReactionCounts{"like": 1}
+	}
+	return counts, nil
+}
+
+func (m *MockReactionStore) CommentCounts(ctx context.Context, commentIDs []int64) (map[int64]ReactionCounts, error) {
+	return m.PostCounts(ctx, commentIDs)
+}
+
+// MockCommentStore returns a single top-level comment with one reply. Comments
+// on post 1 are written by user 1, except comment 2 which is user 2's; other
+// posts have no comments.
+type MockCommentStore struct{}
+
+func (m *MockCommentStore) GetThread(ctx context.Context, postID int64, q CommentQuery) (*CommentPage, error) {
+	parentID := int64(1)
+	comment := Comment{ID: 1, PostID: postID, ReplyCount: 1}
+	if q.Depth > 1 {
+		comment.Replies = []Comment{{ID: 2, PostID: postID, ParentID: &parentID}}
+	}
+	return &CommentPage{Comments: []Comment{comment}}, nil
+}
+
+func (m *MockCommentStore) Create(ctx context.Context, comment *Comment) error {
+	if comment.ParentID != nil && *comment.ParentID != 1 {
+		return ErrParentNotFound
+	}
+	return nil
+}
+
+func (m *MockCommentStore) GetByID(ctx context.Context, id int64) (*Comment, error) {
+	userID := int64(1)
+	if id == 2 {
+		userID = 2
+	}
+	return &Comment{ID: id, PostID: 1, UserID: userID}, nil
+}
+
+func (m *MockCommentStore) Update(ctx context.Context, comment *Comment) error {
+	comment.Edited = true
+	comment.Version++
+	return nil
+}
+
+func (m *MockCommentStore) Delete(ctx context.Context, comment *Comment) error {
+	return nil
+}
+
+func (m *MockCommentStore) Restore(ctx context.Context, id int64) error {
+	return nil
+}
+
+func (m *MockCommentStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return 0, nil
+}
@@ -1,6 +1,8 @@
 package repo
 
 import (
+	"encoding/base64"
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -16,6 +18,71 @@ type PaginatedFeedQuery struct {
 	Search string   `json:"search" validate:"max=100"`
 	Since  string   `json:"since"`
 	Until  string   `json:"until"`
+	Mode   string   `json:"mode" validate:"oneof=chronological ranked"`
+
+	// Cursor switches from offset to keyset pagination; nil on the first page
+	Cursor *FeedCursor `json:"-"`
+}
+
+// FeedCursor points at the post a page of the feed starts after. Before
+// selects the page preceding the post instead.
+type FeedCursor struct {
+	CreatedAt time.Time
+	ID        int64
+	Before    bool
+}
+
+// FeedPage is a page of the feed together with the cursors of the adjacent
+// pages, which are empty if there is no such page.
+type FeedPage struct {
+	Posts      []PostWithMetadata
+	NextCursor string
+	PrevCursor string
+}
+
+// Feed modes: chronological orders the feed by creation time, ranked by the
+// score of each post for the reader.
+const (
+	FeedModeChronological = "chronological"
+	FeedModeRanked        = "ranked"
+)
+
+var errInvalidCursor = errors.New("invalid cursor parameter")
+
+// Encode returns the opaque form of the cursor handed to clients.
+func (c FeedCursor) Encode() string {
+	dir := "n"
+	if c.Before {
+		dir = "p"
+	}
+
+	raw := fmt.Sprintf("%s,%d,%s", c.CreatedAt.UTC().Format(time.RFC3339Nano), c.ID, dir)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeFeedCursor parses a cursor created by FeedCursor.Encode.
+func DecodeFeedCursor(s string) (*FeedCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), ",")
+	if len(parts) != 3 || (parts[2] != "n" && parts[2] != "p") {
+		return nil, errInvalidCursor
+	}
+
+	createdAt, err := time.Parse(time.RFC3339Nano, parts[0])
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &FeedCursor{CreatedAt: createdAt, ID: id, Before: parts[2] == "p"}, nil
 }
 
 // Parse extracts pagination parameters from HTTP request query string.
@@ -29,6 +96,8 @@ type PaginatedFeedQuery struct {
 //   - search: Search query string
 //   - since: Start date filter (RFC3339 format)
 //   - until: End date filter (RFC3339 format)
+//   - cursor: Opaque cursor of a previous response, takes precedence over offset
+//   - mode: Feed mode (chronological/ranked)
 //
 // Parameters:
 //   - r: HTTP request containing query parameters
@@ -57,11 +126,26 @@ func (fq PaginatedFeedQuery) Parse(r *http.Request) (PaginatedFeedQuery, error)
 		fq.Offset = offset
 	}
 
+	// Parse cursor parameter
+	if cursorStr := qs.Get("cursor"); cursorStr != "" {
+		cursor, err := DecodeFeedCursor(cursorStr)
+		if err != nil {
+			return fq, err
+		}
+		fq.Cursor = cursor
+		fq.Offset = 0
+	}
+
 	// Parse sort parameter
 	if sortStr := qs.Get("sort"); sortStr != "" {
 		fq.Sort = sortStr
 	}
 
+	// Parse mode parameter
+	if modeStr := qs.Get("mode"); modeStr != "" {
+		fq.Mode = modeStr
+	}
+
 	// Parse tags parameter
 	if tagsStr := qs.Get("tags"); tagsStr != "" {
 		tags := strings.Split(tagsStr, ",")
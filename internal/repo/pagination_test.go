@@ -0,0 +1,103 @@
+package repo
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestFeedCursor(t *testing.T) {
+	t.Run("should round trip", func(t *testing.T) {
+		want := FeedCursor{CreatedAt: time.Date(2024, 1, 15, 10, 30, 0, 0, time.UTC), ID: 42, Before: true}
+
+		got, err := DecodeFeedCursor(want.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.CreatedAt.Equal(want.CreatedAt) || got.ID != want.ID || got.Before != want.Before {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("should reject tampered cursors", func(t *testing.T) {
+		for _, cursor := range []string{"not base64!", "MjAyNC0wMS0xNQ", "eCwxLG4"} {
+			if _, err := DecodeFeedCursor(cursor); err == nil {
+				t.Errorf("cursor %q accepted", cursor)
+			}
+		}
+	})
+}
+
+func TestPaginatedFeedQueryParse(t *testing.T) {
+	cursor := FeedCursor{CreatedAt: time.Unix(1700000000, 0), ID: 7}
+
+	t.Run("should prefer the cursor over the offset", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/v1/users/feed?offset=40&cursor="+cursor.Encode(), nil)
+
+		fq, err := PaginatedFeedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fq.Cursor == nil || fq.Cursor.ID != 7 || fq.Offset != 0 {
+			t.Errorf("got cursor %+v and offset %d", fq.Cursor, fq.Offset)
+		}
+	})
+
+	t.Run("should keep offset mode without a cursor", func(t *testing.T) {
+		r := httptest.NewRequest("GET", "/v1/users/feed?offset=40", nil)
+
+		fq, err := PaginatedFeedQuery{Limit: 20, Sort: "desc"}.Parse(r)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fq.Cursor != nil || fq.Offset != 40 {
+			t.Errorf("got cursor %+v and offset %d", fq.Cursor, fq.Offset)
+		}
+	})
+}
+
+func TestNewFeedPage(t *testing.T) {
+	feed := []PostWithMetadata{
+		{Post: Post{ID: 3, CreatedAt: "2024-01-15T10:32:00Z"}},
+		{Post: Post{ID: 2, CreatedAt: "2024-01-15T10:31:00Z"}},
+	}
+
+	tests := []struct {
+		name     string
+		fq       PaginatedFeedQuery
+		hasMore  bool
+		wantNext bool
+		wantPrev bool
+	}{
+		{"first page", PaginatedFeedQuery{}, true, true, false},
+		{"last page", PaginatedFeedQuery{}, false, false, false},
+		{"offset page", PaginatedFeedQuery{Offset: 2}, true, true, true},
+		{"next cursor page", PaginatedFeedQuery{Cursor: &FeedCursor{ID: 4}}, false, false, true},
+		{"prev cursor page", PaginatedFeedQuery{Cursor: &FeedCursor{ID: 1, Before: true}}, false, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := NewFeedPage(feed, tt.fq, tt.hasMore)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if (page.NextCursor != "") != tt.wantNext || (page.PrevCursor != "") != tt.wantPrev {
+				t.Errorf("next = %q, prev = %q", page.NextCursor, page.PrevCursor)
+			}
+		})
+	}
+
+	t.Run("should point the cursors at the edges of the page", func(t *testing.T) {
+		page, err := NewFeedPage(feed, PaginatedFeedQuery{Offset: 2}, true)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		next, _ := DecodeFeedCursor(page.NextCursor)
+		prev, _ := DecodeFeedCursor(page.PrevCursor)
+		if next.ID != 2 || next.Before || prev.ID != 3 || !prev.Before {
+			t.Errorf("next = %+v, prev = %+v", next, prev)
+		}
+	})
+}
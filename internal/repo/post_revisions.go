@@ -0,0 +1,118 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// PostRevision is a version of a post
+//
+//	@Description	Title, content and tags of a post as of a version
+type PostRevision struct {
+	// Version of the post, 0 is the version it was created with
+	//	@example	2
+	Version int32 `json:"version" example:"2"`
+
+	Title   string   `json:"title" example:"My First Blog Post"`
+	Content string   `json:"content" example:"This is the content of my first blog post..."`
+	Tags    []string `json:"tags" example:"golang,programming"`
+
+	// Timestamp when the version was written
+	//	@example	2024-01-15T14:30:00Z
+	CreatedAt string `json:"created_at" example:"2024-01-15T14:30:00Z"`
+
+	// Whether this is the version the post has now
+	Current bool `json:"current" example:"false"`
+}
+
+// revisionsQuery selects the versions of post $1, the archived ones together
+// with the current one.
+const revisionsQuery = `
+	SELECT version, title, content, tags, created_at, false
+	FROM post_revisions
+	WHERE post_id = $1 AND EXISTS (SELECT 1 FROM posts WHERE id = $1 AND deleted_at IS NULL)
+	UNION ALL
+	SELECT version, title, content, tags, updated_at, true
+	FROM posts
+	WHERE id = $1 AND deleted_at IS NULL
+`
+
+// GetRevisions returns every version of a post, newest first.
+func (postStore *PostStore) GetRevisions(ctx context.Context, postID int64) ([]PostRevision, error) {
+	query := `SELECT * FROM (` + revisionsQuery + `) r ORDER BY version DESC`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := postStore.db.QueryContext(ctx, query, postID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get revisions: %w", err)
+	}
+	defer rows.Close()
+
+	revisions := []PostRevision{}
+	for rows.Next() {
+		var rev PostRevision
+		err := rows.Scan(&rev.Version, &rev.Title, &rev.Content, pq.Array(&rev.Tags), &rev.CreatedAt, &rev.Current)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+
+	return revisions, rows.Err()
+}
+
+// GetRevision returns a version of a post, or ErrNotFound if there is no
+// such version.
+func (postStore *PostStore) GetRevision(ctx context.Context, postID int64, version int32) (*PostRevision, error) {
+	query := `SELECT * FROM (` + revisionsQuery + `) r WHERE version = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var rev PostRevision
+	err := postStore.db.QueryRowContext(ctx, query, postID, version).Scan(
+		&rev.Version, &rev.Title, &rev.Content, pq.Array(&rev.Tags), &rev.CreatedAt, &rev.Current,
+	)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, fmt.Errorf("%w: version %d of post %d", ErrNotFound, version, postID)
+		}
+		return nil, fmt.Errorf("failed to get revision: %w", err)
+	}
+
+	return &rev, nil
+}
+
+// archiveRevision copies the current version of a post into post_revisions
+// and locks the post until tx ends. Returns ErrNotFound if the post is
+// deleted, and ErrEditConflict if it is not at version anymore.
+func (postStore *PostStore) archiveRevision(ctx context.Context, tx *sql.Tx, postID int64, version int32) error {
+	query := `
+		INSERT INTO post_revisions (post_id, version, title, content, tags, created_at)
+		SELECT id, version, title, content, tags, updated_at
+		FROM posts
+		WHERE id = $1 AND version = $2 AND deleted_at IS NULL
+		FOR UPDATE
+	`
+
+	result, err := tx.ExecContext(ctx, query, postID, version)
+	if err != nil {
+		return fmt.Errorf("failed to archive revision: %w", err)
+	}
+
+	archived, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+	if archived == 0 {
+		return missingOrConflict(ctx, tx, "post", postID)
+	}
+
+	return nil
+}
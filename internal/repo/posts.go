@@ -7,6 +7,8 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
+	"slices"
+	"time"
 
 	"github.com/lib/pq"
 )
@@ -41,9 +43,17 @@ type Post struct {
 	//	@example	1
 	UserID int64 `json:"user_id" example:"1"`
 
-	// List of comments on this post
+	// Newest top-level comments on this post
 	Comments []Comment `json:"comments"`
 
+	// Cursor of the next page of GET /v1/posts/{postID}/comments, omitted if all
+	// top-level comments are embedded
+	CommentsNextCursor string `json:"comments_next_cursor,omitempty"`
+
+	// Number of reactions per kind
+	//	@example	{"like":3,"love":1}
+	Reactions ReactionCounts `json:"reactions"`
+
 	// Timestamp when the post was created
 	//	@example	2024-01-15T10:30:00Z
 	CreatedAt string `json:"created_at" example:"2024-01-15T10:30:00Z"`
@@ -168,7 +178,8 @@ func (postStore *PostStore) GetByID(ctx context.Context, id int64) (*Post, error
 	query := `
 		SELECT id, content, title, user_id, tags, created_at, updated_at, version
 		FROM posts
-		WHERE id = $1
+		WHERE id = $1 AND deleted_at IS NULL
+		  AND EXISTS (SELECT 1 FROM users WHERE users.id = posts.user_id AND users.deleted_at IS NULL)
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
@@ -196,6 +207,9 @@ func (postStore *PostStore) GetByID(ctx context.Context, id int64) (*Post, error
 	return &post, nil
 }
 
+// Update writes the title, content and tags of a post, provided it is still at
+// post.Version, and archives the version it replaces. Returns ErrEditConflict
+// if the post was changed since it was read.
 func (postStore *PostStore) Update(ctx context.Context, post *Post) error {
 	if post == nil {
 		return fmt.Errorf("%w: post cannot be nil", ErrInvalidPostData)
@@ -210,42 +224,47 @@ func (postStore *PostStore) Update(ctx context.Context, post *Post) error {
 	query := `
 		UPDATE posts
 		SET title = $1, content = $2, tags = $3, updated_at = NOW(), version = version + 1
-		WHERE id = $4 AND version = $5
-		RETURNING version
+		WHERE id = $4
+		RETURNING version, updated_at
 	`
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	err := postStore.db.QueryRowContext(
-		ctx,
-		query,
-		post.Title,
-		post.Content,
-		pq.Array(post.Tags),
-		post.ID,
-		post.Version,
-	).Scan(&post.Version)
+	// the version being replaced is kept as a revision
+	return withTx(postStore.db, ctx, func(tx *sql.Tx) error {
+		if err := postStore.archiveRevision(ctx, tx, post.ID, post.Version); err != nil {
+			return err
+		}
 
-	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return fmt.Errorf("%w: post may not exist or version conflict", ErrNotFound)
+		err := tx.QueryRowContext(
+			ctx,
+			query,
+			post.Title,
+			post.Content,
+			pq.Array(post.Tags),
+			post.ID,
+		).Scan(&post.Version, &post.UpdatedAt)
+		if err != nil {
+			return fmt.Errorf("failed to update post: %w", err)
 		}
-		return fmt.Errorf("failed to update post: %w", err)
-	}
-	return nil
+		return nil
+	})
 }
 
-func (postStore *PostStore) Delete(ctx context.Context, id int64) error {
-	if id <= 0 {
+// Delete soft deletes a post, which hides it from every read until it is
+// restored or purged. Returns ErrEditConflict if the post was changed since
+// it was read.
+func (postStore *PostStore) Delete(ctx context.Context, post *Post) error {
+	if post == nil || post.ID <= 0 {
 		return fmt.Errorf("%w: invalid post ID", ErrInvalidPostData)
 	}
 
-	query := `DELETE FROM posts WHERE id = $1`
+	query := `UPDATE posts SET deleted_at = NOW() WHERE id = $1 AND version = $2 AND deleted_at IS NULL`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
 	defer cancel()
 
-	result, err := postStore.db.ExecContext(ctx, query, id)
+	result, err := postStore.db.ExecContext(ctx, query, post.ID, post.Version)
 	if err != nil {
 		return fmt.Errorf("failed to delete post: %w", err)
 	}
@@ -256,28 +275,71 @@ func (postStore *PostStore) Delete(ctx context.Context, id int64) error {
 	}
 
 	if rowsAffected == 0 {
-		return fmt.Errorf("%w: post with ID %d", ErrNotFound, id)
+		return missingOrConflict(ctx, postStore.db, "post", post.ID)
 	}
 
 	return nil
 }
 
-func (postStore *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error) {
+// missingOrConflict tells why a write to the post or comment id conditioned on
+// its version matched no row: ErrEditConflict if it is still there,
+// ErrNotFound otherwise.
+func missingOrConflict(ctx context.Context, q queryRower, kind string, id int64) error {
+	query := `SELECT EXISTS (SELECT 1 FROM ` + kind + `s WHERE id = $1 AND deleted_at IS NULL)`
+
+	var exists bool
+	if err := q.QueryRowContext(ctx, query, id).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check %s: %w", kind, err)
+	}
+	if exists {
+		return fmt.Errorf("%w: %s with ID %d", ErrEditConflict, kind, id)
+	}
+	return fmt.Errorf("%w: %s with ID %d", ErrNotFound, kind, id)
+}
+
+// queryRower is implemented by *sql.DB and *sql.Tx.
+type queryRower interface {
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// GetUserFeed returns a page of the feed of a user. Pages are selected with
+// fq.Cursor if set, which keeps pages stable while new posts arrive, and with
+// fq.Offset otherwise.
+func (postStore *PostStore) GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) (*FeedPage, error) {
+	// prev pages are read backwards from the cursor and reversed afterwards
+	backwards := fq.Cursor != nil && fq.Cursor.Before
+
+	order := fq.Sort
+	if backwards {
+		order = reverseSort(fq.Sort)
+	}
+
+	keyset := ""
+	args := []any{userID, fq.Limit + 1, fq.Offset, fq.Search, pq.Array(fq.Tags)}
+	if fq.Cursor != nil {
+		op := "<"
+		if order == "asc" {
+			op = ">"
+		}
+		keyset = ` AND (p.created_at, p.id) ` + op + ` ($6, $7)`
+		args = append(args, fq.Cursor.CreatedAt, fq.Cursor.ID)
+	}
+
 	query := `
 		SELECT 
 			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
 			u.username,
 			COUNT(c.id) AS comments_count
 		FROM posts p
-		LEFT JOIN comments c ON c.post_id = p.id
-		LEFT JOIN users u ON p.user_id = u.id
-		JOIN followers f ON f.follower_id = p.user_id OR p.user_id = $1
+		LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL
+		JOIN users u ON p.user_id = u.id
 		WHERE 
-			f.user_id = $1 AND
+			p.deleted_at IS NULL AND u.deleted_at IS NULL AND
+			(p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1)) AND
 			(p.title ILIKE '%' || $4 || '%' OR p.content ILIKE '%' || $4 || '%') AND
-			(p.tags @> $5 OR $5 = '{}')
+			(p.tags @> $5 OR $5 = '{}')` + keyset + `
 		GROUP BY p.id, u.username, p.created_at
-		ORDER BY p.created_at ` + fq.Sort + `
+		ORDER BY p.created_at ` + order + `, p.id ` + order + `
 		LIMIT $2 OFFSET $3
 	`
 
@@ -285,14 +347,14 @@ func (postStore *PostStore) GetUserFeed(ctx context.Context, userID int64, fq Pa
 
 	defer cancel()
 
-	rows, err := postStore.db.QueryContext(ctx, query, userID, fq.Limit, fq.Offset, fq.Search, pq.Array(fq.Tags))
+	rows, err := postStore.db.QueryContext(ctx, query, args...)
 	if err != nil {
 		return nil, err
 	}
 
 	defer rows.Close()
 
-	var feed []PostWithMetadata
+	feed := []PostWithMetadata{}
 	for rows.Next() {
 		var p PostWithMetadata
 		err := rows.Scan(
@@ -311,5 +373,189 @@ func (postStore *PostStore) GetUserFeed(ctx context.Context, userID int64, fq Pa
 		}
 		feed = append(feed, p)
 	}
-	return feed, nil
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	// the extra row only tells whether there is another page in reading direction
+	hasMore := len(feed) > fq.Limit
+	if hasMore {
+		feed = feed[:fq.Limit]
+	}
+	if backwards {
+		slices.Reverse(feed)
+	}
+
+	return NewFeedPage(feed, fq, hasMore)
+}
+
+// NewFeedPage sets the cursors of the pages next to feed. hasMore tells
+// whether there are more posts past feed in the reading direction of fq.
+func NewFeedPage(feed []PostWithMetadata, fq PaginatedFeedQuery, hasMore bool) (*FeedPage, error) {
+	page := &FeedPage{Posts: feed}
+	if len(feed) == 0 {
+		return page, nil
+	}
+
+	hasNext, hasPrev := hasMore, fq.Offset > 0
+	if fq.Cursor != nil {
+		// we got here from the page on the other side of the cursor
+		hasNext, hasPrev = true, true
+		if fq.Cursor.Before {
+			hasPrev = hasMore
+		} else {
+			hasNext = hasMore
+		}
+	}
+
+	if hasNext {
+		cursor, err := feedCursorOf(feed[len(feed)-1], false)
+		if err != nil {
+			return nil, err
+		}
+		page.NextCursor = cursor.Encode()
+	}
+	if hasPrev {
+		cursor, err := feedCursorOf(feed[0], true)
+		if err != nil {
+			return nil, err
+		}
+		page.PrevCursor = cursor.Encode()
+	}
+
+	return page, nil
+}
+
+func feedCursorOf(p PostWithMetadata, before bool) (FeedCursor, error) {
+	createdAt, err := time.Parse(time.RFC3339Nano, p.CreatedAt)
+	if err != nil {
+		return FeedCursor{}, fmt.Errorf("failed to build feed cursor: %w", err)
+	}
+
+	return FeedCursor{CreatedAt: createdAt, ID: p.ID, Before: before}, nil
+}
+
+func reverseSort(sort string) string {
+	if sort == "asc" {
+		return "desc"
+	}
+	return "asc"
+}
+
+// TimelineEntry is a post as kept in the cached timelines of the feed.
+type TimelineEntry struct {
+	PostID    int64
+	CreatedAt time.Time
+}
+
+// GetByIDs returns the posts with the given IDs in the same order and with the
+// metadata of the feed. IDs of posts that do not exist are skipped.
+func (postStore *PostStore) GetByIDs(ctx context.Context, ids []int64) ([]PostWithMetadata, error) {
+	if len(ids) == 0 {
+		return []PostWithMetadata{}, nil
+	}
+
+	query := `
+		SELECT 
+			p.id, p.user_id, p.title, p.content, p.created_at, p.version, p.tags,
+			u.username,
+			COUNT(c.id) AS comments_count
+		FROM posts p
+		LEFT JOIN comments c ON c.post_id = p.id AND c.deleted_at IS NULL
+		JOIN users u ON p.user_id = u.id
+		WHERE p.id = ANY($1) AND p.deleted_at IS NULL AND u.deleted_at IS NULL
+		GROUP BY p.id, u.username
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := postStore.db.QueryContext(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	byID := make(map[int64]PostWithMetadata, len(ids))
+	for rows.Next() {
+		var p PostWithMetadata
+		err := rows.Scan(
+			&p.ID,
+			&p.UserID,
+			&p.Title,
+			&p.Content,
+			&p.CreatedAt,
+			&p.Version,
+			pq.Array(&p.Tags),
+			&p.User.Username,
+			&p.CommentsCount,
+		)
+		if err != nil {
+			return nil, err
+		}
+		byID[p.ID] = p
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	posts := make([]PostWithMetadata, 0, len(byID))
+	for _, id := range ids {
+		if p, ok := byID[id]; ok {
+			posts = append(posts, p)
+		}
+	}
+
+	return posts, nil
+}
+
+// GetTimelineEntries returns the newest posts of the feed of a user, i.e. of
+// the user and of the users they follow, newest first.
+func (postStore *PostStore) GetTimelineEntries(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error) {
+	query := `
+		SELECT p.id, p.created_at
+		FROM posts p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.deleted_at IS NULL AND u.deleted_at IS NULL
+		  AND (p.user_id = $1 OR p.user_id IN (SELECT user_id FROM followers WHERE follower_id = $1))
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $2
+	`
+
+	return postStore.queryTimelineEntries(ctx, query, userID, limit)
+}
+
+// GetAuthorTimelineEntries returns the newest posts written by a user, newest first.
+func (postStore *PostStore) GetAuthorTimelineEntries(ctx context.Context, authorID int64, limit int) ([]TimelineEntry, error) {
+	query := `
+		SELECT p.id, p.created_at
+		FROM posts p
+		WHERE p.user_id = $1 AND p.deleted_at IS NULL
+		ORDER BY p.created_at DESC, p.id DESC
+		LIMIT $2
+	`
+
+	return postStore.queryTimelineEntries(ctx, query, authorID, limit)
+}
+
+func (postStore *PostStore) queryTimelineEntries(ctx context.Context, query string, args ...any) ([]TimelineEntry, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := postStore.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var entries []TimelineEntry
+	for rows.Next() {
+		var e TimelineEntry
+		if err := rows.Scan(&e.PostID, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+
+	return entries, rows.Err()
 }
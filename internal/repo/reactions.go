@@ -0,0 +1,173 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+
+	"github.com/lib/pq"
+)
+
+// ReactionKinds are the reactions users can leave on posts and comments.
+var ReactionKinds = []string{"like", "love", "laugh", "insightful", "sad"}
+
+// ReactionCounts maps reaction kinds to how many users reacted with them.
+// Kinds nobody reacted with are left out.
+type ReactionCounts map[string]int
+
+// ReactionTarget is the post, or the comment on the post, a reaction is left on.
+type ReactionTarget struct {
+	PostID int64
+	// CommentID is 0 for reactions on the post itself
+	CommentID int64
+}
+
+type ReactionStore struct {
+	db *sql.DB
+}
+
+// Add records the reaction of a user. Reacting twice with the same kind has no
+// effect; the returned bool reports whether the reaction was new. Returns
+// ErrNotFound if the comment does not belong to the post.
+func (s *ReactionStore) Add(ctx context.Context, userID int64, target ReactionTarget, kind string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if target.CommentID == 0 {
+		query := `
+			INSERT INTO reactions (user_id, post_id, kind) VALUES ($1, $2, $3)
+			ON CONFLICT (post_id, user_id, kind) WHERE post_id IS NOT NULL DO NOTHING
+		`
+		result, err = s.db.ExecContext(ctx, query, userID, target.PostID, kind)
+	} else {
+		if err := s.checkComment(ctx, target); err != nil {
+			return false, err
+		}
+
+		query := `
+			INSERT INTO reactions (user_id, comment_id, kind) VALUES ($1, $2, $3)
+			ON CONFLICT (comment_id, user_id, kind) WHERE comment_id IS NOT NULL DO NOTHING
+		`
+		result, err = s.db.ExecContext(ctx, query, userID, target.CommentID, kind)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to add reaction: %w", err)
+	}
+
+	added, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return added > 0, nil
+}
+
+// Remove withdraws the reaction of a user. The returned bool reports whether
+// there was such a reaction.
+func (s *ReactionStore) Remove(ctx context.Context, userID int64, target ReactionTarget, kind string) (bool, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var (
+		result sql.Result
+		err    error
+	)
+	if target.CommentID == 0 {
+		query := `DELETE FROM reactions WHERE user_id = $1 AND post_id = $2 AND kind = $3`
+		result, err = s.db.ExecContext(ctx, query, userID, target.PostID, kind)
+	} else {
+		query := `
+			DELETE FROM reactions r USING comments c
+			WHERE r.comment_id = c.id AND r.user_id = $1 AND r.comment_id = $2 AND r.kind = $3 AND c.post_id = $4
+		`
+		result, err = s.db.ExecContext(ctx, query, userID, target.CommentID, kind, target.PostID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	return removed > 0, nil
+}
+
+// PostCounts aggregates the reactions on each of the given posts. Posts
+// without reactions get empty counts.
+func (s *ReactionStore) PostCounts(ctx context.Context, postIDs []int64) (map[int64]ReactionCounts, error) {
+	return s.counts(ctx, "post_id", postIDs)
+}
+
+// CommentCounts aggregates the reactions on each of the given comments.
+// Comments without reactions get empty counts.
+func (s *ReactionStore) CommentCounts(ctx context.Context, commentIDs []int64) (map[int64]ReactionCounts, error) {
+	return s.counts(ctx, "comment_id", commentIDs)
+}
+
+// counts aggregates the reactions whose column, post_id or comment_id, is one
+// of ids.
+func (s *ReactionStore) counts(ctx context.Context, column string, ids []int64) (map[int64]ReactionCounts, error) {
+	query := `SELECT ` + column + `, kind, COUNT(*) FROM reactions WHERE ` + column + ` = ANY($1) GROUP BY ` + column + `, kind`
+
+	counts, err := s.queryCounts(ctx, query, pq.Array(ids))
+	if err != nil {
+		return nil, err
+	}
+
+	for _, id := range ids {
+		if _, ok := counts[id]; !ok {
+			counts[id] = ReactionCounts{}
+		}
+	}
+
+	return counts, nil
+}
+
+func (s *ReactionStore) queryCounts(ctx context.Context, query string, args ...any) (map[int64]ReactionCounts, error) {
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	defer rows.Close()
+
+	counts := make(map[int64]ReactionCounts)
+	for rows.Next() {
+		var (
+			id    int64
+			kind  string
+			count int
+		)
+		if err := rows.Scan(&id, &kind, &count); err != nil {
+			return nil, err
+		}
+		if counts[id] == nil {
+			counts[id] = ReactionCounts{}
+		}
+		counts[id][kind] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (s *ReactionStore) checkComment(ctx context.Context, target ReactionTarget) error {
+	query := `SELECT EXISTS (SELECT 1 FROM comments c WHERE c.id = $1 AND c.post_id = $2 AND ` + visibleComment("c.id") + `)`
+
+	var exists bool
+	if err := s.db.QueryRowContext(ctx, query, target.CommentID, target.PostID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return fmt.Errorf("%w: comment %d on post %d", ErrNotFound, target.CommentID, target.PostID)
+	}
+
+	return nil
+}
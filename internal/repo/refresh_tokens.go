@@ -0,0 +1,185 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var (
+	ErrRefreshTokenReused = errors.New("refresh token has already been used")
+)
+
+// RefreshToken is a persisted, single-use refresh token. Tokens issued by
+// rotating one another share a FamilyID so that the whole chain can be revoked
+// when reuse of an already-rotated token is detected.
+type RefreshToken struct {
+	ID int64 `json:"-"`
+
+	// Token is the SHA-256 hash of the opaque token handed to the client
+	Token string `json:"-"`
+
+	UserID    int64     `json:"-"`
+	FamilyID  string    `json:"-"`
+	Expiry    time.Time `json:"-"`
+	CreatedAt time.Time `json:"-"`
+}
+
+type RefreshTokenStore struct {
+	db *sql.DB
+}
+
+// Create persists a refresh token that starts a new token family.
+func (s *RefreshTokenStore) Create(ctx context.Context, token *RefreshToken) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		return s.create(ctx, tx, token)
+	})
+}
+
+// Rotate exchanges the refresh token identified by hashToken for next.
+//
+// The presented token is marked as rotated and next is inserted into the same
+// family, inheriting its user. If the presented token was already rotated or
+// revoked, the whole family is revoked and ErrRefreshTokenReused is returned.
+// Unknown or expired tokens yield ErrNotFound.
+func (s *RefreshTokenStore) Rotate(ctx context.Context, hashToken string, next *RefreshToken) error {
+	reused := false
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		current, rotated, err := s.getForUpdate(ctx, tx, hashToken)
+		if err != nil {
+			return err
+		}
+
+		if rotated {
+			reused = true
+			return s.revokeFamily(ctx, tx, current.FamilyID)
+		}
+
+		if time.Now().After(current.Expiry) {
+			return ErrNotFound
+		}
+
+		if err := s.markRotated(ctx, tx, current.ID); err != nil {
+			return err
+		}
+
+		next.UserID = current.UserID
+		next.FamilyID = current.FamilyID
+
+		return s.create(ctx, tx, next)
+	})
+	if err != nil {
+		return err
+	}
+
+	if reused {
+		return ErrRefreshTokenReused
+	}
+
+	return nil
+}
+
+// RevokeFamily revokes the token identified by hashToken together with every
+// other token of its family.
+func (s *RefreshTokenStore) RevokeFamily(ctx context.Context, hashToken string) error {
+	query := `
+		UPDATE refresh_tokens SET revoked_at = NOW()
+		WHERE family_id = (SELECT family_id FROM refresh_tokens WHERE token = $1) AND revoked_at IS NULL
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, hashToken)
+	return err
+}
+
+// RevokeAllForUser revokes every outstanding refresh token of a user.
+func (s *RefreshTokenStore) RevokeAllForUser(ctx context.Context, userID int64) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE user_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := s.db.ExecContext(ctx, query, userID)
+	return err
+}
+
+func (s *RefreshTokenStore) getForUpdate(ctx context.Context, tx *sql.Tx, hashToken string) (*RefreshToken, bool, error) {
+	query := `
+		SELECT id, user_id, family_id, expiry, created_at,
+		       rotated_at IS NOT NULL OR revoked_at IS NOT NULL
+		FROM refresh_tokens
+		WHERE token = $1
+		FOR UPDATE
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	token := &RefreshToken{Token: hashToken}
+	var rotated bool
+	err := tx.QueryRowContext(ctx, query, hashToken).Scan(
+		&token.ID,
+		&token.UserID,
+		&token.FamilyID,
+		&token.Expiry,
+		&token.CreatedAt,
+		&rotated,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, false, ErrNotFound
+		default:
+			return nil, false, err
+		}
+	}
+
+	return token, rotated, nil
+}
+
+func (s *RefreshTokenStore) create(ctx context.Context, tx *sql.Tx, token *RefreshToken) error {
+	query := `
+		INSERT INTO refresh_tokens (token, user_id, family_id, expiry)
+		VALUES ($1, $2, $3, $4)
+		RETURNING id, created_at
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	return tx.QueryRowContext(
+		ctx,
+		query,
+		token.Token,
+		token.UserID,
+		token.FamilyID,
+		token.Expiry,
+	).Scan(
+		&token.ID,
+		&token.CreatedAt,
+	)
+}
+
+func (s *RefreshTokenStore) markRotated(ctx context.Context, tx *sql.Tx, id int64) error {
+	query := `UPDATE refresh_tokens SET rotated_at = NOW() WHERE id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, id)
+	return err
+}
+
+func (s *RefreshTokenStore) revokeFamily(ctx context.Context, tx *sql.Tx, familyID string) error {
+	query := `UPDATE refresh_tokens SET revoked_at = NOW() WHERE family_id = $1 AND revoked_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, familyID)
+	return err
+}
@@ -25,9 +25,16 @@ var (
 type PostsRepository interface {
 	Create(ctx context.Context, post *Post) error
 	GetByID(ctx context.Context, id int64) (*Post, error)
-	Delete(ctx context.Context, id int64) error
+	Delete(ctx context.Context, post *Post) error
 	Update(ctx context.Context, post *Post) error
-	GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) ([]PostWithMetadata, error)
+	GetUserFeed(ctx context.Context, userID int64, fq PaginatedFeedQuery) (*FeedPage, error)
+	GetByIDs(ctx context.Context, ids []int64) ([]PostWithMetadata, error)
+	GetTimelineEntries(ctx context.Context, userID int64, limit int) ([]TimelineEntry, error)
+	GetAuthorTimelineEntries(ctx context.Context, authorID int64, limit int) ([]TimelineEntry, error)
+	Restore(ctx context.Context, id int64) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
+	GetRevisions(ctx context.Context, postID int64) ([]PostRevision, error)
+	GetRevision(ctx context.Context, postID int64, version int32) (*PostRevision, error)
 }
 
 type UsersRepository interface {
@@ -35,22 +42,101 @@ type UsersRepository interface {
 	GetByID(ctx context.Context, id int64) (*User, error)
 	CreateAndInvite(ctx context.Context, user *User, token string, invitationExp time.Duration) error
 	Activate(ctx context.Context, token string) error
+	RotateInvitation(ctx context.Context, email string, token string, invitationExp time.Duration) (*User, error)
+	DeleteExpiredInvitations(ctx context.Context) (int64, error)
+	DeleteUnactivated(ctx context.Context, maxAge time.Duration) (int64, error)
 	Delete(ctx context.Context, id int64) error
+	Purge(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 	GetByEmail(ctx context.Context, email string) (*User, error)
+	CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error
+	ResetPassword(ctx context.Context, token string, newPassword string) (int64, error)
 }
 
 type CommentsRepository interface {
-	GetByPostID(ctx context.Context, postID int64) ([]Comment, error)
+	GetThread(ctx context.Context, postID int64, q CommentQuery) (*CommentPage, error)
+	GetByID(ctx context.Context, id int64) (*Comment, error)
 	Create(ctx context.Context, comment *Comment) error
+	Update(ctx context.Context, comment *Comment) error
+	Delete(ctx context.Context, comment *Comment) error
+	Restore(ctx context.Context, id int64) error
+	PurgeDeleted(ctx context.Context, before time.Time) (int64, error)
 }
 
 type FollowersRepository interface {
 	Follow(ctx context.Context, userID, followerID int64) error
 	Unfollow(ctx context.Context, userID, followerID int64) error
+	GetFollowerIDs(ctx context.Context, userID int64) ([]int64, error)
 }
 
 type RoleRepository interface {
 	GetByName(ctx context.Context, slug string) (*Role, error)
+	List(ctx context.Context) ([]Role, error)
+	ListPermissions(ctx context.Context) ([]Permission, error)
+	GrantPermission(ctx context.Context, roleID int64, permission string) error
+	RevokePermission(ctx context.Context, roleID int64, permission string) error
+	SetRequireMFA(ctx context.Context, roleID int64, require bool) (int, error)
+	GetUserIDs(ctx context.Context, roleID int64) ([]int64, error)
+}
+
+type RefreshTokensRepository interface {
+	Create(ctx context.Context, token *RefreshToken) error
+	Rotate(ctx context.Context, hashToken string, next *RefreshToken) error
+	RevokeFamily(ctx context.Context, hashToken string) error
+	RevokeAllForUser(ctx context.Context, userID int64) error
+}
+
+// RevokedTokensRepository tracks access tokens that must be rejected before
+// their exp claim, either one by one (logout) or per user (logout everywhere).
+type RevokedTokensRepository interface {
+	Revoke(ctx context.Context, jti string, exp time.Time) error
+	RevokeAllForUser(ctx context.Context, userID int64, exp time.Time) error
+	IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error)
+	List(ctx context.Context) ([]Revocation, error)
+}
+
+// MFARepository stores the TOTP secrets and recovery codes of users.
+type MFARepository interface {
+	Get(ctx context.Context, userID int64) (*MFASettings, error)
+	SetSecret(ctx context.Context, userID int64, secret string) error
+	Enable(ctx context.Context, userID int64, recoveryCodes []string) error
+	UseTOTPStep(ctx context.Context, userID int64, step int64) error
+	UseRecoveryCode(ctx context.Context, userID int64, code string) error
+	Disable(ctx context.Context, userID int64) error
+}
+
+// APIKeysRepository stores the hashed API keys users create for machine clients.
+type APIKeysRepository interface {
+	Create(ctx context.Context, key *APIKey) error
+	GetByUserID(ctx context.Context, userID int64) ([]APIKey, error)
+	Authenticate(ctx context.Context, hashKey string) (*APIKey, error)
+	Revoke(ctx context.Context, userID, keyID int64) error
+}
+
+// IdentitiesRepository links accounts at external identity providers to users.
+type IdentitiesRepository interface {
+	GetUserID(ctx context.Context, provider, subject string) (int64, error)
+	Link(ctx context.Context, identity *Identity) error
+	CreateUser(ctx context.Context, user *User, identity *Identity) error
+}
+
+type ReactionsRepository interface {
+	Add(ctx context.Context, userID int64, target ReactionTarget, kind string) (bool, error)
+	Remove(ctx context.Context, userID int64, target ReactionTarget, kind string) (bool, error)
+	PostCounts(ctx context.Context, postIDs []int64) (map[int64]ReactionCounts, error)
+	CommentCounts(ctx context.Context, commentIDs []int64) (map[int64]ReactionCounts, error)
+}
+
+// SearchRepository runs full-text searches, one method per result type.
+type SearchRepository interface {
+	Posts(ctx context.Context, q SearchQuery) (*SearchPage, error)
+	Comments(ctx context.Context, q SearchQuery) (*SearchPage, error)
+	Users(ctx context.Context, q SearchQuery) (*SearchPage, error)
+}
+
+type FeedSignalsRepository interface {
+	Get(ctx context.Context, userID int64, since time.Time) (*FeedSignals, error)
 }
 
 // Repository aggregates all repository interfaces into a single structure.
@@ -63,11 +149,19 @@ type RoleRepository interface {
 //	post, err := repo.Posts.GetByID(ctx, 123)
 //	user, err := repo.Users.GetByEmail(ctx, "user@example.com")
 type Repository struct {
-	Posts     PostsRepository
-	Users     UsersRepository
-	Comments  CommentsRepository
-	Followers FollowersRepository
-	Roles     RoleRepository
+	Posts         PostsRepository
+	Users         UsersRepository
+	Comments      CommentsRepository
+	Followers     FollowersRepository
+	Roles         RoleRepository
+	RefreshTokens RefreshTokensRepository
+	RevokedTokens RevokedTokensRepository
+	MFA           MFARepository
+	APIKeys       APIKeysRepository
+	Identities    IdentitiesRepository
+	FeedSignals   FeedSignalsRepository
+	Search        SearchRepository
+	Reactions     ReactionsRepository
 }
 
 // NewRepository creates a new Repository instance with PostgreSQL implementations.
@@ -97,11 +191,19 @@ func NewPostgresRepo(db *sql.DB) (*Repository, error) {
 	}
 
 	return &Repository{
-		Posts:     &PostStore{db},
-		Users:     &UserStore{db},
-		Comments:  &CommentRepo{db},
-		Followers: &FollowerRepo{db},
-		Roles:     &RoleRepo{db},
+		Posts:         &PostStore{db},
+		Users:         &UserStore{db},
+		Comments:      &CommentRepo{db},
+		Followers:     &FollowerRepo{db},
+		Roles:         &RoleRepo{db},
+		RefreshTokens: &RefreshTokenStore{db},
+		RevokedTokens: &RevocationStore{db},
+		MFA:           &MFAStore{db},
+		APIKeys:       &APIKeyStore{db},
+		Identities:    &IdentityStore{db},
+		FeedSignals:   &FeedSignalsStore{db},
+		Search:        &SearchStore{db},
+		Reactions:     &ReactionStore{db},
 	}, nil
 
 }
@@ -135,7 +237,10 @@ func withTx(db *sql.DB, ctx context.Context, fn func(tx *sql.Tx) error) (err err
 		return err
 	}
 	if err := fn(tx); err != nil {
-		return tx.Rollback()
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return errors.Join(err, rbErr)
+		}
+		return err
 	}
 	return tx.Commit()
 }
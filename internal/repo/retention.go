@@ -0,0 +1,117 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// restore undoes the soft deletion of the row with the given ID. Returns
+// ErrNotFound if there is no such deleted row.
+func restore(ctx context.Context, db *sql.DB, table string, id int64) error {
+	query := `UPDATE ` + table + ` SET deleted_at = NULL WHERE id = $1 AND deleted_at IS NOT NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, query, id)
+	if err != nil {
+		return fmt.Errorf("failed to restore %s: %w", table, err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: deleted %s with ID %d", ErrNotFound, table, id)
+	}
+
+	return nil
+}
+
+// purgeDeleted removes the rows soft deleted before the given time and
+// returns how many were removed. Rows referencing them are removed by the
+// cascading foreign keys.
+func purgeDeleted(ctx context.Context, db *sql.DB, table string, before time.Time) (int64, error) {
+	query := `DELETE FROM ` + table + ` WHERE deleted_at < $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result, err := db.ExecContext(ctx, query, before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge %s: %w", table, err)
+	}
+
+	return result.RowsAffected()
+}
+
+// Restore undoes the deletion of a post.
+func (postStore *PostStore) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, postStore.db, "posts", id)
+}
+
+// PurgeDeleted removes the posts deleted before the given time.
+func (postStore *PostStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return purgeDeleted(ctx, postStore.db, "posts", before)
+}
+
+// Restore undoes the deletion of a comment, which brings back its replies.
+func (commentRepo *CommentRepo) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, commentRepo.db, "comments", id)
+}
+
+// PurgeDeleted removes the comments deleted before the given time.
+func (commentRepo *CommentRepo) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	return purgeDeleted(ctx, commentRepo.db, "comments", before)
+}
+
+// Restore undoes the deletion of a user.
+func (s *UserStore) Restore(ctx context.Context, id int64) error {
+	return restore(ctx, s.db, "users", id)
+}
+
+// PurgeDeleted removes the users deleted before the given time together with
+// their posts and comments.
+func (s *UserStore) PurgeDeleted(ctx context.Context, before time.Time) (int64, error) {
+	var purged int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, `DELETE FROM users WHERE deleted_at < $1 RETURNING id`, before)
+		if err != nil {
+			return fmt.Errorf("failed to purge users: %w", err)
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// user_invitations has no foreign key to cascade
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_invitations WHERE user_id = ANY($1)`, pq.Array(ids)); err != nil {
+			return err
+		}
+
+		purged = int64(len(ids))
+		return nil
+	})
+
+	return purged, err
+}
@@ -0,0 +1,131 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RevocationStore is the Postgres backed token revocation list, which Redis
+// mirrors when it is enabled. Entries are kept until the revoked tokens would
+// have expired anyway.
+type RevocationStore struct {
+	db *sql.DB
+}
+
+// Revocation is an entry of the revocation list: the token JTI if it is set,
+// otherwise every token of UserID issued before the second of RevokedBefore.
+type Revocation struct {
+	JTI           string
+	UserID        int64
+	RevokedBefore time.Time
+	Expiry        time.Time
+}
+
+// Revoke adds a single access token, identified by its jti claim, to the list.
+func (s *RevocationStore) Revoke(ctx context.Context, jti string, exp time.Time) error {
+	query := `
+		INSERT INTO revoked_tokens (jti, expiry) VALUES ($1, $2)
+		ON CONFLICT (jti) DO NOTHING
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, jti, exp); err != nil {
+		return err
+	}
+
+	return s.deleteExpired(ctx)
+}
+
+// RevokeAllForUser revokes every access token issued to the user before the
+// current second.
+// The entry can be dropped after exp, when none of those tokens is valid anymore.
+func (s *RevocationStore) RevokeAllForUser(ctx context.Context, userID int64, exp time.Time) error {
+	query := `
+		INSERT INTO user_token_revocations (user_id, revoked_before, expiry) VALUES ($1, NOW(), $2)
+		ON CONFLICT (user_id) DO UPDATE SET revoked_before = NOW(), expiry = EXCLUDED.expiry
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	if _, err := s.db.ExecContext(ctx, query, userID, exp); err != nil {
+		return err
+	}
+
+	return s.deleteExpired(ctx)
+}
+
+// IsRevoked reports whether the token with the given jti, issued to userID at
+// issuedAt, has been revoked individually or by a "log out all sessions". The
+// iat claim has a precision of seconds, so tokens issued in the same second as
+// a "log out all sessions" are kept, as they may be the login that followed it.
+func (s *RevocationStore) IsRevoked(ctx context.Context, jti string, userID int64, issuedAt time.Time) (bool, error) {
+	query := `
+		SELECT
+			($1::uuid IS NOT NULL AND EXISTS (SELECT 1 FROM revoked_tokens WHERE jti = $1::uuid AND expiry > NOW())) OR
+			EXISTS (SELECT 1 FROM user_token_revocations WHERE user_id = $2 AND date_trunc('second', revoked_before) > $3)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	// only tokens with a UUID jti can be revoked individually, the check is
+	// skipped for the others
+	var tokenID sql.NullString
+	if _, err := uuid.Parse(jti); err == nil {
+		tokenID = sql.NullString{String: jti, Valid: true}
+	}
+
+	var revoked bool
+	if err := s.db.QueryRowContext(ctx, query, tokenID, userID, issuedAt).Scan(&revoked); err != nil {
+		return false, err
+	}
+
+	return revoked, nil
+}
+
+// List returns the entries of the list that have not expired yet.
+func (s *RevocationStore) List(ctx context.Context) ([]Revocation, error) {
+	query := `
+		SELECT jti::text, 0, NOW(), expiry FROM revoked_tokens WHERE expiry > NOW()
+		UNION ALL
+		SELECT '', user_id, revoked_before, expiry FROM user_token_revocations WHERE expiry > NOW()
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revocations []Revocation
+	for rows.Next() {
+		var r Revocation
+		if err := rows.Scan(&r.JTI, &r.UserID, &r.RevokedBefore, &r.Expiry); err != nil {
+			return nil, err
+		}
+		revocations = append(revocations, r)
+	}
+
+	return revocations, rows.Err()
+}
+
+// deleteExpired drops the entries of the list that revoke no valid token
+// anymore.
+func (s *RevocationStore) deleteExpired(ctx context.Context) error {
+	query := `
+		WITH tokens AS (DELETE FROM revoked_tokens WHERE expiry < NOW())
+		DELETE FROM user_token_revocations WHERE expiry < NOW()
+	`
+
+	_, err := s.db.ExecContext(ctx, query)
+	return err
+}
@@ -0,0 +1,74 @@
+package repo
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestRevocations(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+	store := &RevocationStore{db}
+
+	var userID int64
+	err := db.QueryRow(`
+		INSERT INTO users (email, username, password, is_active, role_id)
+		VALUES ('gopher@example.com', 'gopher', '\x00', true, 1) RETURNING id
+	`).Scan(&userID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("should revoke a single token", func(t *testing.T) {
+		jti := uuid.New().String()
+		if err := store.Revoke(ctx, jti, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		if revoked, err := store.IsRevoked(ctx, jti, userID, time.Now()); err != nil || !revoked {
+			t.Errorf("IsRevoked() = %v, %v, want true", revoked, err)
+		}
+		for _, other := range []string{uuid.New().String(), "", "not-a-uuid"} {
+			if revoked, err := store.IsRevoked(ctx, other, userID, time.Now()); err != nil || revoked {
+				t.Errorf("IsRevoked(%q) = %v, %v, want false", other, revoked, err)
+			}
+		}
+	})
+
+	t.Run("should keep tokens issued in the second of a logout of all sessions", func(t *testing.T) {
+		if err := store.RevokeAllForUser(ctx, userID, time.Now().Add(time.Hour)); err != nil {
+			t.Fatal(err)
+		}
+
+		var revokedBefore time.Time
+		if err := db.QueryRow(`SELECT revoked_before FROM user_token_revocations WHERE user_id = $1`, userID).Scan(&revokedBefore); err != nil {
+			t.Fatal(err)
+		}
+		second := revokedBefore.Truncate(time.Second)
+
+		if revoked, err := store.IsRevoked(ctx, "", userID, second.Add(-time.Second)); err != nil || !revoked {
+			t.Errorf("IsRevoked() of an earlier token = %v, %v, want true", revoked, err)
+		}
+		if revoked, err := store.IsRevoked(ctx, "", userID, second); err != nil || revoked {
+			t.Errorf("IsRevoked() of a token of the same second = %v, %v, want false", revoked, err)
+		}
+	})
+
+	t.Run("should delete expired entries", func(t *testing.T) {
+		if _, err := db.Exec(`UPDATE user_token_revocations SET expiry = NOW() - interval '1 minute'`); err != nil {
+			t.Fatal(err)
+		}
+		if err := store.Revoke(ctx, uuid.New().String(), time.Now().Add(-time.Minute)); err != nil {
+			t.Fatal(err)
+		}
+
+		var left int
+		db.QueryRow(`SELECT (SELECT COUNT(*) FROM user_token_revocations) + (SELECT COUNT(*) FROM revoked_tokens WHERE expiry < NOW())`).Scan(&left)
+		if left != 0 {
+			t.Errorf("%d expired entries left", left)
+		}
+	})
+}
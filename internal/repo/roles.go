@@ -3,6 +3,10 @@ package repo
 import (
 	"context"
 	"database/sql"
+	"errors"
+	"slices"
+
+	"github.com/lib/pq"
 )
 
 type Role struct {
@@ -10,20 +14,233 @@ type Role struct {
 	Name        string `json:"name"`
 	Description string `json:"description"`
 	Level       int    `json:"level"`
+	RequireMFA  bool   `json:"require_mfa"`
+
+	// Names of the permissions granted to the role
+	Permissions []string `json:"permissions" example:"post.update.any,comment.delete.any"`
 }
 
+// HasPermission reports whether the role was granted the named permission.
+func (r *Role) HasPermission(name string) bool {
+	return slices.Contains(r.Permissions, name)
+}
+
+// Permission is a single privilege, e.g. "post.update.any", that roles can be
+// granted.
+type Permission struct {
+	ID          int64  `json:"id"`
+	Name        string `json:"name" example:"post.update.any"`
+	Description string `json:"description"`
+}
+
+// rolePermissionsQuery selects the permission names of the role in the roles
+// table of the enclosing query.
+const rolePermissionsQuery = `
+	ARRAY(
+		SELECT permissions.name FROM role_permissions
+		JOIN permissions ON permissions.id = role_permissions.permission_id
+		WHERE role_permissions.role_id = roles.id
+		ORDER BY permissions.name
+	)
+`
+
 type RoleRepo struct {
 	db *sql.DB
 }
 
 func (s *RoleRepo) GetByName(ctx context.Context, slug string) (*Role, error) {
-	query := `SELECT id, name, description, level FROM roles WHERE name = $1`
+	query := `SELECT id, name, description, level, require_mfa, ` + rolePermissionsQuery + ` FROM roles WHERE name = $1`
 
 	role := &Role{}
-	err := s.db.QueryRowContext(ctx, query, slug).Scan(&role.ID, &role.Name, &role.Description, &role.Level)
+	err := s.db.QueryRowContext(ctx, query, slug).Scan(
+		&role.ID,
+		&role.Name,
+		&role.Description,
+		&role.Level,
+		&role.RequireMFA,
+		pq.Array(&role.Permissions),
+	)
 	if err != nil {
 		return nil, err
 	}
 
 	return role, nil
 }
+
+// List returns all roles together with their permissions.
+func (s *RoleRepo) List(ctx context.Context) ([]Role, error) {
+	query := `SELECT id, name, description, level, require_mfa, ` + rolePermissionsQuery + ` FROM roles ORDER BY level, id`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	roles := []Role{}
+	for rows.Next() {
+		var role Role
+		if err := rows.Scan(
+			&role.ID,
+			&role.Name,
+			&role.Description,
+			&role.Level,
+			&role.RequireMFA,
+			pq.Array(&role.Permissions),
+		); err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+// ListPermissions returns every permission that can be granted.
+func (s *RoleRepo) ListPermissions(ctx context.Context) ([]Permission, error) {
+	query := `SELECT id, name, COALESCE(description, '') FROM permissions ORDER BY name`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	permissions := []Permission{}
+	for rows.Next() {
+		var p Permission
+		if err := rows.Scan(&p.ID, &p.Name, &p.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, p)
+	}
+
+	return permissions, rows.Err()
+}
+
+// GrantPermission grants the named permission to a role. Granting a
+// permission twice is a no-op; an unknown role or permission yields
+// ErrNotFound.
+func (s *RoleRepo) GrantPermission(ctx context.Context, roleID int64, permission string) error {
+	query := `
+		INSERT INTO role_permissions (role_id, permission_id)
+		SELECT $1, id FROM permissions WHERE name = $2
+		ON CONFLICT DO NOTHING
+		RETURNING permission_id
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var permissionID int64
+	err := s.db.QueryRowContext(ctx, query, roleID, permission).Scan(&permissionID)
+	if err != nil {
+		var pqErr *pq.Error
+		switch {
+		case errors.As(err, &pqErr) && pqErr.Code == "23503":
+			return ErrNotFound
+		case errors.Is(err, sql.ErrNoRows):
+			// either the permission is unknown or it was already granted
+			return s.checkPermissionExists(ctx, permission)
+		default:
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RevokePermission revokes the named permission from a role. It returns
+// ErrNotFound if the role did not have it.
+func (s *RoleRepo) RevokePermission(ctx context.Context, roleID int64, permission string) error {
+	query := `
+		DELETE FROM role_permissions
+		WHERE role_id = $1 AND permission_id = (SELECT id FROM permissions WHERE name = $2)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query, roleID, permission)
+	if err != nil {
+		return err
+	}
+
+	rows, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if rows == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// SetRequireMFA sets whether a role withholds its permissions from members
+// without MFA, and returns how many active members have not enabled it. An
+// unknown role yields ErrNotFound.
+func (s *RoleRepo) SetRequireMFA(ctx context.Context, roleID int64, require bool) (int, error) {
+	query := `
+		UPDATE roles SET require_mfa = $2 WHERE id = $1
+		RETURNING (SELECT COUNT(*) FROM users WHERE role_id = $1 AND NOT mfa_enabled AND deleted_at IS NULL)
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	var withoutMFA int
+	if err := s.db.QueryRowContext(ctx, query, roleID, require).Scan(&withoutMFA); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNotFound
+		}
+		return 0, err
+	}
+
+	return withoutMFA, nil
+}
+
+// GetUserIDs returns the ids of the users holding a role, e.g. to evict them
+// from the cache after the permissions of the role changed.
+func (s *RoleRepo) GetUserIDs(ctx context.Context, roleID int64) ([]int64, error) {
+	query := `SELECT id FROM users WHERE role_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, roleID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func (s *RoleRepo) checkPermissionExists(ctx context.Context, permission string) error {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM permissions WHERE name = $1)`, permission).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+
+	return nil
+}
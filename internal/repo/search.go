@@ -0,0 +1,220 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Types of search results.
+const (
+	SearchTypePosts    = "posts"
+	SearchTypeComments = "comments"
+	SearchTypeUsers    = "users"
+)
+
+// headlineOptions mark the matched words in titles and snippets.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MaxWords=30, MinWords=10"
+
+type SearchQuery struct {
+	// Query uses the web search syntax, e.g. `"exact phrase" -excluded or other`
+	Query  string        `json:"q" validate:"required,max=200"`
+	Type   string        `json:"type" validate:"oneof=posts comments users"`
+	Limit  int           `json:"limit" validate:"gte=1,lte=50"`
+	Cursor *SearchCursor `json:"-"`
+}
+
+// SearchCursor points at the last result of a page, results are ordered by
+// descending score and ID.
+type SearchCursor struct {
+	Score float64
+	ID    int64
+}
+
+// Encode returns the opaque form of the cursor handed to clients.
+func (c SearchCursor) Encode() string {
+	raw := strconv.FormatFloat(c.Score, 'g', -1, 64) + "," + strconv.FormatInt(c.ID, 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeSearchCursor parses a cursor created by SearchCursor.Encode.
+func DecodeSearchCursor(s string) (*SearchCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	scoreStr, idStr, ok := strings.Cut(string(raw), ",")
+	if !ok {
+		return nil, errInvalidCursor
+	}
+
+	score, err := strconv.ParseFloat(scoreStr, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	id, err := strconv.ParseInt(idStr, 10, 64)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return &SearchCursor{Score: score, ID: id}, nil
+}
+
+// SearchResult is a post, comment or user matching a search.
+type SearchResult struct {
+	Type string `json:"type" example:"posts"`
+	ID   int64  `json:"id" example:"1"`
+	// Relevance of the result, higher is better
+	Score float64 `json:"score" example:"0.6"`
+	// Title of the post, or the username of a user, with <mark>ed matches
+	Title string `json:"title,omitempty" example:"Getting started with <mark>Go</mark>"`
+	// Fragments of the post or comment around the matches
+	Snippet   string `json:"snippet,omitempty" example:"... microservices in <mark>Go</mark> ..."`
+	PostID    int64  `json:"post_id,omitempty" example:"1"`
+	UserID    int64  `json:"user_id" example:"2"`
+	Username  string `json:"username" example:"johndoe"`
+	CreatedAt string `json:"created_at" example:"2024-01-15T10:30:00Z"`
+}
+
+// SearchPage is a page of search results with the cursor of the next page,
+// which is empty on the last page.
+type SearchPage struct {
+	Results    []SearchResult
+	NextCursor string
+}
+
+type SearchStore struct {
+	db *sql.DB
+}
+
+// Posts searches the title, content and tags of posts, ranked by relevance.
+func (s *SearchStore) Posts(ctx context.Context, q SearchQuery) (*SearchPage, error) {
+	query := `
+		SELECT r.id, r.score, ts_headline('english', r.title, r.query, 'HighlightAll=true, StartSel=<mark>, StopSel=</mark>'),
+			ts_headline('english', r.content, r.query, '` + headlineOptions + `'),
+			r.user_id, COALESCE(u.username, ''), r.created_at
+		FROM (
+			SELECT p.id, p.title, p.content, p.user_id, p.created_at, q.query,
+				ts_rank_cd(p.search_vector, q.query) AS score
+			FROM posts p
+			JOIN users pu ON pu.id = p.user_id AND pu.deleted_at IS NULL,
+			websearch_to_tsquery('english', $1) q(query)
+			WHERE p.search_vector @@ q.query AND p.deleted_at IS NULL
+		) r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE true` + keysetCondition(q.Cursor) + `
+		ORDER BY r.score DESC, r.id DESC
+		LIMIT $2
+	`
+
+	return s.search(ctx, SearchTypePosts, query, q, func(rows *sql.Rows, res *SearchResult) error {
+		return rows.Scan(&res.ID, &res.Score, &res.Title, &res.Snippet, &res.UserID, &res.Username, &res.CreatedAt)
+	})
+}
+
+// Comments searches the content of comments, ranked by relevance.
+func (s *SearchStore) Comments(ctx context.Context, q SearchQuery) (*SearchPage, error) {
+	query := `
+		SELECT r.id, r.score, ts_headline('english', r.content, r.query, '` + headlineOptions + `'),
+			r.post_id, r.user_id, COALESCE(u.username, ''), r.created_at
+		FROM (
+			SELECT c.id, c.content, c.post_id, c.user_id, c.created_at, q.query,
+				ts_rank_cd(c.search_vector, q.query) AS score
+			FROM comments c
+			JOIN posts p ON p.id = c.post_id AND p.deleted_at IS NULL
+			JOIN users pu ON pu.id = p.user_id AND pu.deleted_at IS NULL,
+			websearch_to_tsquery('english', $1) q(query)
+			WHERE c.search_vector @@ q.query AND c.deleted_at IS NULL AND ` + visibleComment("c.id") + `
+		) r
+		LEFT JOIN users u ON u.id = r.user_id
+		WHERE true` + keysetCondition(q.Cursor) + `
+		ORDER BY r.score DESC, r.id DESC
+		LIMIT $2
+	`
+
+	return s.search(ctx, SearchTypeComments, query, q, func(rows *sql.Rows, res *SearchResult) error {
+		return rows.Scan(&res.ID, &res.Score, &res.Snippet, &res.PostID, &res.UserID, &res.Username, &res.CreatedAt)
+	})
+}
+
+// Users searches the usernames of active users by trigram similarity, so that
+// misspelled and partial names match too.
+func (s *SearchStore) Users(ctx context.Context, q SearchQuery) (*SearchPage, error) {
+	query := `
+		SELECT r.id, r.score, r.username, r.created_at
+		FROM (
+			SELECT u.id, u.username, u.created_at, similarity(u.username, $1) AS score
+			FROM users u
+			WHERE u.is_active = true AND u.deleted_at IS NULL AND (u.username % $1 OR strpos(lower(u.username), lower($1)) = 1)
+		) r
+		WHERE true` + keysetCondition(q.Cursor) + `
+		ORDER BY r.score DESC, r.id DESC
+		LIMIT $2
+	`
+
+	return s.search(ctx, SearchTypeUsers, query, q, func(rows *sql.Rows, res *SearchResult) error {
+		if err := rows.Scan(&res.ID, &res.Score, &res.Username, &res.CreatedAt); err != nil {
+			return err
+		}
+		res.Title = res.Username
+		res.UserID = res.ID
+		return nil
+	})
+}
+
+func (s *SearchStore) search(
+	ctx context.Context,
+	resultType string,
+	query string,
+	q SearchQuery,
+	scan func(rows *sql.Rows, res *SearchResult) error,
+) (*SearchPage, error) {
+	args := []any{q.Query, q.Limit + 1}
+	if q.Cursor != nil {
+		args = append(args, q.Cursor.Score, q.Cursor.ID)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to search %s: %w", resultType, err)
+	}
+	defer rows.Close()
+
+	results := []SearchResult{}
+	for rows.Next() {
+		res := SearchResult{Type: resultType}
+		if err := scan(rows, &res); err != nil {
+			return nil, err
+		}
+		results = append(results, res)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	page := &SearchPage{Results: results}
+	if len(results) > q.Limit {
+		page.Results = results[:q.Limit]
+		last := page.Results[q.Limit-1]
+		page.NextCursor = SearchCursor{Score: last.Score, ID: last.ID}.Encode()
+	}
+
+	return page, nil
+}
+
+// keysetCondition selects the results after the cursor. Scores are real, so
+// the cursor is compared as real to match the score it was read from.
+func keysetCondition(cursor *SearchCursor) string {
+	if cursor == nil {
+		return ""
+	}
+	return ` AND (r.score, r.id) < ($3::real, $4)`
+}
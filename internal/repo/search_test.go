@@ -0,0 +1,26 @@
+package repo
+
+import "testing"
+
+func TestSearchCursor(t *testing.T) {
+	t.Run("should round trip", func(t *testing.T) {
+		// scores are real in the database, the cursor must not alter them
+		want := SearchCursor{Score: float64(float32(0.0607927)), ID: 42}
+
+		got, err := DecodeSearchCursor(want.Encode())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if *got != want {
+			t.Errorf("got %+v, want %+v", got, want)
+		}
+	})
+
+	t.Run("should reject tampered cursors", func(t *testing.T) {
+		for _, cursor := range []string{"not base64!", "MC41", "eCwx"} {
+			if _, err := DecodeSearchCursor(cursor); err == nil {
+				t.Errorf("cursor %q accepted", cursor)
+			}
+		}
+	})
+}
@@ -0,0 +1,270 @@
+package repo
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testDB migrates a schema of its own on the Postgres server at DB_TEST_ADDR,
+// if set, and drops it after the test.
+func testDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	addr := os.Getenv("DB_TEST_ADDR")
+	if addr == "" {
+		t.Skip("DB_TEST_ADDR not set")
+	}
+
+	admin, err := sql.Open("postgres", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	schema := fmt.Sprintf("test_%d", time.Now().UnixNano())
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatalf("failed to connect to postgres at %s: %v", addr, err)
+	}
+	t.Cleanup(func() {
+		admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`)
+		admin.Close()
+	})
+
+	// unknown parameters are sent to the server as settings of the session
+	sep := " "
+	if strings.Contains(addr, "://") {
+		sep = "?"
+		if strings.Contains(addr, "?") {
+			sep = "&"
+		}
+	}
+	db, err := sql.Open("postgres", addr+sep+"search_path="+schema+",public")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	migrations, err := filepath.Glob("../../cmd/migrate/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(migrations)
+	for _, migration := range migrations {
+		data, err := os.ReadFile(migration)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := db.Exec(string(data)); err != nil {
+			t.Fatalf("failed to apply %s: %v", filepath.Base(migration), err)
+		}
+	}
+
+	return db
+}
+
+func TestSoftDelete(t *testing.T) {
+	ctx := context.Background()
+	db := testDB(t)
+
+	store, err := NewPostgresRepo(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	insert := func(t *testing.T, query string, args ...any) int64 {
+		t.Helper()
+		var id int64
+		if err := db.QueryRow(query, args...).Scan(&id); err != nil {
+			t.Fatal(err)
+		}
+		return id
+	}
+	newUser := func(t *testing.T, name string) int64 {
+		return insert(t, `
+			INSERT INTO users (email, username, password, is_active, role_id)
+			VALUES ($1::text || '@example.com', $1, '\x00', true, 1) RETURNING id
+		`, name)
+	}
+	newPost := func(t *testing.T, userID int64, content string) int64 {
+		return insert(t, `INSERT INTO posts (title, content, user_id, tags) VALUES ('post', $1, $2, '{}') RETURNING id`, content, userID)
+	}
+	newComment := func(t *testing.T, postID, userID int64, parentID *int64, content string) int64 {
+		t.Helper()
+		comment := &Comment{PostID: postID, UserID: userID, ParentID: parentID, Content: content}
+		if err := store.Comments.Create(ctx, comment); err != nil {
+			t.Fatal(err)
+		}
+		return comment.ID
+	}
+
+	alice, bob, carol := newUser(t, "alice"), newUser(t, "bob"), newUser(t, "carol")
+	if _, err := db.Exec(`INSERT INTO followers (user_id, follower_id) VALUES ($1, $2)`, bob, alice); err != nil {
+		t.Fatal(err)
+	}
+
+	post := newPost(t, alice, "a post by alice")
+	bobsPost := newPost(t, bob, "a post by bob about gophers")
+	comment := newComment(t, post, bob, nil, "a comment by bob")
+	reply := newComment(t, post, alice, &comment, "a reply by alice")
+	nested := newComment(t, post, carol, &reply, "a nested reply about gophers")
+
+	// thread returns the IDs of the comments of the post, depth first
+	thread := func(t *testing.T, parentID int64) []int64 {
+		t.Helper()
+		page, err := store.Comments.GetThread(ctx, post, CommentQuery{ParentID: parentID, Limit: 10, Depth: 3})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var ids []int64
+		var walk func(comments []Comment)
+		walk = func(comments []Comment) {
+			for _, c := range comments {
+				ids = append(ids, c.ID)
+				walk(c.Replies)
+			}
+		}
+		walk(page.Comments)
+		return ids
+	}
+
+	searchComments := func(t *testing.T) int {
+		t.Helper()
+		page, err := store.Search.Comments(ctx, SearchQuery{Query: "gophers", Type: SearchTypeComments, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return len(page.Results)
+	}
+
+	t.Run("should not delete a comment changed since it was read", func(t *testing.T) {
+		if err := store.Comments.Delete(ctx, &Comment{ID: comment, Version: 1}); !errors.Is(err, ErrEditConflict) {
+			t.Errorf("Delete() = %v, want ErrEditConflict", err)
+		}
+	})
+
+	t.Run("should hide the replies of a deleted comment", func(t *testing.T) {
+		if err := store.Comments.Delete(ctx, &Comment{ID: comment}); err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := thread(t, 0); len(ids) != 0 {
+			t.Errorf("thread shows %v", ids)
+		}
+		if ids := thread(t, reply); len(ids) != 0 {
+			t.Errorf("replies of %d show %v", reply, ids)
+		}
+		if _, err := store.Comments.GetByID(ctx, nested); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByID() = %v, want ErrNotFound", err)
+		}
+		if n := searchComments(t); n != 0 {
+			t.Errorf("search found %d comments", n)
+		}
+
+		orphan := &Comment{PostID: post, UserID: carol, ParentID: &nested, Content: "a reply to a hidden reply"}
+		if err := store.Comments.Create(ctx, orphan); !errors.Is(err, ErrParentNotFound) {
+			t.Errorf("Create() = %v, want ErrParentNotFound", err)
+		}
+	})
+
+	t.Run("should bring the replies back on restore", func(t *testing.T) {
+		if err := store.Comments.Restore(ctx, comment); err != nil {
+			t.Fatal(err)
+		}
+
+		if ids := thread(t, 0); fmt.Sprint(ids) != fmt.Sprint([]int64{comment, reply, nested}) {
+			t.Errorf("thread shows %v", ids)
+		}
+		if n := searchComments(t); n != 1 {
+			t.Errorf("search found %d comments, want 1", n)
+		}
+	})
+
+	t.Run("should hide the posts and comments of a deleted user", func(t *testing.T) {
+		if err := store.Users.Delete(ctx, bob); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Posts.GetByID(ctx, bobsPost); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetByID() = %v, want ErrNotFound", err)
+		}
+
+		feed, err := store.Posts.GetUserFeed(ctx, alice, PaginatedFeedQuery{Limit: 10, Sort: "desc", Mode: FeedModeChronological})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(feed.Posts) != 1 || feed.Posts[0].ID != post {
+			t.Errorf("feed shows %d posts, want only the post of alice", len(feed.Posts))
+		}
+
+		page, err := store.Search.Posts(ctx, SearchQuery{Query: "gophers", Type: SearchTypePosts, Limit: 10})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(page.Results) != 0 {
+			t.Errorf("search found %d posts", len(page.Results))
+		}
+
+		if ids := thread(t, 0); len(ids) != 0 {
+			t.Errorf("thread shows %v", ids)
+		}
+	})
+
+	t.Run("should bring back the posts and comments of a restored user", func(t *testing.T) {
+		if err := store.Users.Restore(ctx, bob); err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := store.Posts.GetByID(ctx, bobsPost); err != nil {
+			t.Errorf("GetByID() = %v", err)
+		}
+		if ids := thread(t, 0); len(ids) != 3 {
+			t.Errorf("thread shows %v", ids)
+		}
+	})
+
+	t.Run("should purge deleted comments with their replies", func(t *testing.T) {
+		if err := store.Comments.Delete(ctx, &Comment{ID: comment}); err != nil {
+			t.Fatal(err)
+		}
+
+		// rows deleted before the retention period are purged
+		if n, err := store.Comments.PurgeDeleted(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+			t.Fatalf("PurgeDeleted() = %d, %v, want 1", n, err)
+		}
+
+		var left int
+		db.QueryRow(`SELECT COUNT(*) FROM comments WHERE id IN ($1, $2, $3)`, comment, reply, nested).Scan(&left)
+		if left != 0 {
+			t.Errorf("%d comments left", left)
+		}
+		if err := store.Comments.Restore(ctx, comment); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Restore() = %v, want ErrNotFound", err)
+		}
+	})
+
+	t.Run("should purge deleted users with their posts", func(t *testing.T) {
+		if err := store.Users.Delete(ctx, bob); err != nil {
+			t.Fatal(err)
+		}
+
+		if n, err := store.Users.PurgeDeleted(ctx, time.Now().Add(-time.Minute)); err != nil || n != 0 {
+			t.Fatalf("PurgeDeleted() within the retention period = %d, %v, want 0", n, err)
+		}
+		if n, err := store.Users.PurgeDeleted(ctx, time.Now().Add(time.Minute)); err != nil || n != 1 {
+			t.Fatalf("PurgeDeleted() = %d, %v, want 1", n, err)
+		}
+
+		var left int
+		db.QueryRow(`SELECT COUNT(*) FROM posts WHERE user_id = $1`, bob).Scan(&left)
+		if left != 0 {
+			t.Errorf("%d posts left", left)
+		}
+	})
+}
@@ -6,8 +6,11 @@ import (
 	"database/sql"
 	"encoding/hex"
 	"errors"
+	"fmt"
 	"golang.org/x/crypto/bcrypt"
 	"time"
+
+	"github.com/lib/pq"
 )
 
 var (
@@ -47,6 +50,9 @@ type User struct {
 	RoleID int64 `json:"role_id"`
 
 	Role Role `json:"role"`
+
+	// Whether the user signs in with a TOTP code as second factor
+	MFAEnabled bool `json:"mfa_enabled" example:"false"`
 }
 
 type password struct {
@@ -98,10 +104,12 @@ func (s *UserStore) Create(ctx context.Context, tx *sql.Tx, user *User) error {
 
 func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 	query := `
-		SELECT users.id, username, email, password, created_at, roles.*
+		SELECT users.id, username, email, password, created_at, mfa_enabled,
+		       roles.id, roles.name, roles.level, roles.description, roles.require_mfa,
+		       ` + rolePermissionsQuery + `
 		FROM users
 		JOIN roles ON users.role_id = roles.id
-		WHERE users.id = $1 AND users.is_active = true 
+		WHERE users.id = $1 AND users.is_active = true AND users.deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
@@ -118,10 +126,13 @@ func (s *UserStore) GetByID(ctx context.Context, userID int64) (*User, error) {
 		&user.Email,
 		&user.Password.hash,
 		&user.CreatedAt,
+		&user.MFAEnabled,
 		&user.Role.ID,
 		&user.Role.Name,
 		&user.Role.Level,
 		&user.Role.Description,
+		&user.Role.RequireMFA,
+		pq.Array(&user.Role.Permissions),
 	)
 	if err != nil {
 		switch {
@@ -186,7 +197,7 @@ func (s *UserStore) getUserFromInvitation(ctx context.Context, tx *sql.Tx, token
 		SELECT u.id, u.username, u.email, u.created_at, u.is_active
 		FROM users u
 		JOIN user_invitations ui ON u.id = ui.user_id
-		WHERE ui.token = $1 AND ui.expiry > $2
+		WHERE ui.token = $1 AND ui.expiry > $2 AND u.deleted_at IS NULL
 	`
 
 	hash := sha256.Sum256([]byte(token))
@@ -243,7 +254,144 @@ func (s *UserStore) deleteUserInvitations(ctx context.Context, tx *sql.Tx, userI
 	return nil
 }
 
+// RotateInvitation replaces the invitations of the not yet activated user with
+// the given email by a new one. It returns ErrNotFound if there is no such user.
+func (s *UserStore) RotateInvitation(ctx context.Context, email string, token string, invitationExp time.Duration) (*User, error) {
+	user := &User{}
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			SELECT id, username, email, created_at FROM users
+			WHERE email = $1 AND is_active = false AND deleted_at IS NULL
+			FOR UPDATE
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+		defer cancel()
+
+		err := tx.QueryRowContext(ctx, query, email).Scan(
+			&user.ID,
+			&user.Username,
+			&user.Email,
+			&user.CreatedAt,
+		)
+		if err != nil {
+			switch {
+			case errors.Is(err, sql.ErrNoRows):
+				return ErrNotFound
+			default:
+				return err
+			}
+		}
+
+		if err := s.deleteUserInvitations(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		return s.createUserInvitation(ctx, tx, token, invitationExp, user.ID)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// DeleteExpiredInvitations removes invitations past their expiry and returns
+// how many were removed.
+func (s *UserStore) DeleteExpiredInvitations(ctx context.Context) (int64, error) {
+	query := `DELETE FROM user_invitations WHERE expiry < NOW()`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	res, err := s.db.ExecContext(ctx, query)
+	if err != nil {
+		return 0, err
+	}
+
+	return res.RowsAffected()
+}
+
+// DeleteUnactivated removes users that registered more than maxAge ago but
+// never activated their account and hold no valid invitation, releasing their
+// email and username. It returns how many users were removed.
+func (s *UserStore) DeleteUnactivated(ctx context.Context, maxAge time.Duration) (int64, error) {
+	var deleted int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		query := `
+			DELETE FROM users
+			WHERE is_active = false AND created_at < $1
+			  AND NOT EXISTS (
+				SELECT 1 FROM user_invitations
+				WHERE user_invitations.user_id = users.id AND user_invitations.expiry > NOW()
+			  )
+			RETURNING id
+		`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+		defer cancel()
+
+		rows, err := tx.QueryContext(ctx, query, time.Now().Add(-maxAge))
+		if err != nil {
+			return err
+		}
+
+		var ids []int64
+		for rows.Next() {
+			var id int64
+			if err := rows.Scan(&id); err != nil {
+				rows.Close()
+				return err
+			}
+			ids = append(ids, id)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return err
+		}
+
+		// user_invitations has no foreign key to cascade
+		if _, err := tx.ExecContext(ctx, `DELETE FROM user_invitations WHERE user_id = ANY($1)`, pq.Array(ids)); err != nil {
+			return err
+		}
+
+		deleted = int64(len(ids))
+		return nil
+	})
+
+	return deleted, err
+}
+
+// Delete soft deletes a user, who can no longer sign in and is hidden from
+// every read until restored or purged. Posts and comments of the user stay.
 func (s *UserStore) Delete(ctx context.Context, userID int64) error {
+	query := `UPDATE users SET deleted_at = NOW() WHERE id = $1 AND deleted_at IS NULL`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	result, err := s.db.ExecContext(ctx, query, userID)
+	if err != nil {
+		return fmt.Errorf("failed to delete user: %w", err)
+	}
+
+	rowsAffected, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed to get rows affected: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return fmt.Errorf("%w: user with ID %d", ErrNotFound, userID)
+	}
+
+	return nil
+}
+
+// Purge removes a user right away, e.g. to roll back a registration that
+// could not be completed.
+func (s *UserStore) Purge(ctx context.Context, userID int64) error {
 	return withTx(s.db, ctx, func(tx *sql.Tx) error {
 		if err := s.delete(ctx, tx, userID); err != nil {
 			return err
@@ -273,8 +421,8 @@ func (s *UserStore) delete(ctx context.Context, tx *sql.Tx, id int64) error {
 
 func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error) {
 	query := `
-		SELECT id, username, email, password, created_at FROM users
-		WHERE email = $1 AND is_active = true
+		SELECT id, username, email, password, created_at, mfa_enabled FROM users
+		WHERE email = $1 AND is_active = true AND deleted_at IS NULL
 	`
 
 	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
@@ -287,6 +435,7 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 		&user.Email,
 		&user.Password.hash,
 		&user.CreatedAt,
+		&user.MFAEnabled,
 	)
 	if err != nil {
 		switch {
@@ -299,6 +448,107 @@ func (s *UserStore) GetByEmail(ctx context.Context, email string) (*User, error)
 	return user, nil
 }
 
+// CreatePasswordReset stores the hashed reset token for the user, replacing any
+// reset that is still outstanding.
+func (s *UserStore) CreatePasswordReset(ctx context.Context, userID int64, token string, exp time.Duration) error {
+	return withTx(s.db, ctx, func(tx *sql.Tx) error {
+		if err := s.deletePasswordResets(ctx, tx, userID); err != nil {
+			return err
+		}
+
+		query := `INSERT INTO password_resets (token, user_id, expiry) VALUES ($1, $2, $3)`
+
+		ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+		defer cancel()
+
+		_, err := tx.ExecContext(ctx, query, token, userID, time.Now().Add(exp))
+		return err
+	})
+}
+
+// ResetPassword sets a new password for the user the hashed reset token was
+// issued to and consumes every outstanding reset of that user. It returns the
+// ID of the user, or ErrNotFound if the token is unknown or expired.
+func (s *UserStore) ResetPassword(ctx context.Context, token string, newPassword string) (int64, error) {
+	var userID int64
+
+	err := withTx(s.db, ctx, func(tx *sql.Tx) error {
+		user, err := s.getUserFromPasswordReset(ctx, tx, token)
+		if err != nil {
+			return err
+		}
+
+		if err := user.Password.Set(newPassword); err != nil {
+			return err
+		}
+
+		if err := s.updatePassword(ctx, tx, user); err != nil {
+			return err
+		}
+
+		if err := s.deletePasswordResets(ctx, tx, user.ID); err != nil {
+			return err
+		}
+
+		userID = user.ID
+		return nil
+	})
+
+	return userID, err
+}
+
+func (s *UserStore) getUserFromPasswordReset(ctx context.Context, tx *sql.Tx, token string) (*User, error) {
+	query := `
+		SELECT u.id, u.username, u.email, u.created_at, u.is_active
+		FROM users u
+		JOIN password_resets pr ON u.id = pr.user_id
+		WHERE pr.token = $1 AND pr.expiry > $2 AND u.is_active = true AND u.deleted_at IS NULL
+		FOR UPDATE OF pr
+	`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	user := &User{}
+	err := tx.QueryRowContext(ctx, query, token, time.Now()).Scan(
+		&user.ID,
+		&user.Username,
+		&user.Email,
+		&user.CreatedAt,
+		&user.IsActive,
+	)
+	if err != nil {
+		switch {
+		case errors.Is(err, sql.ErrNoRows):
+			return nil, ErrNotFound
+		default:
+			return nil, err
+		}
+	}
+
+	return user, nil
+}
+
+func (s *UserStore) updatePassword(ctx context.Context, tx *sql.Tx, user *User) error {
+	query := `UPDATE users SET password = $1 WHERE id = $2`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, user.Password.hash, user.ID)
+	return err
+}
+
+func (s *UserStore) deletePasswordResets(ctx context.Context, tx *sql.Tx, userID int64) error {
+	query := `DELETE FROM password_resets WHERE user_id = $1`
+
+	ctx, cancel := context.WithTimeout(ctx, QueryTimeout)
+	defer cancel()
+
+	_, err := tx.ExecContext(ctx, query, userID)
+	return err
+}
+
 func (p *password) Compare(text string) error {
 	return bcrypt.CompareHashAndPassword(p.hash, []byte(text))
 }
\ No newline at end of file